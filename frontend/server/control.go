@@ -0,0 +1,164 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mruck/athena/goFuzz/control"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Actions the fuzzer accepts on /control/<action>
+const (
+	controlPause  = "pause"
+	controlResume = "resume"
+	controlStop   = "stop"
+)
+
+// How long a stopped fuzzer gets to store its results before its pod is
+// deleted
+const stopTimeout = 20 * time.Second
+
+var controlClient = &http.Client{Timeout: 10 * time.Second}
+
+// newControlToken returns a random token for the fuzzer to accept control
+// requests with
+func newControlToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// controlToken looks up the token the fuzzer in a pod was given
+func controlToken(pod *v1.Pod) (string, error) {
+	for _, container := range pod.Spec.Containers {
+		if container.Name != "athena" {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == control.TokenEnvVar {
+				return env.Value, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("pod %s has no control token", pod.ObjectMeta.Name)
+}
+
+// sendControl asks the fuzzer in a pod to pause, resume or stop
+func sendControl(pod *v1.Pod, action string) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod %s has no ip", pod.ObjectMeta.Name)
+	}
+	token, err := controlToken(pod)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://%s:%d/control/%s", pod.Status.PodIP, metricsPort, action)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set(control.TokenHeader, token)
+	resp, err := controlClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending %s to pod %s: %v", action, pod.ObjectMeta.Name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("pod %s rejected %s: %s", pod.ObjectMeta.Name, action, resp.Status)
+	}
+	return nil
+}
+
+// targetPod looks up the fuzz pod for the target in the request, writing an
+// error to the response if it can't
+func (server *Server) targetPod(w http.ResponseWriter, r *http.Request) (*v1.Pod, bool) {
+	targetID := mux.Vars(r)["targetID"]
+	pod, err := GetTargetPod(server.Pods, targetID)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return nil, false
+	}
+	return pod, true
+}
+
+// PauseTargetHandler pauses the fuzzer for a target in between requests
+func (server *Server) PauseTargetHandler(w http.ResponseWriter, r *http.Request) {
+	server.control(w, r, controlPause)
+}
+
+// ResumeTargetHandler resumes a paused fuzzer
+func (server *Server) ResumeTargetHandler(w http.ResponseWriter, r *http.Request) {
+	server.control(w, r, controlResume)
+}
+
+func (server *Server) control(w http.ResponseWriter, r *http.Request, action string) {
+	pod, ok := server.targetPod(w, r)
+	if !ok {
+		return
+	}
+	err := sendControl(pod, action)
+	if err != nil {
+		http.Error(w, err.Error(), 502)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stoppedSince checks if status is the final status of a run, published
+// after before.  Before is nil if nothing was published.
+func stoppedSince(before *run.Status, status *run.Status) bool {
+	if !status.Done() {
+		return false
+	}
+	return before == nil || status.Updated.After(before.Updated)
+}
+
+// StopTargetHandler stops the fuzzer for a target and deletes its pod.  The
+// fuzzer is given a chance to store the run summary first.  Deleting the pod
+// also asks it to stop, so the pod is deleted even if the fuzzer can't be
+// reached.  It returns the last status of the run.
+func (server *Server) StopTargetHandler(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["targetID"]
+	pod, ok := server.targetPod(w, r)
+	if !ok {
+		return
+	}
+
+	// An earlier run may have finished, so only a status published after
+	// this one counts
+	before, err := server.Runs.LatestStatus(targetID)
+	if err != nil {
+		before = nil
+	}
+	err = sendControl(pod, controlStop)
+	if err != nil {
+		log.Errorf("%v, deleting the pod anyway", err)
+	} else {
+		// Wait for the fuzzer to check in with its final status
+		for start := time.Now(); time.Since(start) < stopTimeout; time.Sleep(pollInterval) {
+			status, err := server.Runs.LatestStatus(targetID)
+			if err == nil && stoppedSince(before, status) {
+				break
+			}
+		}
+	}
+	DeletePod(server.Pods, pod.ObjectMeta.Name)
+
+	status, err := server.Runs.LatestStatus(targetID)
+	if err != nil {
+		// The fuzzer never published a status
+		status = &run.Status{TargetID: targetID}
+	}
+	WriteJSONResponse(status, w)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mruck/athena/lib/run"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoppedSince(t *testing.T) {
+	start := time.Now()
+	fuzzing := &run.Status{RunID: "current", Phase: run.Fuzzing, Updated: start}
+	stopped := &run.Status{RunID: "current", Phase: run.Stopped, Updated: start.Add(time.Second)}
+	require.False(t, stoppedSince(fuzzing, fuzzing))
+	require.True(t, stoppedSince(fuzzing, stopped))
+	require.True(t, stoppedSince(nil, stopped))
+
+	// The previous run finished and the current one hasn't published yet
+	previous := &run.Status{RunID: "previous", Phase: run.Finished, Updated: start.Add(-time.Hour)}
+	require.False(t, stoppedSince(previous, previous))
+	require.True(t, stoppedSince(previous, stopped))
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+// FakeJobStore keeps jobs in memory so the runner can be used without a db
+type FakeJobStore struct {
+	lock sync.Mutex
+	Jobs map[string]*Job
+}
+
+// NewFakeJobStore returns a FakeJobStore with no jobs
+func NewFakeJobStore() *FakeJobStore {
+	return &FakeJobStore{Jobs: map[string]*Job{}}
+}
+
+// Save stores a copy of the job, replacing any earlier copy
+func (fake *FakeJobStore) Save(job *Job) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	job.Updated = time.Now()
+	fake.Jobs[job.JobID] = job.Copy()
+	return nil
+}
+
+// Get returns a copy of a job
+func (fake *FakeJobStore) Get(jobID string) (*Job, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	job, ok := fake.Jobs[jobID]
+	if !ok {
+		return nil, errors.WithStack(mgo.ErrNotFound)
+	}
+	return job.Copy(), nil
+}
+
+// GetAll returns copies of every job, newest first
+func (fake *FakeJobStore) GetAll() ([]Job, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	var jobs []Job
+	for _, job := range fake.Jobs {
+		jobs = append(jobs, *job.Copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.After(jobs[j].Created)
+	})
+	return jobs, nil
+}
+
+// FailUnfinished fails every job that was queued or running
+func (fake *FakeJobStore) FailUnfinished() error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	for _, job := range fake.Jobs {
+		if job.State == JobQueued || job.State == JobRunning {
+			job.State = JobFailed
+			job.SkipPending("the frontend restarted")
+			job.Updated = time.Now()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// FakePodRunner keeps pods in memory so phases can be run without a
+// cluster.  By default every container is ready as soon as the pod is
+// created.
+type FakePodRunner struct {
+	lock sync.Mutex
+	Pods map[string]*v1.Pod
+	// Names of pods in the order they were created and deleted
+	Created []string
+	Deleted []string
+	// OnCreate sets the status of a new pod, overriding the default
+	OnCreate func(pod *v1.Pod)
+	// CreateErr is returned by Create if set
+	CreateErr error
+}
+
+// NewFakePodRunner returns a FakePodRunner with no pods
+func NewFakePodRunner() *FakePodRunner {
+	return &FakePodRunner{Pods: map[string]*v1.Pod{}}
+}
+
+// Create stores a copy of the pod
+func (fake *FakePodRunner) Create(pod *v1.Pod) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if fake.CreateErr != nil {
+		return fake.CreateErr
+	}
+	name := pod.ObjectMeta.Name
+	if _, ok := fake.Pods[name]; ok {
+		return fmt.Errorf("pod %s already exists", name)
+	}
+	created := pod.DeepCopy()
+	if fake.OnCreate != nil {
+		fake.OnCreate(created)
+	} else {
+		created.Status.Phase = v1.PodRunning
+		for _, container := range created.Spec.Containers {
+			created.Status.ContainerStatuses = append(created.Status.ContainerStatuses,
+				v1.ContainerStatus{Name: container.Name, Ready: true})
+		}
+	}
+	fake.Pods[name] = created
+	fake.Created = append(fake.Created, name)
+	return nil
+}
+
+// Get returns a copy of a pod
+func (fake *FakePodRunner) Get(name string) (*v1.Pod, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	pod, ok := fake.Pods[name]
+	if !ok {
+		return nil, fmt.Errorf("pod %s not found", name)
+	}
+	return pod.DeepCopy(), nil
+}
+
+// Delete removes a pod
+func (fake *FakePodRunner) Delete(name string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, ok := fake.Pods[name]; !ok {
+		return fmt.Errorf("pod %s not found", name)
+	}
+	delete(fake.Pods, name)
+	fake.Deleted = append(fake.Deleted, name)
+	return nil
+}
+
+// List returns the pods matching a comma separated list of key=value
+// labels
+func (fake *FakePodRunner) List(selector string) ([]v1.Pod, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	var matches []v1.Pod
+	for _, pod := range fake.Pods {
+		if matchLabels(pod.ObjectMeta.Labels, selector) {
+			matches = append(matches, *pod.DeepCopy())
+		}
+	}
+	return matches, nil
+}
+
+func matchLabels(labels map[string]string, selector string) bool {
+	for _, requirement := range strings.Split(selector, ",") {
+		parts := strings.SplitN(requirement, "=", 2)
+		if len(parts) != 2 || labels[parts[0]] != parts[1] {
+			return false
+		}
+	}
+	return true
+}
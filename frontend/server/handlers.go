@@ -2,21 +2,45 @@ package server
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/mruck/athena/lib/exception"
 	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 )
 
 type Server struct {
 	Exceptions *exception.ExceptionsManager
+	Runs       *run.RunsManager
+	Pods       PodRunner
+	Runner     *JobRunner
 }
 
-func NewServer(db *mgo.Database) (*Server, error) {
+func NewServer(db *mgo.Database, pods PodRunner) (*Server, error) {
 	exceptions := exception.NewExceptionsManager(db, "")
-	return &Server{Exceptions: exceptions}, nil
+
+	workers, err := strconv.Atoi(util.DefaultEnv("JOB_WORKERS", "1"))
+	if err != nil || workers < 1 {
+		return nil, fmt.Errorf("invalid JOB_WORKERS: %v", os.Getenv("JOB_WORKERS"))
+	}
+	runner, err := NewJobRunner(NewJobsManager(db), pods, workers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		Exceptions: exceptions,
+		Runs:       run.NewRunsManager(db),
+		Pods:       pods,
+		Runner:     runner,
+	}, nil
 }
 
 func (server *Server) getRoutes() Routes {
@@ -39,6 +63,72 @@ func (server *Server) getRoutes() Routes {
 			"/FuzzTarget",
 			server.FuzzTarget,
 		},
+		Route{
+			"Jobs",
+			"GET",
+			"/Jobs",
+			server.JobsHandler,
+		},
+		Route{
+			"Job",
+			"GET",
+			"/Jobs/{jobID}",
+			server.JobHandler,
+		},
+		Route{
+			"CancelJob",
+			"POST",
+			"/Jobs/{jobID}/Cancel",
+			server.CancelJobHandler,
+		},
+		Route{
+			"RetryJob",
+			"POST",
+			"/Jobs/{jobID}/Retry",
+			server.RetryJobHandler,
+		},
+		Route{
+			"Targets",
+			"GET",
+			"/Targets",
+			server.TargetsHandler,
+		},
+		Route{
+			"StopTarget",
+			"DELETE",
+			"/Targets/{targetID}",
+			server.StopTargetHandler,
+		},
+		Route{
+			"PauseTarget",
+			"POST",
+			"/Targets/{targetID}/Pause",
+			server.PauseTargetHandler,
+		},
+		Route{
+			"ResumeTarget",
+			"POST",
+			"/Targets/{targetID}/Resume",
+			server.ResumeTargetHandler,
+		},
+		Route{
+			"Runs",
+			"GET",
+			"/Targets/{targetID}/Runs",
+			server.RunsHandler,
+		},
+		Route{
+			"Status",
+			"GET",
+			"/Runs/{runID}/Status",
+			server.StatusHandler,
+		},
+		Route{
+			"Events",
+			"GET",
+			"/Runs/{runID}/Events",
+			server.EventsHandler,
+		},
 	}
 }
 
@@ -48,12 +138,24 @@ func (server *Server) Index(w http.ResponseWriter, r *http.Request) {
 }
 
 //ExceptionsHandler endpoint retunrs exceptions associated with fuzz target id
+// An optional ?severity=high,security query filters by triaged severity
 func (server *Server) ExceptionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	targetID := vars["targetID"]
 	log.Infof("Target id: %v", targetID)
 
-	results, err := server.Exceptions.GetAll(targetID)
+	severities, err := exception.ParseSeverities(r.URL.Query().Get("severity"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var results []exception.Exception
+	if len(severities) > 0 {
+		results, err = server.Exceptions.GetBySeverity(targetID, severities)
+	} else {
+		results, err = server.Exceptions.GetAll(targetID)
+	}
 	if err != nil {
 		err = fmt.Errorf("error connecting to db: %v", err)
 		http.Error(w, err.Error(), 500)
@@ -63,46 +165,101 @@ func (server *Server) ExceptionsHandler(w http.ResponseWriter, r *http.Request)
 	WriteJSONResponse(results, w)
 }
 
-// FuzzTargetInfo is the return result from FuzzTarget
-type FuzzTargetInfo struct {
-	PodName  string
-	TargetID string
-}
-
-// FuzzTarget is an endpoint to upload metadata about a target and start a fuzz job
-// It returns FuzzTargetInfo on success
-func (server Server) FuzzTarget(w http.ResponseWriter, r *http.Request) {
-	// Get list of containers pushed by user
-	var target Target
-	err := ParseBody(w, r, &target)
+// FuzzTarget is an endpoint to upload metadata about a target and start a fuzz job.
+// The job runs in the background.  It returns the queued Job, whose id can be
+// used to follow its progress.
+func (server *Server) FuzzTarget(w http.ResponseWriter, r *http.Request) {
+	// Get list of containers pushed by user.  The target is validated as
+	// part of the job.
+	target, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
 	if err != nil {
+		err = fmt.Errorf("error reading from body: %v", err)
+		http.Error(w, err.Error(), 500)
 		return
 	}
 
-	// Ensure user provided data is valid
-	err = ValidateTarget(&target)
+	job, err := server.Runner.Submit(target, "")
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		http.Error(w, err.Error(), 503)
 		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+	WriteJSONResponse(job, w)
+}
 
-	// Sanity check that the target is fuzzable
-	pod, err := DryRun(&target)
+// getJob reads a job, writing an error to the response if it can't
+func (server *Server) getJob(w http.ResponseWriter, jobID string) (*Job, bool) {
+	job, err := server.Runner.Jobs.Get(jobID)
 	if err != nil {
+		if errors.Cause(err) == mgo.ErrNotFound {
+			http.Error(w, fmt.Sprintf("no job %s", jobID), 404)
+			return nil, false
+		}
+		err = fmt.Errorf("error connecting to db: %v", err)
 		http.Error(w, err.Error(), 500)
-		return
+		return nil, false
 	}
+	return job, true
+}
 
-	// Launch pod for fuzzing
-	err = Fuzz(pod, &target)
+// JobsHandler lists the most recent jobs
+func (server *Server) JobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := server.Runner.Jobs.GetAll()
 	if err != nil {
+		err = fmt.Errorf("error connecting to db: %v", err)
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	WriteJSONResponse(jobs, w)
+}
 
-	// Return the target id and pod name for querying later on
-	w.WriteHeader(http.StatusOK)
-	info := FuzzTargetInfo{TargetID: pod.ObjectMeta.Labels["TargetID"],
-		PodName: pod.Name}
-	WriteJSONResponse(info, w)
+// JobHandler returns a job with the outcome and logs of each phase
+func (server *Server) JobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := server.getJob(w, mux.Vars(r)["jobID"])
+	if !ok {
+		return
+	}
+	WriteJSONResponse(job, w)
+}
+
+// CancelJobHandler cancels a queued or running job.  Pods it launched are
+// deleted.
+func (server *Server) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobID"]
+	job, ok := server.getJob(w, jobID)
+	if !ok {
+		return
+	}
+	if !server.Runner.Cancel(jobID) {
+		http.Error(w, fmt.Sprintf("job %s is %s", jobID, job.State), 409)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	WriteJSONResponse(job, w)
+}
+
+// RetryJobHandler queues a new job for the target of a failed or canceled
+// job
+func (server *Server) RetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobID"]
+	job, ok := server.getJob(w, jobID)
+	if !ok {
+		return
+	}
+	if job.State != JobFailed && job.State != JobCanceled {
+		http.Error(w, fmt.Sprintf("job %s is %s", jobID, job.State), 409)
+		return
+	}
+
+	retry, err := server.Runner.Submit(job.Target, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	WriteJSONResponse(retry, w)
 }
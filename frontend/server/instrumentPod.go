@@ -4,15 +4,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/mruck/athena/goFuzz/control"
 	"github.com/mruck/athena/lib/log"
 	v1 "k8s.io/api/core/v1"
 )
 
 const resultsPath = "/tmp/results"
 
+// Port the fuzzer serves prometheus metrics on
+const metricsPort = 2112
+
 func buildEnv(targetID string, target *Target) []v1.EnvVar {
-	return []v1.EnvVar{
+	env := []v1.EnvVar{
 		v1.EnvVar{Name: "TARGET_APP_PORT", Value: strconv.Itoa(*target.Port)},
 		v1.EnvVar{Name: "TARGET_DB_HOST", Value: *target.Db.Host},
 		v1.EnvVar{Name: "TARGET_DB_USER", Value: *target.Db.User},
@@ -22,6 +27,10 @@ func buildEnv(targetID string, target *Target) []v1.EnvVar {
 		v1.EnvVar{Name: "TARGET_ID", Value: targetID},
 		v1.EnvVar{Name: "RESULTS_PATH", Value: resultsPath},
 	}
+	if target.GitRef != nil {
+		env = append(env, v1.EnvVar{Name: "GIT_REF", Value: *target.GitRef})
+	}
+	return env
 }
 
 // Generate an Athena Container.
@@ -33,7 +42,17 @@ func buildAthenaContainer(targetID string, target *Target) (*v1.Container, error
 		err := fmt.Errorf("no Athena image provided")
 		return nil, err
 	}
+	profile, err := GetProfile(target)
+	if err != nil {
+		return nil, err
+	}
 	env := buildEnv(targetID, target)
+	// Tell the fuzzer what instrumentation it can read
+	readers := profile.Readers()
+	if len(readers) == 0 {
+		readers = []string{"none"}
+	}
+	env = append(env, v1.EnvVar{Name: "READERS", Value: strings.Join(readers, ",")})
 	var AthenaContainer = v1.Container{
 		Name:  "athena",
 		Image: image,
@@ -56,6 +75,21 @@ func InjectAthenaContainer(pod *v1.Pod, target *Target) error {
 	if err != nil {
 		return err
 	}
+	// Let prometheus scrape the fuzzer
+	athenaContainer.Env = append(athenaContainer.Env, v1.EnvVar{Name: "METRICS_PORT", Value: strconv.Itoa(metricsPort)})
+	athenaContainer.Ports = append(athenaContainer.Ports, v1.ContainerPort{Name: "metrics", ContainerPort: metricsPort})
+	// Only the frontend can pause and stop the fuzzer
+	token, err := newControlToken()
+	if err != nil {
+		return err
+	}
+	athenaContainer.Env = append(athenaContainer.Env, v1.EnvVar{Name: control.TokenEnvVar, Value: token})
+	if pod.ObjectMeta.Annotations == nil {
+		pod.ObjectMeta.Annotations = map[string]string{}
+	}
+	pod.ObjectMeta.Annotations["prometheus.io/scrape"] = "true"
+	pod.ObjectMeta.Annotations["prometheus.io/port"] = strconv.Itoa(metricsPort)
+	mountPostgresLog(pod, athenaContainer)
 	pod.Spec.Containers = append(pod.Spec.Containers, *athenaContainer)
 	return nil
 }
@@ -71,6 +105,7 @@ func InjectSideCar(pod *v1.Pod, target *Target) error {
 	athenaContainer.Name = "sidecar-athena"
 	athenaContainer.Command = []string{"/bin/bash"}
 	athenaContainer.Args = []string{"-c", "while true; do sleep 1000; done"}
+	mountPostgresLog(pod, athenaContainer)
 	pod.Spec.Containers = append(pod.Spec.Containers, *athenaContainer)
 	return nil
 }
@@ -152,23 +187,23 @@ func mountResultsDir(pod *v1.Pod) {
 	pod.Spec.Volumes = append(pod.Spec.Volumes, resultsVolume)
 }
 
-// InstrumentRails mounts our rails in the target container and mounts the
-// results directory.  This is done in memory.
-func InstrumentRails(pod *v1.Pod, target *Target) {
+// Instrument mounts the results directory in the target container and
+// patches the pod with the target's instrumentation profile.  This is done in
+// memory.
+func Instrument(pod *v1.Pod, target *Target) error {
+	profile, err := GetProfile(target)
+	if err != nil {
+		return err
+	}
+
 	// Make this a new pod
 	name := pod.ObjectMeta.Labels["name"]
 	pod.ObjectMeta.Name = NewPodID(name)
 
-	// Mount rails-fork
-	mountRails(pod)
-
 	// Mount results directory for sharing results
 	mountResultsDir(pod)
 
-	// Tell our rails-fork where the target app lives
-	targetContainer := GetTargetContainer(pod.Spec.Containers)
-	targetContainer.Env = append(targetContainer.Env, v1.EnvVar{Name: "TARGET_APP_PATH", Value: *target.AppPath})
-	targetContainer.Env = append(targetContainer.Env, v1.EnvVar{Name: "RAILS_FORK", Value: "1"})
+	return profile.Patch(pod, target)
 }
 
 //MakeFuzzable makes a pod fuzzable by injecting the Athena container
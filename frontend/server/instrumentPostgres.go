@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/sql/postgres"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Volume shared between postgres and athena for the postgres log
+const postgresLogVolume = "postgres-log"
+
+// postgresLogSettings makes postgres log every statement, its duration and
+// any errors as csv to the shared mount, where the fuzzer expects it
+func postgresLogSettings() []string {
+	// With csvlog, postgres swaps the .log suffix for .csv
+	logFile := strings.TrimSuffix(filepath.Base(postgres.LogPath), ".csv") + ".log"
+	return []string{
+		"log_destination=csvlog",
+		"logging_collector=on",
+		"log_directory=" + filepath.Dir(postgres.LogPath),
+		"log_filename=" + logFile,
+		// Readable by athena whichever user it runs as
+		"log_file_mode=0644",
+		"log_statement=all",
+		"log_min_duration_statement=0",
+		"log_min_error_statement=debug5",
+		"log_error_verbosity=verbose",
+	}
+}
+
+// GetDbContainer finds the postgres container, either the one named by
+// Db.Container or the first container running a postgres image
+func GetDbContainer(containers []v1.Container, db *TargetDB) *v1.Container {
+	for i, container := range containers {
+		if db.Container != nil {
+			if container.Name == *db.Container {
+				return &containers[i]
+			}
+			continue
+		}
+		image := container.Image[strings.LastIndex(container.Image, "/")+1:]
+		if strings.HasPrefix(image, "postgres") {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// InstrumentPostgres configures the postgres container to log to a volume
+// shared with athena.  The container isn't ready until the log exists, so
+// the pod doesn't start fuzzing unless postgres is logging.  This is done in
+// memory.
+func InstrumentPostgres(pod *v1.Pod, target *Target) error {
+	dbContainer := GetDbContainer(pod.Spec.Containers, target.Db)
+	if dbContainer == nil {
+		return fmt.Errorf("no postgres container found, name it in db.container")
+	}
+
+	// Make this a new pod
+	name := pod.ObjectMeta.Labels["name"]
+	pod.ObjectMeta.Name = NewPodID(name)
+
+	// The postgres image passes args starting with a flag to postgres, and
+	// later settings override earlier ones
+	for _, setting := range postgresLogSettings() {
+		dbContainer.Args = append(dbContainer.Args, "-c", setting)
+	}
+	dbContainer.VolumeMounts = append(dbContainer.VolumeMounts, v1.VolumeMount{
+		Name:      postgresLogVolume,
+		MountPath: filepath.Dir(postgres.LogPath),
+	})
+	dbContainer.ReadinessProbe = &v1.Probe{
+		Handler: v1.Handler{
+			Exec: &v1.ExecAction{Command: []string{"test", "-f", postgres.LogPath}},
+		},
+		PeriodSeconds: 2,
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: postgresLogVolume,
+		VolumeSource: v1.VolumeSource{
+			EmptyDir: &v1.EmptyDirVolumeSource{},
+		},
+	})
+	return nil
+}
+
+// mountPostgresLog mounts the postgres log in an athena container, if
+// postgres was instrumented
+func mountPostgresLog(pod *v1.Pod, container *v1.Container) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != postgresLogVolume {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+			Name:      postgresLogVolume,
+			MountPath: filepath.Dir(postgres.LogPath),
+		})
+		container.Env = append(container.Env, v1.EnvVar{Name: postgres.LogPathEnvVar, Value: postgres.LogPath})
+		return
+	}
+}
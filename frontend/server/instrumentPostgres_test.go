@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/sql/postgres"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetDbContainer(t *testing.T) {
+	target := testTarget()
+	require.Equal(t, "postgres", GetDbContainer(target.Containers, target.Db).Name)
+
+	containers := []v1.Container{
+		v1.Container{Name: "target", Image: "app"},
+		v1.Container{Name: "db", Image: "gcr.io/athena-fuzzer/postgres:10.5"},
+	}
+	require.Equal(t, "db", GetDbContainer(containers, target.Db).Name)
+
+	// Named containers don't have to run a postgres image
+	name := "target"
+	target.Db.Container = &name
+	require.Equal(t, "target", GetDbContainer(containers, target.Db).Name)
+	missing := "missing"
+	target.Db.Container = &missing
+	require.Nil(t, GetDbContainer(containers, target.Db))
+}
+
+func TestInstrumentPostgres(t *testing.T) {
+	target := testTarget()
+	pod := buildPod(target.Containers, *target.Name)
+	vanilla := pod.ObjectMeta.Name
+	err := InstrumentPostgres(&pod, target)
+	require.NoError(t, err)
+	require.NotEqual(t, vanilla, pod.ObjectMeta.Name)
+
+	db := pod.Spec.Containers[0]
+	require.Equal(t, "-c", db.Args[0])
+	require.Contains(t, db.Args, "log_destination=csvlog")
+	require.Contains(t, db.Args, "log_statement=all")
+	require.Contains(t, db.Args, "log_directory=/var/log/athena/postgres")
+	require.Contains(t, db.Args, "log_filename=postgres.log")
+	require.Equal(t, []v1.VolumeMount{
+		v1.VolumeMount{Name: postgresLogVolume, MountPath: "/var/log/athena/postgres"},
+	}, db.VolumeMounts)
+	require.Equal(t, []string{"test", "-f", postgres.LogPath}, db.ReadinessProbe.Exec.Command)
+	// The target is untouched
+	require.Empty(t, pod.Spec.Containers[1].Args)
+	require.Empty(t, pod.Spec.Containers[1].VolumeMounts)
+
+	// Athena reads the log from the shared mount
+	athena := v1.Container{Name: "athena"}
+	mountPostgresLog(&pod, &athena)
+	require.Equal(t, db.VolumeMounts, athena.VolumeMounts)
+	require.Equal(t, []v1.EnvVar{v1.EnvVar{Name: postgres.LogPathEnvVar, Value: postgres.LogPath}}, athena.Env)
+}
+
+func TestInstrumentPostgresMissing(t *testing.T) {
+	target := testTarget()
+	target.Containers = target.Containers[1:]
+	pod := buildPod(target.Containers, *target.Name)
+	require.Error(t, InstrumentPostgres(&pod, target))
+}
+
+func TestRunPostgresPodNoLog(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodRunning
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			v1.ContainerStatus{Name: "postgres", Ready: false},
+			v1.ContainerStatus{Name: "target", Ready: true},
+		}
+	}
+	target := testTarget()
+	pod := buildPod(target.Containers, *target.Name)
+	err := runPostgresPod(context.Background(), pods, &pod, target)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "postgres never logged to "+postgres.LogPath)
+	require.Equal(t, pods.Created, pods.Deleted)
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mruck/athena/lib/log"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// States of a job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Phases a job goes through to get a target fuzzing, in order
+const (
+	PhaseValidate     = "validate"
+	PhaseVanilla      = "vanilla"
+	PhaseInstrumented = "instrumented"
+	PhasePostgres     = "postgres-instrumented"
+	PhaseFuzzing      = "fuzzing"
+)
+
+var phaseNames = []string{PhaseValidate, PhaseVanilla, PhaseInstrumented, PhasePostgres, PhaseFuzzing}
+
+// Outcomes of a phase
+const (
+	PhasePending   = "pending"
+	PhaseRunning   = "running"
+	PhaseSucceeded = "succeeded"
+	PhaseFailed    = "failed"
+	PhaseSkipped   = "skipped"
+	PhaseCanceled  = "canceled"
+)
+
+// Phase of a job and its outcome
+type Phase struct {
+	Name   string    `bson:"Name"`
+	Status string    `bson:"Status"`
+	Start  time.Time `bson:"Start"`
+	End    time.Time `bson:"End"`
+	Error  string    `bson:"Error,omitempty"`
+	Logs   []string  `bson:"Logs"`
+}
+
+// Job launches a fuzz pod for a target
+type Job struct {
+	JobID string `bson:"JobID"`
+	State string `bson:"State"`
+	// Target as submitted, so the job can be retried.  Kept as json since
+	// the kubernetes types don't round trip through bson.
+	Target []byte   `bson:"Target" json:"-"`
+	Phases []*Phase `bson:"Phases"`
+	// Set once the fuzz pod is launched
+	TargetID string `bson:"TargetID,omitempty"`
+	PodName  string `bson:"PodName,omitempty"`
+	// Job this one retries
+	RetryOf string    `bson:"RetryOf,omitempty"`
+	Created time.Time `bson:"Created"`
+	Updated time.Time `bson:"Updated"`
+}
+
+// NewJob queues a job for a target submitted as json
+func NewJob(target []byte) *Job {
+	job := &Job{
+		JobID:   NewJobID(),
+		State:   JobQueued,
+		Target:  target,
+		Created: time.Now(),
+		Updated: time.Now(),
+	}
+	for _, name := range phaseNames {
+		job.Phases = append(job.Phases, &Phase{Name: name, Status: PhasePending})
+	}
+	return job
+}
+
+// Phase returns the phase with the given name
+func (job *Job) Phase(name string) *Phase {
+	for _, phase := range job.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+	return nil
+}
+
+// Logf logs a message and records it against a phase of the job
+func (job *Job) Logf(name string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Infof("job %s %s: %s", job.JobID, name, msg)
+	phase := job.Phase(name)
+	phase.Logs = append(phase.Logs, msg)
+}
+
+// SkipPending records that the phases the job didn't reach won't run, so
+// they aren't mistaken for ones still to come
+func (job *Job) SkipPending(reason string) {
+	for _, phase := range job.Phases {
+		if phase.Status != PhasePending {
+			continue
+		}
+		phase.Status = PhaseSkipped
+		phase.Start = time.Now()
+		phase.End = phase.Start
+		job.Logf(phase.Name, "skipped: %s", reason)
+	}
+}
+
+// Finished checks if the job is done, one way or another
+func (job *Job) Finished() bool {
+	return job.State == JobSucceeded || job.State == JobFailed || job.State == JobCanceled
+}
+
+// Copy returns a copy of the job sharing nothing with the original
+func (job *Job) Copy() *Job {
+	copied := *job
+	copied.Target = append([]byte{}, job.Target...)
+	copied.Phases = make([]*Phase, len(job.Phases))
+	for i, phase := range job.Phases {
+		copiedPhase := *phase
+		copiedPhase.Logs = append([]string{}, phase.Logs...)
+		copied.Phases[i] = &copiedPhase
+	}
+	return &copied
+}
+
+// JobStore stores jobs.  JobsManager keeps them in mongo and FakeJobStore
+// keeps them in memory for testing.
+type JobStore interface {
+	Save(job *Job) error
+	Get(jobID string) (*Job, error)
+	GetAll() ([]Job, error)
+	FailUnfinished() error
+}
+
+// JobsManager stores jobs in a db
+type JobsManager struct {
+	collection *mgo.Collection
+}
+
+// NewJobsManager takes a connection to a mongo db and connects to the jobs
+// collection
+func NewJobsManager(db *mgo.Database) *JobsManager {
+	return &JobsManager{collection: db.C("jobs")}
+}
+
+// Save writes the job, replacing any earlier copy
+func (manager *JobsManager) Save(job *Job) error {
+	job.Updated = time.Now()
+	_, err := manager.collection.Upsert(bson.M{"JobID": job.JobID}, job)
+	return errors.WithStack(err)
+}
+
+// Get reads a single job by id
+func (manager *JobsManager) Get(jobID string) (*Job, error) {
+	job := &Job{}
+	err := manager.collection.Find(bson.M{"JobID": jobID}).One(job)
+	return job, errors.WithStack(err)
+}
+
+// GetAll returns the most recent jobs, newest first
+func (manager *JobsManager) GetAll() ([]Job, error) {
+	var results []Job
+	err := manager.collection.Find(nil).Sort("-Created").Limit(100).All(&results)
+	return results, errors.WithStack(err)
+}
+
+// FailUnfinished fails every job that was queued or running.  Jobs only run
+// in the frontend process, so these were lost when it restarted.
+func (manager *JobsManager) FailUnfinished() error {
+	var unfinished []Job
+	query := bson.M{"State": bson.M{"$in": []string{JobQueued, JobRunning}}}
+	err := manager.collection.Find(query).All(&unfinished)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for i := range unfinished {
+		job := &unfinished[i]
+		job.State = JobFailed
+		job.SkipPending("the frontend restarted")
+		err = manager.Save(job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
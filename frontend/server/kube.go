@@ -0,0 +1,66 @@
+package server
+
+import (
+	"os"
+
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubePodRunner runs pods on the cluster with client-go
+type KubePodRunner struct {
+	pods corev1.PodInterface
+}
+
+// NewKubePodRunner connects to the cluster in KUBECONFIG, or the one we're
+// running in if unset.  Pods go in POD_NAMESPACE, default if unset.
+func NewKubePodRunner() (*KubePodRunner, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	namespace := util.DefaultEnv("POD_NAMESPACE", "default")
+	return &KubePodRunner{pods: clientset.CoreV1().Pods(namespace)}, nil
+}
+
+// Create launches a pod
+func (runner *KubePodRunner) Create(pod *v1.Pod) error {
+	_, err := runner.pods.Create(pod)
+	return errors.WithStack(err)
+}
+
+// Get reads the current state of a pod
+func (runner *KubePodRunner) Get(name string) (*v1.Pod, error) {
+	pod, err := runner.pods.Get(name, metav1.GetOptions{})
+	return pod, errors.WithStack(err)
+}
+
+// Delete deletes a pod
+func (runner *KubePodRunner) Delete(name string) error {
+	return errors.WithStack(runner.pods.Delete(name, &metav1.DeleteOptions{}))
+}
+
+// List returns the pods matching a label selector
+func (runner *KubePodRunner) List(selector string) ([]v1.Pod, error) {
+	pods, err := runner.pods.List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pods.Items, nil
+}
@@ -1,19 +1,23 @@
 package server
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/mruck/athena/goFuzz/sql/postgres"
 	"github.com/mruck/athena/lib/log"
 	v1 "k8s.io/api/core/v1"
 )
 
 // Run an uninstrumented pod
-func runVanillaPod(target *Target) (*v1.Pod, error) {
+func runVanillaPod(ctx context.Context, pods PodRunner, target *Target) (*v1.Pod, error) {
 	log.Info("\nLaunching vanilla pod")
 	// Generate a vanilla pod with the user provided containers
 	pod := buildPod(target.Containers, *target.Name)
-	defer DeletePod(pod.ObjectMeta.Name)
+	defer DeletePod(pods, pod.ObjectMeta.Name)
 
 	// Sanity check that the uninstrumented target runs
-	err := RunPod(&pod)
+	err := RunPod(ctx, pods, &pod)
 	if err != nil {
 		return nil, err
 	}
@@ -21,15 +25,18 @@ func runVanillaPod(target *Target) (*v1.Pod, error) {
 	return &pod, nil
 }
 
-// Run pod with our rails mounted in
-func runCustomRailsPod(pod *v1.Pod, target *Target) error {
-	log.Info("\nLaunching pod instrumented with rails")
-	// Modifies the pod spec in memory to point to our rails
-	InstrumentRails(pod, target)
-	defer DeletePod(pod.ObjectMeta.Name)
+// Run pod instrumented by the target's profile, i.e. with our rails mounted in
+func runInstrumentedPod(ctx context.Context, pods PodRunner, pod *v1.Pod, target *Target) error {
+	log.Info("\nLaunching instrumented pod")
+	// Modifies the pod spec in memory
+	err := Instrument(pod, target)
+	if err != nil {
+		return err
+	}
+	defer DeletePod(pods, pod.ObjectMeta.Name)
 
-	// Sanity check that the uninstrumented target runs
-	err := RunPod(pod)
+	// Sanity check that the instrumented target runs
+	err = RunPod(ctx, pods, pod)
 	if err != nil {
 		return err
 	}
@@ -37,16 +44,39 @@ func runCustomRailsPod(pod *v1.Pod, target *Target) error {
 	return nil
 }
 
+// Run pod with postgres logging to the shared mount
+func runPostgresPod(ctx context.Context, pods PodRunner, pod *v1.Pod, target *Target) error {
+	log.Info("\nLaunching pod with postgres logging")
+	// Modifies the pod spec in memory to configure postgres logging
+	err := InstrumentPostgres(pod, target)
+	if err != nil {
+		return err
+	}
+	defer DeletePod(pods, pod.ObjectMeta.Name)
+
+	// The postgres container isn't ready until its log appears
+	err = RunPod(ctx, pods, pod)
+	if err != nil {
+		return fmt.Errorf("postgres never logged to %s: %v", postgres.LogPath, err)
+	}
+	return nil
+}
+
 // DryRun sanity checks that our target is fuzzable.
 // If so, it returns a pod for the target.
-func DryRun(target *Target) (*v1.Pod, error) {
+func DryRun(ctx context.Context, pods PodRunner, target *Target) (*v1.Pod, error) {
 	// Run the target as the user provided
-	pod, err := runVanillaPod(target)
+	pod, err := runVanillaPod(ctx, pods, target)
 	if err != nil {
 		return nil, err
 	}
-	// Run the target with our rails-fork
-	err = runCustomRailsPod(pod, target)
+	// Run the target with its instrumentation
+	err = runInstrumentedPod(ctx, pods, pod, target)
+	if err != nil {
+		return nil, err
+	}
+	// Then with postgres logging
+	err = runPostgresPod(ctx, pods, pod, target)
 	if err != nil {
 		return nil, err
 	}
@@ -54,14 +84,19 @@ func DryRun(target *Target) (*v1.Pod, error) {
 }
 
 // Fuzz takes a pod, makes it fuzzable, and launches it.
-// Upon success, it writes the target id to the response
+// Upon success, the pod is labeled with the target id
 // for querying by the client.
-func Fuzz(pod *v1.Pod, target *Target) error {
+func Fuzz(ctx context.Context, pods PodRunner, pod *v1.Pod, target *Target) error {
 	err := MakeFuzzable(pod, target)
 	if err != nil {
 		return err
 	}
 
 	// Launch the pod with the athena container
-	return RunPod(pod)
+	err = RunPod(ctx, pods, pod)
+	// Don't leave a pod fuzzing for a job that was canceled
+	if err != nil && ctx.Err() != nil {
+		DeletePod(pods, pod.ObjectMeta.Name)
+	}
+	return err
 }
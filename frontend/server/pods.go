@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mruck/athena/lib/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// PodRunner creates, inspects and deletes pods.  KubePodRunner talks to the
+// cluster and FakePodRunner keeps pods in memory for testing.
+type PodRunner interface {
+	Create(pod *v1.Pod) error
+	Get(name string) (*v1.Pod, error)
+	Delete(name string) error
+	// List returns the pods matching a label selector, i.e. "TargetID=abc"
+	List(selector string) ([]v1.Pod, error)
+}
+
+// How often to check on a pod, and how long to wait for it to be ready.
+// Variables so tests don't have to wait.
+var (
+	podPollInterval = 5 * time.Second
+	podReadyTimeout = 120 * time.Second
+)
+
+// ContainerState is why a container isn't running
+type ContainerState struct {
+	Name string
+	// "waiting" or "terminated"
+	State    string
+	Reason   string
+	Message  string
+	ExitCode int32
+	Restarts int32
+}
+
+// PodError explains why a pod never became ready
+type PodError struct {
+	Pod    string
+	Reason string
+	Phase  v1.PodPhase
+	// Conditions that aren't true, i.e. PodScheduled
+	Conditions []v1.PodCondition
+	// Init and app containers that aren't running
+	Containers []ContainerState
+}
+
+func (err *PodError) Error() string {
+	parts := []string{fmt.Sprintf("pod %s %s, phase %s", err.Pod, err.Reason, err.Phase)}
+	for _, condition := range err.Conditions {
+		parts = append(parts, fmt.Sprintf("condition %s=%s (%s: %s)", condition.Type,
+			condition.Status, condition.Reason, condition.Message))
+	}
+	for _, container := range err.Containers {
+		msg := fmt.Sprintf("container %s %s (%s", container.Name, container.State, container.Reason)
+		if container.State == "terminated" {
+			msg += fmt.Sprintf(", exit code %d", container.ExitCode)
+		}
+		msg += fmt.Sprintf(", %d restarts)", container.Restarts)
+		if container.Message != "" {
+			msg += ": " + container.Message
+		}
+		parts = append(parts, msg)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// newPodError describes the state of a pod that isn't ready
+func newPodError(pod *v1.Pod, reason string) *PodError {
+	err := &PodError{Pod: pod.ObjectMeta.Name, Reason: reason, Phase: pod.Status.Phase}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			err.Conditions = append(err.Conditions, condition)
+		}
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		state := ContainerState{Name: status.Name, Restarts: status.RestartCount}
+		switch {
+		case status.State.Waiting != nil:
+			state.State = "waiting"
+			state.Reason = status.State.Waiting.Reason
+			state.Message = status.State.Waiting.Message
+		case status.State.Terminated != nil:
+			state.State = "terminated"
+			state.Reason = status.State.Terminated.Reason
+			state.Message = status.State.Terminated.Message
+			state.ExitCode = status.State.Terminated.ExitCode
+		// Crashed before and running again
+		case status.LastTerminationState.Terminated != nil:
+			state.State = "terminated"
+			state.Reason = status.LastTerminationState.Terminated.Reason
+			state.Message = status.LastTerminationState.Terminated.Message
+			state.ExitCode = status.LastTerminationState.Terminated.ExitCode
+		default:
+			continue
+		}
+		err.Containers = append(err.Containers, state)
+	}
+	return err
+}
+
+// Waiting reasons that won't resolve on their own
+var fatalWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// podFailed checks if a pod will never become ready
+func podFailed(pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil && fatalWaitingReasons[status.State.Waiting.Reason] {
+			return true
+		}
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if each container in the pod is ready, i.e.
+// each ContainerStatus.Ready = True in the pod.Status.ContainerStatuses array
+func PodReady(containerStatuses []v1.ContainerStatus) bool {
+	if len(containerStatuses) == 0 {
+		return false
+	}
+	for _, containerStatus := range containerStatuses {
+		log.Infof("Checking %v container...Ready : %v\n", containerStatus.Name, containerStatus.Ready)
+		if containerStatus.Ready != true {
+			return false
+		}
+	}
+	return true
+}
+
+// RunPod launches a pod, then polls until all containers are ready.  If the
+// pod fails or times out, a *PodError describes why.  Polling stops early if
+// ctx is canceled.
+func RunPod(ctx context.Context, pods PodRunner, pod *v1.Pod) error {
+	err := pods.Create(pod)
+	if err != nil {
+		return err
+	}
+	name := pod.ObjectMeta.Name
+
+	timeout := time.NewTimer(podReadyTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			current, err := pods.Get(name)
+			if err != nil {
+				return err
+			}
+			return newPodError(current, "not ready after "+podReadyTimeout.String())
+		case <-time.After(podPollInterval):
+		}
+
+		current, err := pods.Get(name)
+		if err != nil {
+			return err
+		}
+		if PodReady(current.Status.ContainerStatuses) {
+			return nil
+		}
+		if podFailed(current) {
+			return newPodError(current, "failed")
+		}
+	}
+}
+
+// DeletePod deletes a pod and logs any errors
+func DeletePod(pods PodRunner, name string) {
+	err := pods.Delete(name)
+	if err != nil {
+		log.Errorf("Failed to delete pod %s: %v", name, err)
+	}
+}
+
+// GetTargetPod finds the fuzz pod for a target by its TargetID label
+func GetTargetPod(pods PodRunner, targetID string) (*v1.Pod, error) {
+	matches, err := pods.List("TargetID=" + targetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no pod for target %s", targetID)
+	}
+	return &matches[0], nil
+}
+
+// Build a vanilla pod spec.  This pod is uninstrumented/barebones
+// (i.e. no Athena container injected)
+func buildPod(containers []v1.Container, name string) v1.Pod {
+	var pod v1.Pod
+	// Basic initialization
+	pod.APIVersion = "v1"
+	pod.Kind = "Pod"
+	pod.ObjectMeta.Name = NewPodID(name)
+	pod.ObjectMeta.Labels = map[string]string{"name": name}
+	// Add target containers
+	pod.Spec.Containers = containers
+	return pod
+}
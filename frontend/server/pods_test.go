@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func init() {
+	podPollInterval = time.Millisecond
+	podReadyTimeout = 50 * time.Millisecond
+}
+
+func testTarget() *Target {
+	appPath := "/target"
+	name := "app"
+	port := 8080
+	host := "localhost"
+	user := "root"
+	password := "password"
+	dbPort := 5432
+	dbName := "fuzz_db"
+	return &Target{
+		AppPath: &appPath,
+		Name:    &name,
+		Port:    &port,
+		Db:      &TargetDB{User: &user, Password: &password, Host: &host, Port: &dbPort, Name: &dbName},
+		Containers: []v1.Container{
+			v1.Container{Name: "postgres", Image: "postgres:10.5"},
+			v1.Container{Name: "target", Image: "app"},
+		},
+	}
+}
+
+func TestRunPodReady(t *testing.T) {
+	pods := NewFakePodRunner()
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(context.Background(), pods, &pod)
+	require.NoError(t, err)
+	require.Equal(t, []string{pod.ObjectMeta.Name}, pods.Created)
+}
+
+func TestRunPodCreateError(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.CreateErr = errors.New("forbidden")
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(context.Background(), pods, &pod)
+	require.Equal(t, pods.CreateErr, err)
+}
+
+func TestRunPodFailed(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodRunning
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			v1.ContainerStatus{Name: "postgres", Ready: true},
+			v1.ContainerStatus{
+				Name:         "target",
+				RestartCount: 2,
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+					Reason:   "Error",
+					ExitCode: 1,
+				}},
+			},
+		}
+	}
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(context.Background(), pods, &pod)
+	require.Error(t, err)
+	podErr, ok := err.(*PodError)
+	require.True(t, ok)
+	require.Equal(t, "failed", podErr.Reason)
+	require.Equal(t, []ContainerState{
+		ContainerState{Name: "target", State: "terminated", Reason: "Error", ExitCode: 1, Restarts: 2},
+	}, podErr.Containers)
+	require.Contains(t, err.Error(), "container target terminated (Error, exit code 1, 2 restarts)")
+}
+
+func TestRunPodImagePull(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodPending
+		pod.Status.InitContainerStatuses = []v1.ContainerStatus{
+			v1.ContainerStatus{
+				Name: "rails-fork",
+				State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{
+					Reason:  "ImagePullBackOff",
+					Message: "Back-off pulling image",
+				}},
+			},
+		}
+	}
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(context.Background(), pods, &pod)
+	podErr, ok := err.(*PodError)
+	require.True(t, ok)
+	require.Equal(t, "waiting", podErr.Containers[0].State)
+	require.Equal(t, "ImagePullBackOff", podErr.Containers[0].Reason)
+}
+
+func TestRunPodTimeout(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodPending
+		pod.Status.Conditions = []v1.PodCondition{
+			v1.PodCondition{
+				Type:    v1.PodScheduled,
+				Status:  v1.ConditionFalse,
+				Reason:  "Unschedulable",
+				Message: "0/1 nodes are available: 1 Insufficient memory.",
+			},
+		}
+	}
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(context.Background(), pods, &pod)
+	podErr, ok := err.(*PodError)
+	require.True(t, ok)
+	require.Equal(t, v1.PodPending, podErr.Phase)
+	require.Len(t, podErr.Conditions, 1)
+	require.Equal(t, "Unschedulable", podErr.Conditions[0].Reason)
+	require.Contains(t, err.Error(), "not ready after")
+}
+
+func TestRunPodCanceled(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodPending
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pod := buildPod(testTarget().Containers, "app")
+	err := RunPod(ctx, pods, &pod)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestDryRun(t *testing.T) {
+	pods := NewFakePodRunner()
+	target := testTarget()
+	pod, err := DryRun(context.Background(), pods, target)
+	require.NoError(t, err)
+
+	// The vanilla, instrumented and postgres pods are cleaned up
+	require.Len(t, pods.Created, 3)
+	require.Equal(t, pods.Created, pods.Deleted)
+	require.Empty(t, pods.Pods)
+
+	// The returned pod is the fully instrumented one
+	require.Equal(t, pods.Created[2], pod.ObjectMeta.Name)
+	require.Len(t, pod.Spec.InitContainers, 1)
+	require.Equal(t, "rails-fork", pod.Spec.InitContainers[0].Name)
+	require.NotNil(t, pod.Spec.Containers[0].ReadinessProbe)
+}
+
+func TestDryRunVanillaFails(t *testing.T) {
+	pods := NewFakePodRunner()
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodFailed
+	}
+	_, err := DryRun(context.Background(), pods, testTarget())
+	require.Error(t, err)
+	// The instrumented pod is never launched
+	require.Len(t, pods.Created, 1)
+	require.Empty(t, pods.Pods)
+}
+
+func TestFuzz(t *testing.T) {
+	os.Setenv("ATHENA_IMAGE", "athena")
+	defer os.Unsetenv("ATHENA_IMAGE")
+	pods := NewFakePodRunner()
+	target := testTarget()
+	pod, err := DryRun(context.Background(), pods, target)
+	require.NoError(t, err)
+
+	err = Fuzz(context.Background(), pods, pod, target)
+	require.NoError(t, err)
+	targetID := pod.ObjectMeta.Labels["TargetID"]
+	require.NotEmpty(t, targetID)
+
+	// The fuzz pod is left running and can be found by target id
+	found, err := GetTargetPod(pods, targetID)
+	require.NoError(t, err)
+	require.Equal(t, pod.ObjectMeta.Name, found.ObjectMeta.Name)
+	var athena *v1.Container
+	for i, container := range found.Spec.Containers {
+		if container.Name == "athena" {
+			athena = &found.Spec.Containers[i]
+		}
+	}
+	require.NotNil(t, athena)
+	// The fuzzer can read the postgres log
+	require.Contains(t, athena.VolumeMounts, v1.VolumeMount{Name: postgresLogVolume, MountPath: "/var/log/athena/postgres"})
+	// Only the frontend can pause and stop it
+	token, err := controlToken(found)
+	require.NoError(t, err)
+	require.Len(t, token, 32)
+	_, err = controlToken(&v1.Pod{})
+	require.Error(t, err)
+
+	_, err = GetTargetPod(pods, "missing")
+	require.Error(t, err)
+}
+
+func TestFuzzCanceled(t *testing.T) {
+	os.Setenv("ATHENA_IMAGE", "athena")
+	defer os.Unsetenv("ATHENA_IMAGE")
+	pods := NewFakePodRunner()
+	target := testTarget()
+	pod := buildPod(target.Containers, *target.Name)
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodPending
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Fuzz(ctx, pods, &pod, target)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, pods.Created, pods.Deleted)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/coverage"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Names of the instrumentation profiles a target can ask for
+const (
+	ProfileRails   = "rails"
+	ProfileGoCover = "go-cover"
+	ProfileNone    = "none"
+	// Alias for none
+	ProfileBlackBox = "black-box"
+	ProfileCustom   = "custom"
+)
+
+// Instrumentation is the user provided instrumentation for a target.  Every
+// field but Profile is only used by the custom profile.
+type Instrumentation struct {
+	// One of the profiles above, rails if unset
+	Profile string
+	// Added to the pod
+	InitContainers []v1.Container
+	Volumes        []v1.Volume
+	// Added to the target container
+	VolumeMounts []v1.VolumeMount
+	Env          []v1.EnvVar
+	Args         []string
+	// Instrumentation the fuzzer reads after each request, any of
+	// "coverage", "gocover" and "exceptions"
+	Readers []string
+}
+
+// Readers the fuzzer knows how to build, see goFuzz/mutator/readers.go
+var readerNames = []string{"coverage", "gocover", "exceptions", "none"}
+
+func knownReader(name string) bool {
+	for _, known := range readerNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile knows how to instrument a kind of target app and what the fuzzer
+// can read from it
+type Profile interface {
+	Name() string
+	// Patch instruments the target container in the pod spec, in memory
+	Patch(pod *v1.Pod, target *Target) error
+	// Readers the fuzzer should enable, see Instrumentation.Readers
+	Readers() []string
+}
+
+// GetProfile returns the instrumentation profile named by the target, and
+// checks the target has what the profile needs
+func GetProfile(target *Target) (Profile, error) {
+	name := ProfileRails
+	if target.Instrumentation != nil && target.Instrumentation.Profile != "" {
+		name = target.Instrumentation.Profile
+	}
+	switch name {
+	case ProfileRails:
+		if target.AppPath == nil {
+			return nil, fmt.Errorf("error: must specify path to target app")
+		}
+		return RailsProfile{}, nil
+	case ProfileGoCover:
+		return GoCoverProfile{}, nil
+	case ProfileNone, ProfileBlackBox:
+		return BlackBoxProfile{}, nil
+	case ProfileCustom:
+		// Otherwise the fuzz pod would fail to start long after we
+		// accepted the target
+		for _, reader := range target.Instrumentation.Readers {
+			if !knownReader(reader) {
+				return nil, fmt.Errorf("error: unknown reader %q, expected any of %s",
+					reader, strings.Join(readerNames, ", "))
+			}
+		}
+		return CustomProfile{Instrumentation: target.Instrumentation}, nil
+	}
+	return nil, fmt.Errorf("error: unknown instrumentation profile %q, expected one of %s",
+		name, strings.Join([]string{ProfileRails, ProfileGoCover, ProfileNone, ProfileCustom}, ", "))
+}
+
+// RailsProfile swaps in our rails fork, which writes coverage and exceptions
+// to the results directory
+type RailsProfile struct{}
+
+// Name of the profile
+func (RailsProfile) Name() string {
+	return ProfileRails
+}
+
+// Patch mounts our rails in the target container
+func (RailsProfile) Patch(pod *v1.Pod, target *Target) error {
+	mountRails(pod)
+
+	// Tell our rails-fork where the target app lives
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	targetContainer.Env = append(targetContainer.Env, v1.EnvVar{Name: "TARGET_APP_PATH", Value: *target.AppPath})
+	targetContainer.Env = append(targetContainer.Env, v1.EnvVar{Name: "RAILS_FORK", Value: "1"})
+	return nil
+}
+
+// Readers for the coverage json and exceptions written by our rails
+func (RailsProfile) Readers() []string {
+	return []string{"coverage", "exceptions"}
+}
+
+// GoCoverProfile is for Go apps built with -cover.  The app writes its
+// counters to GOCOVERDIR, and is expected to convert them to a text profile
+// at COVERAGE_PROFILE after each request.
+type GoCoverProfile struct{}
+
+// Name of the profile
+func (GoCoverProfile) Name() string {
+	return ProfileGoCover
+}
+
+// Patch tells the target where to write coverage
+func (GoCoverProfile) Patch(pod *v1.Pod, target *Target) error {
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	targetContainer.Env = append(targetContainer.Env,
+		v1.EnvVar{Name: "GOCOVERDIR", Value: resultsPath + "/gocover"},
+		v1.EnvVar{Name: "COVERAGE_PROFILE", Value: coverage.GoProfilePath})
+	return nil
+}
+
+// Readers for the cover profile
+func (GoCoverProfile) Readers() []string {
+	return []string{"gocover"}
+}
+
+// BlackBoxProfile leaves the target alone.  The fuzzer only sees responses
+// and the postgres log.
+type BlackBoxProfile struct{}
+
+// Name of the profile
+func (BlackBoxProfile) Name() string {
+	return ProfileNone
+}
+
+// Patch does nothing
+func (BlackBoxProfile) Patch(pod *v1.Pod, target *Target) error {
+	return nil
+}
+
+// Readers is empty, there's nothing to read
+func (BlackBoxProfile) Readers() []string {
+	return nil
+}
+
+// CustomProfile patches the pod with whatever the user provided
+type CustomProfile struct {
+	*Instrumentation
+}
+
+// Name of the profile
+func (CustomProfile) Name() string {
+	return ProfileCustom
+}
+
+// Patch adds the user provided init containers and volumes to the pod, and
+// the volume mounts, env and args to the target container
+func (profile CustomProfile) Patch(pod *v1.Pod, target *Target) error {
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, profile.InitContainers...)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, profile.Volumes...)
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	targetContainer.VolumeMounts = append(targetContainer.VolumeMounts, profile.VolumeMounts...)
+	targetContainer.Env = append(targetContainer.Env, profile.Env...)
+	targetContainer.Args = append(targetContainer.Args, profile.Args...)
+	return nil
+}
+
+// Readers the user asked for
+func (profile CustomProfile) Readers() []string {
+	return profile.Instrumentation.Readers
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetProfile(t *testing.T) {
+	target := testTarget()
+	profile, err := GetProfile(target)
+	require.NoError(t, err)
+	require.Equal(t, ProfileRails, profile.Name())
+
+	// Only rails needs the app path
+	target.AppPath = nil
+	_, err = GetProfile(target)
+	require.Error(t, err)
+	target.Instrumentation = &Instrumentation{Profile: ProfileBlackBox}
+	profile, err = GetProfile(target)
+	require.NoError(t, err)
+	require.Equal(t, ProfileNone, profile.Name())
+	require.NoError(t, ValidateTarget(target))
+
+	target.Instrumentation.Profile = "java"
+	_, err = GetProfile(target)
+	require.Error(t, err)
+	require.Error(t, ValidateTarget(target))
+
+	// Custom readers are checked before the fuzzer ever sees them
+	target.Instrumentation = &Instrumentation{Profile: ProfileCustom, Readers: []string{"exceptions", "gocover"}}
+	require.NoError(t, ValidateTarget(target))
+	target.Instrumentation.Readers = []string{"jacoco"}
+	_, err = GetProfile(target)
+	require.Error(t, err)
+	require.Error(t, ValidateTarget(target))
+}
+
+// instrumented patches a pod for the target with the given profile
+func instrumented(t *testing.T, instrumentation *Instrumentation) *v1.Pod {
+	target := testTarget()
+	target.Instrumentation = instrumentation
+	pod := buildPod(target.Containers, *target.Name)
+	err := Instrument(&pod, target)
+	require.NoError(t, err)
+	return &pod
+}
+
+func TestInstrumentRails(t *testing.T) {
+	pod := instrumented(t, nil)
+	require.Equal(t, "rails-fork", pod.Spec.InitContainers[0].Name)
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	require.Contains(t, targetContainer.Env, v1.EnvVar{Name: "RAILS_FORK", Value: "1"})
+	require.Contains(t, targetContainer.Env, v1.EnvVar{Name: "TARGET_APP_PATH", Value: "/target"})
+}
+
+func TestInstrumentGoCover(t *testing.T) {
+	pod := instrumented(t, &Instrumentation{Profile: ProfileGoCover})
+	require.Empty(t, pod.Spec.InitContainers)
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	require.Contains(t, targetContainer.Env, v1.EnvVar{Name: "COVERAGE_PROFILE", Value: "/tmp/results/coverage.out"})
+	// The results directory is mounted for every profile
+	require.Contains(t, targetContainer.VolumeMounts, v1.VolumeMount{Name: "results-dir", MountPath: "/tmp/results"})
+}
+
+func TestInstrumentBlackBox(t *testing.T) {
+	pod := instrumented(t, &Instrumentation{Profile: ProfileNone})
+	require.Empty(t, pod.Spec.InitContainers)
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	require.Equal(t, []v1.EnvVar{v1.EnvVar{Name: "RESULTS_PATH", Value: resultsPath}}, targetContainer.Env)
+}
+
+func TestInstrumentCustom(t *testing.T) {
+	agent := v1.Container{Name: "agent", Image: "agent"}
+	volume := v1.Volume{Name: "agent", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}
+	mount := v1.VolumeMount{Name: "agent", MountPath: "/agent"}
+	env := v1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/agent/agent.jar"}
+	pod := instrumented(t, &Instrumentation{
+		Profile:        ProfileCustom,
+		InitContainers: []v1.Container{agent},
+		Volumes:        []v1.Volume{volume},
+		VolumeMounts:   []v1.VolumeMount{mount},
+		Env:            []v1.EnvVar{env},
+		Args:           []string{"--debug"},
+		Readers:        []string{"exceptions"},
+	})
+	require.Equal(t, []v1.Container{agent}, pod.Spec.InitContainers)
+	require.Contains(t, pod.Spec.Volumes, volume)
+	targetContainer := GetTargetContainer(pod.Spec.Containers)
+	require.Contains(t, targetContainer.VolumeMounts, mount)
+	require.Contains(t, targetContainer.Env, env)
+	require.Equal(t, []string{"--debug"}, targetContainer.Args)
+}
+
+func TestAthenaReaders(t *testing.T) {
+	os.Setenv("ATHENA_IMAGE", "athena")
+	defer os.Unsetenv("ATHENA_IMAGE")
+	readers := func(instrumentation *Instrumentation) v1.EnvVar {
+		target := testTarget()
+		target.Instrumentation = instrumentation
+		athena, err := buildAthenaContainer("target-id", target)
+		require.NoError(t, err)
+		for _, env := range athena.Env {
+			if env.Name == "READERS" {
+				return env
+			}
+		}
+		t.Fatal("READERS not set")
+		return v1.EnvVar{}
+	}
+	require.Equal(t, "coverage,exceptions", readers(nil).Value)
+	require.Equal(t, "gocover", readers(&Instrumentation{Profile: ProfileGoCover}).Value)
+	require.Equal(t, "none", readers(&Instrumentation{Profile: ProfileNone}).Value)
+	require.Equal(t, "none", readers(&Instrumentation{Profile: ProfileCustom}).Value)
+}
@@ -18,11 +18,19 @@ type Routes []Route
 
 func NewRouter() (*mux.Router, error) {
 	db := database.MustGetDatabase(database.MongoDbPort, "athena")
-	server, err := NewServer(db)
+	pods, err := NewKubePodRunner()
 	if err != nil {
 		return nil, err
 	}
+	server, err := NewServer(db, pods)
+	if err != nil {
+		return nil, err
+	}
+	return server.router(), nil
+}
 
+// router routes requests to the server's handlers
+func (server *Server) router() *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
 	routes := server.getRoutes()
 	for _, route := range routes {
@@ -32,5 +40,5 @@ func NewRouter() (*mux.Router, error) {
 			Name(route.Name).
 			Handler(route.HandlerFunc)
 	}
-	return router, nil
+	return router
 }
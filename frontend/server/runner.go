@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/mruck/athena/lib/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Jobs waiting for a worker beyond this are rejected
+const maxQueued = 100
+
+// queuedJob is a job waiting for a worker
+type queuedJob struct {
+	ctx context.Context
+	job *Job
+}
+
+// JobRunner runs fuzz jobs in the background, a few at a time
+type JobRunner struct {
+	Jobs  JobStore
+	Pods  PodRunner
+	queue chan queuedJob
+	// Cancels each queued or running job
+	lock    sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// NewJobRunner starts workers that run jobs as they are submitted.  Jobs only
+// run in this process, so any left unfinished by an earlier one were lost and
+// are failed.
+func NewJobRunner(jobs JobStore, pods PodRunner, workers int) (*JobRunner, error) {
+	err := jobs.FailUnfinished()
+	if err != nil {
+		return nil, err
+	}
+	runner := &JobRunner{
+		Jobs:    jobs,
+		Pods:    pods,
+		queue:   make(chan queuedJob, maxQueued),
+		cancels: map[string]context.CancelFunc{},
+	}
+	for i := 0; i < workers; i++ {
+		go runner.work()
+	}
+	return runner, nil
+}
+
+// Submit queues a job for a target submitted as json.  RetryOf is the job
+// being retried, if any.
+func (runner *JobRunner) Submit(target []byte, retryOf string) (*Job, error) {
+	job := NewJob(target)
+	job.RetryOf = retryOf
+	err := runner.Jobs.Save(job)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.lock.Lock()
+	runner.cancels[job.JobID] = cancel
+	runner.lock.Unlock()
+
+	// The worker gets its own copy, since the caller reads the one returned
+	select {
+	case runner.queue <- queuedJob{ctx: ctx, job: job.Copy()}:
+		return job, nil
+	default:
+		runner.done(job.JobID)
+		job.State = JobFailed
+		job.SkipPending("too many queued jobs")
+		_ = runner.Jobs.Save(job)
+		return nil, fmt.Errorf("too many queued jobs, try again later")
+	}
+}
+
+// Cancel stops a queued or running job.  It returns false if the job isn't
+// queued or running.
+func (runner *JobRunner) Cancel(jobID string) bool {
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	cancel, ok := runner.cancels[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// done forgets about a job that is no longer queued or running
+func (runner *JobRunner) done(jobID string) {
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	if cancel, ok := runner.cancels[jobID]; ok {
+		cancel()
+		delete(runner.cancels, jobID)
+	}
+}
+
+// save stores the job, logging any errors since there's no one to return
+// them to
+func (runner *JobRunner) save(job *Job) {
+	err := runner.Jobs.Save(job)
+	if err != nil {
+		log.Errorf("failed to save job %s: %+v", job.JobID, err)
+	}
+}
+
+func (runner *JobRunner) work() {
+	for queued := range runner.queue {
+		runner.run(queued.ctx, queued.job)
+	}
+}
+
+// run takes a job through each phase and records the outcome.  A panic fails
+// the job rather than taking down the worker.
+func (runner *JobRunner) run(ctx context.Context, job *Job) {
+	defer runner.done(job.JobID)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("job %s panicked: %v\n%s", job.JobID, r, debug.Stack())
+			job.State = JobFailed
+			job.SkipPending("the job panicked")
+			runner.save(job)
+		}
+	}()
+
+	job.State = JobRunning
+	runner.save(job)
+	err := runner.execute(ctx, job)
+	switch {
+	case ctx.Err() != nil:
+		job.State = JobCanceled
+		job.SkipPending("the job was canceled")
+	case err != nil:
+		job.State = JobFailed
+		job.SkipPending("an earlier phase failed")
+		log.Errorf("job %s failed: %v", job.JobID, err)
+	default:
+		job.State = JobSucceeded
+	}
+	runner.save(job)
+}
+
+// phase runs a single phase of a job, recording its outcome
+func (runner *JobRunner) phase(ctx context.Context, job *Job, name string, fn func() error) error {
+	phase := job.Phase(name)
+	phase.Start = time.Now()
+	if ctx.Err() != nil {
+		phase.Status = PhaseCanceled
+		phase.End = phase.Start
+		runner.save(job)
+		return ctx.Err()
+	}
+	phase.Status = PhaseRunning
+	runner.save(job)
+
+	err := fn()
+	phase.End = time.Now()
+	switch {
+	case err != nil && ctx.Err() != nil:
+		phase.Status = PhaseCanceled
+		phase.Error = err.Error()
+	case err != nil:
+		phase.Status = PhaseFailed
+		phase.Error = err.Error()
+	default:
+		phase.Status = PhaseSucceeded
+	}
+	runner.save(job)
+	return err
+}
+
+// execute runs the phases of a job in order, stopping at the first failure
+func (runner *JobRunner) execute(ctx context.Context, job *Job) error {
+	var target Target
+	err := runner.phase(ctx, job, PhaseValidate, func() error {
+		err := json.Unmarshal(job.Target, &target)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling target: %v", err)
+		}
+		return ValidateTarget(&target)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sanity check that the target runs as the user provided it
+	var pod *v1.Pod
+	err = runner.phase(ctx, job, PhaseVanilla, func() error {
+		pod, err = runVanillaPod(ctx, runner.Pods, &target)
+		if err == nil {
+			job.Logf(PhaseVanilla, "pod %s ready", pod.ObjectMeta.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Then with the target's instrumentation profile
+	err = runner.phase(ctx, job, PhaseInstrumented, func() error {
+		err := runInstrumentedPod(ctx, runner.Pods, pod, &target)
+		if err == nil {
+			job.Logf(PhaseInstrumented, "pod %s ready", pod.ObjectMeta.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Then with postgres logging to the shared mount
+	err = runner.phase(ctx, job, PhasePostgres, func() error {
+		err := runPostgresPod(ctx, runner.Pods, pod, &target)
+		if err == nil {
+			job.Logf(PhasePostgres, "pod %s ready", pod.ObjectMeta.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Launch pod for fuzzing
+	return runner.phase(ctx, job, PhaseFuzzing, func() error {
+		err := Fuzz(ctx, runner.Pods, pod, &target)
+		job.TargetID = pod.ObjectMeta.Labels["TargetID"]
+		job.PodName = pod.ObjectMeta.Name
+		if err == nil {
+			job.Logf(PhaseFuzzing, "pod %s fuzzing target %s", job.PodName, job.TargetID)
+		}
+		return err
+	})
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+// testTargetJSON returns a valid target as submitted by the user
+func testTargetJSON(t *testing.T) []byte {
+	target, err := json.Marshal(testTarget())
+	require.NoError(t, err)
+	return target
+}
+
+// waitForJob waits for a job to finish and returns it
+func waitForJob(t *testing.T, jobs JobStore, jobID string) *Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobs.Get(jobID)
+		require.NoError(t, err)
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s never finished", jobID)
+	return nil
+}
+
+func TestRunJob(t *testing.T) {
+	os.Setenv("ATHENA_IMAGE", "athena")
+	defer os.Unsetenv("ATHENA_IMAGE")
+	jobs := NewFakeJobStore()
+	runner, err := NewJobRunner(jobs, NewFakePodRunner(), 1)
+	require.NoError(t, err)
+
+	job, err := runner.Submit(testTargetJSON(t), "")
+	require.NoError(t, err)
+	// The worker runs its own copy, so reading the returned job is safe
+	require.Equal(t, JobQueued, job.State)
+	require.Equal(t, PhasePending, job.Phase(PhaseValidate).Status)
+
+	finished := waitForJob(t, jobs, job.JobID)
+	require.Equal(t, JobSucceeded, finished.State)
+	for _, phase := range finished.Phases {
+		require.Equal(t, PhaseSucceeded, phase.Status, phase.Name)
+	}
+	require.NotEmpty(t, finished.TargetID)
+	require.NotEmpty(t, finished.PodName)
+	require.False(t, runner.Cancel(job.JobID))
+}
+
+func TestRunJobInvalid(t *testing.T) {
+	jobs := NewFakeJobStore()
+	runner, err := NewJobRunner(jobs, NewFakePodRunner(), 1)
+	require.NoError(t, err)
+
+	job, err := runner.Submit([]byte(`{"Name": "app"}`), "")
+	require.NoError(t, err)
+	finished := waitForJob(t, jobs, job.JobID)
+	require.Equal(t, JobFailed, finished.State)
+	require.Equal(t, PhaseFailed, finished.Phase(PhaseValidate).Status)
+	require.NotEmpty(t, finished.Phase(PhaseValidate).Error)
+	// Phases it didn't reach are skipped rather than left pending
+	for _, name := range []string{PhaseVanilla, PhaseInstrumented, PhasePostgres, PhaseFuzzing} {
+		require.Equal(t, PhaseSkipped, finished.Phase(name).Status, name)
+	}
+}
+
+func TestRunJobPanics(t *testing.T) {
+	jobs := NewFakeJobStore()
+	pods := &panicPodRunner{NewFakePodRunner()}
+	runner, err := NewJobRunner(jobs, pods, 1)
+	require.NoError(t, err)
+
+	// The job fails and the worker keeps going
+	for i := 0; i < 2; i++ {
+		job, err := runner.Submit(testTargetJSON(t), "")
+		require.NoError(t, err)
+		require.Equal(t, JobFailed, waitForJob(t, jobs, job.JobID).State)
+	}
+}
+
+// panicPodRunner panics creating pods
+type panicPodRunner struct {
+	*FakePodRunner
+}
+
+func (pods *panicPodRunner) Create(pod *v1.Pod) error {
+	panic("create")
+}
+
+func TestCancelJob(t *testing.T) {
+	jobs := NewFakeJobStore()
+	pods := NewFakePodRunner()
+	created := make(chan struct{}, 1)
+	pods.OnCreate = func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodPending
+		created <- struct{}{}
+	}
+	timeout := podReadyTimeout
+	podReadyTimeout = 5 * time.Second
+	defer func() { podReadyTimeout = timeout }()
+	runner, err := NewJobRunner(jobs, pods, 1)
+	require.NoError(t, err)
+
+	// Canceled while waiting on the vanilla pod
+	job, err := runner.Submit(testTargetJSON(t), "")
+	require.NoError(t, err)
+	<-created
+	require.True(t, runner.Cancel(job.JobID))
+	finished := waitForJob(t, jobs, job.JobID)
+	require.Equal(t, JobCanceled, finished.State)
+	require.Equal(t, PhaseCanceled, finished.Phase(PhaseVanilla).Status)
+	require.Equal(t, PhaseSkipped, finished.Phase(PhaseFuzzing).Status)
+	require.Equal(t, pods.Created, pods.Deleted)
+	require.False(t, runner.Cancel(job.JobID))
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	jobs := NewFakeJobStore()
+	// No workers, so jobs stay queued until they're canceled
+	runner, err := NewJobRunner(jobs, NewFakePodRunner(), 0)
+	require.NoError(t, err)
+	job, err := runner.Submit(testTargetJSON(t), "")
+	require.NoError(t, err)
+	require.True(t, runner.Cancel(job.JobID))
+
+	// The job is canceled as soon as a worker picks it up
+	go runner.work()
+	finished := waitForJob(t, jobs, job.JobID)
+	require.Equal(t, JobCanceled, finished.State)
+	require.Equal(t, PhaseCanceled, finished.Phase(PhaseValidate).Status)
+}
+
+func TestQueueFull(t *testing.T) {
+	jobs := NewFakeJobStore()
+	runner, err := NewJobRunner(jobs, NewFakePodRunner(), 0)
+	require.NoError(t, err)
+	for i := 0; i < maxQueued; i++ {
+		_, err := runner.Submit(testTargetJSON(t), "")
+		require.NoError(t, err)
+	}
+	job, err := runner.Submit(testTargetJSON(t), "")
+	require.Error(t, err)
+	require.Nil(t, job)
+
+	// The rejected job is recorded as failed
+	all, err := jobs.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, maxQueued+1)
+	failed := 0
+	for _, job := range all {
+		if job.State == JobFailed {
+			failed++
+			require.Equal(t, PhaseSkipped, job.Phase(PhaseValidate).Status)
+		}
+	}
+	require.Equal(t, 1, failed)
+}
+
+func TestFailUnfinished(t *testing.T) {
+	jobs := NewFakeJobStore()
+	states := []string{JobQueued, JobRunning, JobSucceeded, JobCanceled}
+	ids := map[string]string{}
+	for _, state := range states {
+		job := NewJob(nil)
+		job.State = state
+		require.NoError(t, jobs.Save(job))
+		ids[state] = job.JobID
+	}
+
+	// Jobs left by an earlier frontend are failed on start
+	_, err := NewJobRunner(jobs, NewFakePodRunner(), 0)
+	require.NoError(t, err)
+	expected := map[string]string{
+		JobQueued:    JobFailed,
+		JobRunning:   JobFailed,
+		JobSucceeded: JobSucceeded,
+		JobCanceled:  JobCanceled,
+	}
+	for state, jobID := range ids {
+		job, err := jobs.Get(jobID)
+		require.NoError(t, err)
+		require.Equal(t, expected[state], job.State, state)
+	}
+	queued, err := jobs.Get(ids[JobQueued])
+	require.NoError(t, err)
+	require.Equal(t, PhaseSkipped, queued.Phase(PhaseValidate).Status)
+}
+
+// testServer returns a server with a runner that has no workers
+func testServer(t *testing.T) (*Server, *FakeJobStore) {
+	jobs := NewFakeJobStore()
+	pods := NewFakePodRunner()
+	runner, err := NewJobRunner(jobs, pods, 0)
+	require.NoError(t, err)
+	return &Server{Pods: pods, Runner: runner}, jobs
+}
+
+// post sends a request to the server and decodes the job in the response
+func post(t *testing.T, server *Server, path string, body []byte) (int, *Job) {
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router().ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		return w.Code, nil
+	}
+	job := &Job{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), job))
+	return w.Code, job
+}
+
+func TestFuzzTargetHandler(t *testing.T) {
+	server, _ := testServer(t)
+	for i := 0; i < maxQueued; i++ {
+		code, job := post(t, server, "/FuzzTarget", testTargetJSON(t))
+		require.Equal(t, http.StatusAccepted, code)
+		require.Equal(t, JobQueued, job.State)
+	}
+	// Too many queued jobs
+	code, _ := post(t, server, "/FuzzTarget", testTargetJSON(t))
+	require.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestCancelJobHandler(t *testing.T) {
+	server, jobs := testServer(t)
+	_, job := post(t, server, "/FuzzTarget", testTargetJSON(t))
+
+	code, _ := post(t, server, "/Jobs/"+job.JobID+"/Cancel", nil)
+	require.Equal(t, http.StatusAccepted, code)
+	go server.Runner.work()
+	require.Equal(t, JobCanceled, waitForJob(t, jobs, job.JobID).State)
+
+	// Already finished
+	code, _ = post(t, server, "/Jobs/"+job.JobID+"/Cancel", nil)
+	require.Equal(t, http.StatusConflict, code)
+
+	code, _ = post(t, server, "/Jobs/missing/Cancel", nil)
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRetryJobHandler(t *testing.T) {
+	server, jobs := testServer(t)
+	target := testTargetJSON(t)
+	_, job := post(t, server, "/FuzzTarget", target)
+
+	// Still queued
+	code, _ := post(t, server, "/Jobs/"+job.JobID+"/Retry", nil)
+	require.Equal(t, http.StatusConflict, code)
+
+	server.Runner.Cancel(job.JobID)
+	go server.Runner.work()
+	waitForJob(t, jobs, job.JobID)
+
+	code, retry := post(t, server, "/Jobs/"+job.JobID+"/Retry", nil)
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, job.JobID, retry.RetryOf)
+	require.NotEqual(t, job.JobID, retry.JobID)
+	stored, err := jobs.Get(retry.JobID)
+	require.NoError(t, err)
+	require.Equal(t, target, stored.Target)
+
+	code, _ = post(t, server, "/Jobs/missing/Retry", nil)
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+// How often the event stream checks for a new status
+const pollInterval = time.Second
+
+// TargetInfo summarizes a fuzzed target
+type TargetInfo struct {
+	TargetID string
+	Runs     int
+	// Status of the most recent run, if it published one
+	Latest *run.Status
+}
+
+// TargetsHandler lists every target that has been fuzzed
+func (server *Server) TargetsHandler(w http.ResponseWriter, r *http.Request) {
+	targetIDs, err := server.Runs.Targets()
+	if err != nil {
+		err = fmt.Errorf("error connecting to db: %v", err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	targets := []TargetInfo{}
+	for _, targetID := range targetIDs {
+		runs, err := server.Runs.List(targetID)
+		if err != nil {
+			err = fmt.Errorf("error connecting to db: %v", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		info := TargetInfo{TargetID: targetID, Runs: len(runs)}
+		if len(runs) > 0 {
+			status, err := server.Runs.GetStatus(runs[len(runs)-1].RunID)
+			if err == nil {
+				info.Latest = status
+			}
+		}
+		targets = append(targets, info)
+	}
+	WriteJSONResponse(targets, w)
+}
+
+// RunsHandler lists the runs against a target, oldest first
+func (server *Server) RunsHandler(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["targetID"]
+	runs, err := server.Runs.List(targetID)
+	if err != nil {
+		err = fmt.Errorf("error connecting to db: %v", err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if runs == nil {
+		runs = []run.Run{}
+	}
+	WriteJSONResponse(runs, w)
+}
+
+// getStatus reads the status of a run, writing an error to the response if
+// it can't
+func (server *Server) getStatus(w http.ResponseWriter, runID string) (*run.Status, bool) {
+	status, err := server.Runs.GetStatus(runID)
+	if err != nil {
+		if errors.Cause(err) == mgo.ErrNotFound {
+			http.Error(w, fmt.Sprintf("no status for run %s", runID), 404)
+			return nil, false
+		}
+		err = fmt.Errorf("error connecting to db: %v", err)
+		http.Error(w, err.Error(), 500)
+		return nil, false
+	}
+	return status, true
+}
+
+// StatusHandler returns the most recently published status of a run
+func (server *Server) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := server.getStatus(w, mux.Vars(r)["runID"])
+	if !ok {
+		return
+	}
+	WriteJSONResponse(status, w)
+}
+
+// EventsHandler streams the status of a run as server-sent events.  An event
+// is sent whenever the fuzzer publishes a new status, and the stream ends
+// once the run finishes or the fuzzer stops publishing.
+func (server *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["runID"]
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", 500)
+		return
+	}
+	status, ok := server.getStatus(w, runID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var sent time.Time
+	for {
+		if status.Updated.After(sent) {
+			data, err := json.Marshal(status)
+			if err != nil {
+				log.Errorf("%+v", err)
+				return
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+			sent = status.Updated
+		}
+		if status.Done() {
+			return
+		}
+		if status.Stale() {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", "no status since "+status.Updated.Format(time.RFC3339))
+			flusher.Flush()
+			return
+		}
+
+		select {
+		// The client went away
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		latest, err := server.Runs.GetStatus(runID)
+		if err != nil {
+			log.Errorf("%+v", err)
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+		status = latest
+	}
+}
@@ -13,11 +13,14 @@ type TargetDB struct {
 	Host     *string
 	Port     *int
 	Name     *string
+	// Optional name of the postgres container, otherwise the first container
+	// running a postgres image
+	Container *string
 }
 
 // Target is the expected form of user input
 type Target struct {
-	// Path to target application
+	// Path to target application, required by the rails profile
 	AppPath *string
 	// Name of the target application
 	Name *string
@@ -25,14 +28,16 @@ type Target struct {
 	Port       *int
 	Db         *TargetDB
 	Containers []v1.Container
+	// Optional git ref of the target app, recorded with each run so runs can
+	// be compared across versions
+	GitRef *string
+	// How to instrument the target app, rails if unset
+	Instrumentation *Instrumentation
 }
 
 // ValidateTarget checks user provided input.  We make all values in Target and TargetDB
 // be pointers because that's the only way to validate them
 func ValidateTarget(target *Target) error {
-	if target.AppPath == nil {
-		return fmt.Errorf("error: must specify path to target app")
-	}
 	if target.Name == nil {
 		return fmt.Errorf("error: must specify target name")
 	}
@@ -61,10 +66,16 @@ func ValidateTarget(target *Target) error {
 		return fmt.Errorf("error: must specify db name")
 	}
 	// Ensure the list of containers provided includes a container named "target".
-	// This is where rails-fork lives, and also the target application source code
-	// for instrumenting.
+	// This is the container instrumented by the target's profile.
 	if GetTargetContainer(target.Containers) == nil {
 		return fmt.Errorf("Please provide a container named \"target\"")
 	}
+	if GetDbContainer(target.Containers, target.Db) == nil {
+		return fmt.Errorf("error: no postgres container found, name it in db.container")
+	}
+	_, err := GetProfile(target)
+	if err != nil {
+		return err
+	}
 	return nil
 }
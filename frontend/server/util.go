@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os/exec"
 
 	"github.com/google/uuid"
 )
@@ -22,23 +21,6 @@ func NewPodID(name string) string {
 	return name + "-pod-" + uuid.New().String()[:8]
 }
 
-// Capture stdout/stderr of exec.Command. If it errors, wrap the error
-// with stdout/stderr.  Otherwise, return stdout/stderr.
-func ExecWrapper(proc *exec.Cmd) ([]byte, error) {
-	stdoutStderr, err := proc.CombinedOutput()
-	if err != nil {
-		err = fmt.Errorf("Command run: %s\n\nStdout/stderr:  %v\nerror: %v",
-			proc.Args, string(stdoutStderr), err)
-		return stdoutStderr, err
-	}
-	if proc.ProcessState.ExitCode() != 0 {
-		err = fmt.Errorf("Command run: %s\n\nStdout/stderr:  %v\nexit code: %v",
-			proc.Args, string(stdoutStderr), proc.ProcessState.ExitCode())
-		return stdoutStderr, err
-	}
-	return stdoutStderr, nil
-}
-
 // ParseBody reads from request and marshal into opaque struct
 func ParseBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	b, err := ioutil.ReadAll(r.Body)
@@ -72,3 +54,8 @@ func WriteJSONResponse(input interface{}, w http.ResponseWriter) {
 		return
 	}
 }
+
+// NewJobID returns a uuid for a fuzz job
+func NewJobID() string {
+	return "job-" + uuid.New().String()[:8]
+}
@@ -0,0 +1,136 @@
+package canary
+
+// Listener is an http server embedded in the fuzzer that records every
+// request it receives.  Detectors send URLs pointing at the listener
+// containing a unique token, and if the target ever requests one of those
+// URLs we know which injected value made it do so.
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+)
+
+// The fuzzer runs in the same pod as the target, so by default the target
+// can reach us on localhost
+const defaultHost = "localhost"
+const defaultPort = "8889"
+
+// Every token starts with this prefix so we can find them in requests
+const tokenPrefix = "athc"
+
+var tokenRe = regexp.MustCompile(tokenPrefix + `[0-9a-f]{12}`)
+
+// Hit is a request received by the listener
+type Hit struct {
+	Token      string    `bson:"Token"`
+	Method     string    `bson:"Method"`
+	URL        string    `bson:"URL"`
+	RemoteAddr string    `bson:"RemoteAddr"`
+	UserAgent  string    `bson:"UserAgent"`
+	Time       time.Time `bson:"Time"`
+}
+
+// Listener records requests containing a token
+type Listener struct {
+	Host string
+	Port string
+
+	server *http.Server
+	mutex  sync.Mutex
+	// Every hit received, in order
+	hits []Hit
+}
+
+// New allocates a listener on CANARY_HOST:CANARY_PORT.  CANARY_HOST is the
+// address the target uses to reach the fuzzer.
+func New() *Listener {
+	return &Listener{
+		Host: util.DefaultEnv("CANARY_HOST", defaultHost),
+		Port: util.DefaultEnv("CANARY_PORT", defaultPort),
+	}
+}
+
+// NewToken returns a unique string to embed in a callback
+func NewToken() string {
+	return tokenPrefix + strings.Replace(uuid.New().String(), "-", "", -1)[:12]
+}
+
+// Start listens on all interfaces and serves in the background
+func (listener *Listener) Start() error {
+	sock, err := net.Listen("tcp", ":"+listener.Port)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// We may have asked for any free port
+	_, port, err := net.SplitHostPort(sock.Addr().String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	listener.Port = port
+	listener.server = &http.Server{Handler: listener}
+	go func() {
+		err := listener.server.Serve(sock)
+		if err != http.ErrServerClosed {
+			log.Errorf("canary listener died: %+v", errors.WithStack(err))
+		}
+	}()
+	log.Infof("Canary listener on %s", listener.Addr())
+	return nil
+}
+
+// Close stops the listener
+func (listener *Listener) Close() error {
+	if listener.server == nil {
+		return nil
+	}
+	return errors.WithStack(listener.server.Close())
+}
+
+// Addr returns host:port the target can reach the listener on
+func (listener *Listener) Addr() string {
+	return net.JoinHostPort(listener.Host, listener.Port)
+}
+
+// URL returns a callback url for the token
+func (listener *Listener) URL(token string) string {
+	return fmt.Sprintf("http://%s/%s", listener.Addr(), token)
+}
+
+// ServeHTTP records requests with a token anywhere in the url
+func (listener *Listener) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token := tokenRe.FindString(req.URL.String())
+	if token != "" {
+		listener.mutex.Lock()
+		listener.hits = append(listener.hits, Hit{
+			Token:      token,
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			RemoteAddr: req.RemoteAddr,
+			UserAgent:  req.UserAgent(),
+			Time:       time.Now(),
+		})
+		listener.mutex.Unlock()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Hits returns the requests received after the first offset hits.  Each
+// consumer keeps track of its own offset.
+func (listener *Listener) Hits(offset int) []Hit {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if offset >= len(listener.hits) {
+		return nil
+	}
+	return append([]Hit{}, listener.hits[offset:]...)
+}
@@ -0,0 +1,33 @@
+package canary
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener(t *testing.T) {
+	listener := &Listener{Host: "localhost", Port: "0"}
+	require.NoError(t, listener.Start())
+	defer listener.Close()
+	require.NotEqual(t, "0", listener.Port)
+
+	token := NewToken()
+	require.Regexp(t, tokenRe, token)
+
+	// Requests without a token are ignored
+	resp, err := http.Get("http://" + listener.Addr() + "/favicon.ico")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Empty(t, listener.Hits(0))
+
+	resp, err = http.Get(listener.URL(token) + "?a=b")
+	require.NoError(t, err)
+	resp.Body.Close()
+	hits := listener.Hits(0)
+	require.Len(t, hits, 1)
+	require.Equal(t, token, hits[0].Token)
+	require.Equal(t, "GET", hits[0].Method)
+	require.Empty(t, listener.Hits(1))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mruck/athena/lib/database"
+	"github.com/mruck/athena/lib/run"
+	"github.com/mruck/athena/lib/util"
+)
+
+// resolveRun finds a run by id, falling back to the latest run at a git ref
+func resolveRun(runs *run.RunsManager, targetID string, name string) *run.Run {
+	r, err := runs.Get(name)
+	if err == nil {
+		return r
+	}
+	r, err = runs.LatestAt(targetID, name)
+	util.Must(err == nil, "no run or git ref %q for target %s: %v", name, targetID, err)
+	return r
+}
+
+// describe names a run by its id and git ref
+func describe(r *run.Run) string {
+	if r.GitRef == "" {
+		return r.RunID
+	}
+	return fmt.Sprintf("%s (%s)", r.RunID, r.GitRef)
+}
+
+// finished returns the runs that ran to completion, dropping any still
+// running or that crashed before saving their end
+func finished(all []run.Run) []run.Run {
+	done := []run.Run{}
+	for _, r := range all {
+		if !r.End.IsZero() {
+			done = append(done, r)
+		}
+	}
+	return done
+}
+
+// compareMain diffs two runs against a target.  Runs are given by id or git
+// ref, and default to the two most recent finished runs.  Exits with status 1
+// if the head run regressed.
+func compareMain(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	targetID := flags.String("target", os.Getenv("TARGET_ID"), "target id the runs are against")
+	tolerance := flags.Float64("tolerance", 0.5, "coverage drop in percentage points to ignore")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: goFuzz compare [flags] [base [head]]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	util.Must(*targetID != "", "no target id, pass -target or set TARGET_ID")
+	util.Must(flags.NArg() <= 2, "expected at most a base and head run")
+
+	db := database.MustGetDatabase(database.MongoDbPort, "athena")
+	runs := run.NewRunsManager(db)
+	all, err := runs.GetAll(*targetID)
+	util.Must(err == nil, "%+v", err)
+	all = finished(all)
+
+	var base, head *run.Run
+	switch flags.NArg() {
+	case 0:
+		util.Must(len(all) >= 2, "need at least two finished runs for target %s", *targetID)
+		base, head = &all[len(all)-2], &all[len(all)-1]
+	case 1:
+		util.Must(len(all) >= 1, "no finished runs for target %s", *targetID)
+		base, head = resolveRun(runs, *targetID, flags.Arg(0)), &all[len(all)-1]
+	case 2:
+		base, head = resolveRun(runs, *targetID, flags.Arg(0)), resolveRun(runs, *targetID, flags.Arg(1))
+	}
+
+	comparison := run.Compare(base, head, *tolerance)
+	fmt.Printf("base: %s\nhead: %s\n", describe(base), describe(head))
+	if comparison.SpecChanged {
+		fmt.Println("warning: the runs fuzzed different swagger specs")
+	}
+	fmt.Printf("coverage: %.2f%% -> %.2f%% (%+.2f)", base.Coverage, head.Coverage, comparison.CoverageDelta)
+	if comparison.CoverageRegressed {
+		fmt.Print(" REGRESSED")
+	}
+	fmt.Printf("\nrequests: %d -> %d\n\n", base.Requests, head.Requests)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANGE\tROUTE\tBASE FAILURES\tHEAD FAILURES")
+	for _, change := range comparison.NewlyFailing {
+		fmt.Fprintf(w, "failing\t%s %s\t%d/%d\t%d/%d\n", change.Method, change.Path,
+			change.BaseFailures, change.BaseRequests, change.HeadFailures, change.HeadRequests)
+	}
+	for _, change := range comparison.Recovered {
+		fmt.Fprintf(w, "recovered\t%s %s\t%d/%d\t%d/%d\n", change.Method, change.Path,
+			change.BaseFailures, change.BaseRequests, change.HeadFailures, change.HeadRequests)
+	}
+	w.Flush()
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANGE\tKIND\tROUTE\tMESSAGE")
+	for _, found := range comparison.NewFindings {
+		fmt.Fprintf(w, "new\t%s\t%s %s\t%s\n", found.Kind, found.Method, found.Path, found.Message)
+	}
+	for _, found := range comparison.FixedFindings {
+		fmt.Fprintf(w, "fixed\t%s\t%s %s\t%s\n", found.Kind, found.Method, found.Path, found.Message)
+	}
+	for _, found := range comparison.UntestedFindings {
+		fmt.Fprintf(w, "untested\t%s\t%s %s\t%s\n", found.Kind, found.Method, found.Path, found.Message)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d newly failing routes, %d recovered, %d new findings, %d fixed, %d untested\n",
+		len(comparison.NewlyFailing), len(comparison.Recovered), len(comparison.NewFindings),
+		len(comparison.FixedFindings), len(comparison.UntestedFindings))
+	if comparison.Regressed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,140 @@
+package control
+
+// The fuzzer can be paused, resumed and stopped while it runs, either over
+// http by the frontend or by signals sent when the pod is deleted.  The fuzz
+// loop checks in between requests, so stopping lets it store the run summary
+// and findings before exiting.  Requests over http must carry the token the
+// frontend put in the pod's environment, since the port is also open to
+// prometheus.
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions accepted on /control/<action>
+const (
+	Pause  = "pause"
+	Resume = "resume"
+	Stop   = "stop"
+)
+
+// TokenEnvVar holds the token control requests must carry
+const TokenEnvVar = "CONTROL_TOKEN"
+
+// TokenHeader is the header control requests carry the token in
+const TokenHeader = "X-Control-Token"
+
+// Controller tracks whether the fuzzer should keep going
+type Controller struct {
+	// Token http requests must carry.  Empty rejects all of them.
+	token   string
+	lock    sync.Mutex
+	changed *sync.Cond
+	paused  bool
+	stopped bool
+}
+
+// New returns a controller for a running fuzzer that accepts http requests
+// carrying token
+func New(token string) *Controller {
+	controller := &Controller{token: token}
+	controller.changed = sync.NewCond(&controller.lock)
+	return controller
+}
+
+// Pause the fuzzer before its next request
+func (controller *Controller) Pause() {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	controller.paused = true
+	controller.changed.Broadcast()
+}
+
+// Resume a paused fuzzer
+func (controller *Controller) Resume() {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	controller.paused = false
+	controller.changed.Broadcast()
+}
+
+// Stop the fuzzer before its next request, even if it's paused
+func (controller *Controller) Stop() {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	controller.stopped = true
+	controller.changed.Broadcast()
+}
+
+// Paused checks if the fuzzer was paused
+func (controller *Controller) Paused() bool {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	return controller.paused && !controller.stopped
+}
+
+// Stopped checks if the fuzzer was stopped
+func (controller *Controller) Stopped() bool {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	return controller.stopped
+}
+
+// Wait blocks while the fuzzer is paused.  It returns false if the fuzzer
+// should stop.
+func (controller *Controller) Wait() bool {
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	for controller.paused && !controller.stopped {
+		controller.changed.Wait()
+	}
+	return !controller.stopped
+}
+
+// WaitFor blocks while the fuzzer is paused, for at most timeout.  It returns
+// false if the fuzzer should stop.
+func (controller *Controller) WaitFor(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		controller.lock.Lock()
+		defer controller.lock.Unlock()
+		controller.changed.Broadcast()
+	})
+	defer timer.Stop()
+
+	controller.lock.Lock()
+	defer controller.lock.Unlock()
+	for controller.paused && !controller.stopped && time.Now().Before(deadline) {
+		controller.changed.Wait()
+	}
+	return !controller.stopped
+}
+
+// ServeHTTP handles POST /control/pause, /control/resume and /control/stop
+func (controller *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(TokenHeader)
+	if controller.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(controller.token)) != 1 {
+		http.Error(w, "bad control token", http.StatusUnauthorized)
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, "/control/") {
+	case Pause:
+		controller.Pause()
+	case Resume:
+		controller.Resume()
+	case Stop:
+		controller.Stop()
+	default:
+		http.Error(w, "unknown action, expected pause, resume or stop", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWait(t *testing.T) {
+	controller := New("token")
+	require.True(t, controller.Wait())
+
+	controller.Pause()
+	require.True(t, controller.Paused())
+	resumed := make(chan bool)
+	go func() {
+		resumed <- controller.Wait()
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("Wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	controller.Resume()
+	require.True(t, <-resumed)
+
+	// Stopping wakes up a paused fuzzer
+	controller.Pause()
+	go func() {
+		resumed <- controller.Wait()
+	}()
+	controller.Stop()
+	require.False(t, <-resumed)
+	require.True(t, controller.Stopped())
+	require.False(t, controller.Paused())
+}
+
+func TestWaitFor(t *testing.T) {
+	controller := New("token")
+	controller.Pause()
+	start := time.Now()
+	require.True(t, controller.WaitFor(20*time.Millisecond))
+	require.True(t, time.Since(start) >= 20*time.Millisecond)
+	require.True(t, controller.Paused())
+
+	controller.Stop()
+	require.False(t, controller.WaitFor(time.Hour))
+}
+
+func TestServeHTTP(t *testing.T) {
+	controller := New("token")
+	token := "token"
+	send := func(method string, action string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/control/"+action, nil)
+		req.Header.Set(TokenHeader, token)
+		controller.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusNoContent, send("POST", Pause))
+	require.True(t, controller.Paused())
+	require.Equal(t, http.StatusNoContent, send("POST", Resume))
+	require.False(t, controller.Paused())
+	require.Equal(t, http.StatusMethodNotAllowed, send("GET", Stop))
+	require.False(t, controller.Stopped())
+	require.Equal(t, http.StatusNotFound, send("POST", "restart"))
+
+	// Requests without the token are rejected
+	token = "wrong"
+	require.Equal(t, http.StatusUnauthorized, send("POST", Stop))
+	token = ""
+	require.Equal(t, http.StatusUnauthorized, send("POST", Stop))
+	require.False(t, controller.Stopped())
+
+	// As is everything if the fuzzer wasn't given a token
+	controller = New("")
+	require.Equal(t, http.StatusUnauthorized, send("POST", Pause))
+	require.False(t, controller.Paused())
+
+	controller = New("token")
+	token = "token"
+	require.Equal(t, http.StatusNoContent, send("POST", Stop))
+	require.True(t, controller.Stopped())
+}
@@ -1,12 +1,21 @@
 package coverage
 
 import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/mruck/athena/lib/util"
 	"github.com/pkg/errors"
 )
 
 const Path = "/tmp/results/coverage.json"
 
+// GoProfilePath is where Go targets write a cover profile in text format,
+// i.e. the output of `go tool covdata textfmt`
+const GoProfilePath = "/tmp/results/coverage.out"
+
 // Coverage contains metadata abouta  coverage object
 type Coverage struct {
 	// Total amount of coverage across all requests as a percentage
@@ -16,16 +25,27 @@ type Coverage struct {
 	// New coverage received from most recent request as a map
 	//DeltaMap map[string][]*int
 	FilePath string
+	// FilePath is a Go cover profile rather than json
+	goProfile bool
 	// Cumulative mapping of filepath to number of times lines
 	// are hit.  Update after every request.
 	Map map[string][]int
 }
 
-// New returns a coverage object that reads from coveragePath
+// New returns a coverage object that reads from coveragePath.  If the path
+// is the empty string, no coverage is read and it stays at 0.
 func New(coveragePath string) *Coverage {
 	return &Coverage{Cumulative: 0, Delta: 0, FilePath: coveragePath, Map: make(map[string][]int)}
 }
 
+// NewGoProfile returns a coverage object that reads a Go cover profile from
+// profilePath
+func NewGoProfile(profilePath string) *Coverage {
+	coverage := New(profilePath)
+	coverage.goProfile = true
+	return coverage
+}
+
 // updateMap updates the cumulative coverage map with the most recent request's
 // coverage and keeps track of the delta coverage in a map
 func (coverage *Coverage) updateMap(newCoverage map[string][]int) map[string][]int {
@@ -41,6 +61,13 @@ func (coverage *Coverage) updateMap(newCoverage map[string][]int) map[string][]i
 			continue
 		}
 
+		// The file grew, i.e. a Go profile with blocks we hadn't seen.  The
+		// new lines are unreachable until we're told otherwise.
+		for len(oldLineCount) < len(newLineCount) {
+			oldLineCount = append(oldLineCount, -1)
+		}
+		coverage.Map[newFilename] = oldLineCount
+
 		// Allocate an array for keeping track of delta line counts
 		deltaLineCount := make([]int, len(oldLineCount))
 		for i := range newLineCount {
@@ -50,13 +77,17 @@ func (coverage *Coverage) updateMap(newCoverage map[string][]int) map[string][]i
 				continue
 			}
 			// This is new coverage, add to the delta
-			if oldLineCount[i] == 0 && newLineCount[i] > 0 {
+			if oldLineCount[i] <= 0 && newLineCount[i] > 0 {
 				deltaLineCount[i] = newLineCount[i]
 			} else {
 				// Nothing new for this line
 				deltaLineCount[i] = 0
 
 			}
+			// The line was unreachable in an earlier read
+			if oldLineCount[i] < 0 {
+				oldLineCount[i] = 0
+			}
 			oldLineCount[i] += newLineCount[i]
 		}
 
@@ -80,6 +111,10 @@ func calculateCoveragePercentage(coverage map[string][]int) float64 {
 			}
 		}
 	}
+	// Nothing reported yet
+	if runnableLines == 0 {
+		return 0
+	}
 	return float64(linesRun) / float64(runnableLines) * 100
 }
 
@@ -114,11 +149,88 @@ func (coverage *Coverage) Read() (map[string][]int, error) {
 	return sanitized, nil
 }
 
+// ReadGoProfile reads a Go cover profile and converts it to the same form
+// as Read.  Each block of statements in the profile looks like:
+// "file.go:startLine.startCol,endLine.endCol numStmts count"
+// Lines outside of any block are unreachable.  The profile is missing until
+// the target writes it, which counts as no coverage.
+func (coverage *Coverage) ReadGoProfile() (map[string][]int, error) {
+	file, err := os.Open(coverage.FilePath)
+	if os.IsNotExist(err) {
+		return map[string][]int{}, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close()
+
+	lines := map[string][]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		filename, start, end, count, err := parseGoBlock(line)
+		if err != nil {
+			return nil, err
+		}
+		// Grow the file, marking new lines unreachable
+		for len(lines[filename]) < end {
+			lines[filename] = append(lines[filename], -1)
+		}
+		for i := start - 1; i < end; i++ {
+			if lines[filename][i] < count {
+				lines[filename][i] = count
+			}
+		}
+	}
+	return lines, errors.WithStack(scanner.Err())
+}
+
+// parseGoBlock parses a block of a Go cover profile into the file, the first
+// and last line and the count
+func parseGoBlock(line string) (string, int, int, int, error) {
+	colon := strings.LastIndex(line, ":")
+	fields := strings.Fields(line[colon+1:])
+	if colon < 0 || len(fields) != 3 {
+		return "", 0, 0, 0, errors.Errorf("bad cover profile line %q", line)
+	}
+	positions := strings.Split(fields[0], ",")
+	if len(positions) != 2 {
+		return "", 0, 0, 0, errors.Errorf("bad cover profile line %q", line)
+	}
+	start, err := strconv.Atoi(strings.Split(positions[0], ".")[0])
+	if err != nil {
+		return "", 0, 0, 0, errors.WithStack(err)
+	}
+	end, err := strconv.Atoi(strings.Split(positions[1], ".")[0])
+	if err != nil {
+		return "", 0, 0, 0, errors.WithStack(err)
+	}
+	count, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, 0, 0, errors.WithStack(err)
+	}
+	if start < 1 || end < start {
+		return "", 0, 0, 0, errors.Errorf("bad cover profile line %q", line)
+	}
+	return line[:colon], start, end, count, nil
+}
+
 // Update reads from the coverage file and updates delta and cumulative
 // coverage values
 func (coverage *Coverage) Update() error {
+	// Coverage isn't collected for this target
+	if coverage.FilePath == "" {
+		return nil
+	}
 	// Read coverage
-	newCov, err := coverage.Read()
+	read := coverage.Read
+	if coverage.goProfile {
+		read = coverage.ReadGoProfile
+	}
+	newCov, err := read()
 	if err != nil {
 		return err
 	}
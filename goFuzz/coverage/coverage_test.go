@@ -2,6 +2,8 @@ package coverage
 
 import (
 	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/mruck/athena/lib/util"
@@ -50,3 +52,79 @@ func readCoverageInner(t *testing.T, file1 string, file2 string) {
 	require.True(t, coverage.Delta > oldDelta)
 	require.True(t, coverage.Cumulative > oldCumulative)
 }
+
+func TestReadGoProfile(t *testing.T) {
+	tmp, err := ioutil.TempFile("/tmp", "cov-")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+
+	coverage := NewGoProfile(tmp.Name())
+	profile := `mode: set
+app/handlers.go:3.20,5.2 2 1
+app/handlers.go:7.20,9.2 2 0
+app/db.go:2.10,2.30 1 0
+`
+	err = ioutil.WriteFile(tmp.Name(), []byte(profile), 0644)
+	require.NoError(t, err)
+	lines, err := coverage.ReadGoProfile()
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int{
+		"app/handlers.go": []int{-1, -1, 1, 1, 1, -1, 0, 0, 0},
+		"app/db.go":       []int{-1, 0},
+	}, lines)
+
+	err = coverage.Update()
+	require.NoError(t, err)
+	require.InDelta(t, 300.0/7, coverage.Cumulative, 0.01)
+
+	// The second handler is hit
+	profile = strings.Replace(profile, "9.2 2 0", "9.2 2 1", 1)
+	err = ioutil.WriteFile(tmp.Name(), []byte(profile), 0644)
+	require.NoError(t, err)
+	err = coverage.Update()
+	require.NoError(t, err)
+	require.InDelta(t, 600.0/7, coverage.Cumulative, 0.01)
+	require.True(t, coverage.Delta > 0)
+
+	_, _, _, _, err = parseGoBlock("app/db.go:2.10 1 0")
+	require.Error(t, err)
+}
+
+func TestReadGoProfileMissing(t *testing.T) {
+	coverage := NewGoProfile("/tmp/missing-cover-profile.out")
+	err := coverage.Update()
+	require.NoError(t, err)
+	require.Equal(t, 0.0, coverage.Cumulative)
+	require.Equal(t, 0.0, coverage.Delta)
+}
+
+func TestNoCoverage(t *testing.T) {
+	coverage := New("")
+	err := coverage.Update()
+	require.NoError(t, err)
+	require.Equal(t, 0.0, coverage.Cumulative)
+}
+
+func TestReadCoverageGrows(t *testing.T) {
+	tmp, err := ioutil.TempFile("/tmp", "cov-")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	coverage := New(tmp.Name())
+
+	require.NoError(t, ioutil.WriteFile(tmp.Name(), []byte(`{"app.rb": [1, 0]}`), 0644))
+	require.NoError(t, coverage.Update())
+	require.Equal(t, 50.0, coverage.Cumulative)
+
+	// The second read knows about more lines than the first
+	require.NoError(t, ioutil.WriteFile(tmp.Name(), []byte(`{"app.rb": [0, 0, 1, null]}`), 0644))
+	require.NoError(t, coverage.Update())
+	require.Equal(t, []int{1, 0, 1, -1}, coverage.Map["app.rb"])
+	require.InDelta(t, 100.0/3, coverage.Delta, 0.001)
+	require.InDelta(t, 200.0/3, coverage.Cumulative, 0.001)
+
+	// And a shorter read leaves the rest alone
+	require.NoError(t, ioutil.WriteFile(tmp.Name(), []byte(`{"app.rb": [0, 2]}`), 0644))
+	require.NoError(t, coverage.Update())
+	require.Equal(t, []int{1, 2, 1, -1}, coverage.Map["app.rb"])
+	require.Equal(t, 100.0, coverage.Cumulative)
+}
@@ -0,0 +1,245 @@
+package authz
+
+// Authorization differential testing.  Every request that succeeds for the
+// identity driving the fuzzer is replayed as each identity with the same or
+// lower privilege.  A replay that succeeds and returns data belonging to the
+// original identity is an IDOR (same privilege) or privilege escalation (lower
+// privilege).  State changing requests are also flagged when a less privileged
+// identity gets back the same response, since there's no data to look for.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of finding reported by this detector
+const (
+	KindIDOR      = "idor"
+	KindPrivilege = "privilege-escalation"
+)
+
+// Stop replaying a route as an identity after this many successful requests
+const maxReplays = 10
+
+// Fraction of JSON keys two responses must share to be considered the same
+// response
+const similarityThreshold = 0.8
+
+// Detector for broken access control
+type Detector struct {
+	// Clients for every identity, including the one driving the fuzzer
+	clients []*httpclient.Client
+	// Number of replays keyed by identity, method and path
+	replays map[string]int
+}
+
+// New returns an authorization detector replaying requests with the given
+// clients
+func New(clients []*httpclient.Client) *Detector {
+	return &Detector{
+		clients: clients,
+		replays: map[string]int{},
+	}
+}
+
+// Inject is a no-op, we replay requests as they are
+func (authz *Detector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+// Reset is a no-op, nothing is injected
+func (authz *Detector) Reset() {}
+
+func success(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// Check replays a successful request as every other identity with the same
+// or lower privilege
+func (authz *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	findings := []*finding.Finding{}
+	primary := result.Client.Identity
+	if primary == nil || !success(result.Response.StatusCode) {
+		return findings, nil
+	}
+
+	for _, client := range authz.clients {
+		other := client.Identity
+		if other == nil || other.Name == primary.Name || other.Privilege > primary.Privilege {
+			continue
+		}
+		key := other.Name + " " + result.Route.Method + " " + result.Route.Path
+		if authz.replays[key] >= maxReplays {
+			continue
+		}
+		authz.replays[key]++
+
+		req, err := replay(result)
+		if err != nil {
+			return findings, err
+		}
+		// One identity failing shouldn't stop us replaying as the rest
+		resp, body, err := detector.Send(client, req)
+		if err != nil {
+			log.Warnf("replaying as %s failed: %+v", other.Name, err)
+			continue
+		}
+		if !success(resp.StatusCode) {
+			continue
+		}
+		msg := violation(result.Route.Method, primary, other, result.Body, body)
+		if msg == "" {
+			continue
+		}
+
+		kind := KindPrivilege
+		if other.Privilege == primary.Privilege {
+			kind = KindIDOR
+		}
+		flagged := result.NewFinding(kind, other.Name, msg)
+		if client.CurlCmd != nil {
+			flagged.Curl = client.CurlCmd.String()
+		}
+		flagged.Details = bson.M{
+			"Identity":         other.Name,
+			"Privilege":        other.Privilege,
+			"OriginalIdentity": primary.Name,
+			"OriginalCurl":     result.Curl,
+			"Status":           resp.StatusCode,
+		}
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
+
+// Verify replays the reproducer, already sent by the original identity, as the
+// identity the finding was reported for
+func (authz *Detector) Verify(found *finding.Finding, result *detector.Result) (bool, error) {
+	name, _ := found.Details["Identity"].(string)
+	primary := result.Client.Identity
+	if primary == nil || !success(result.Response.StatusCode) {
+		return false, nil
+	}
+	for _, client := range authz.clients {
+		other := client.Identity
+		if other == nil || other.Name != name {
+			continue
+		}
+		req, err := replay(result)
+		if err != nil {
+			return false, err
+		}
+		resp, body, err := detector.Send(client, req)
+		if err != nil {
+			return false, err
+		}
+		if !success(resp.StatusCode) {
+			return false, nil
+		}
+		return violation(result.Route.Method, primary, other, result.Body, body) != "", nil
+	}
+	// We don't know who to replay as
+	return false, detector.ErrUnverifiable
+}
+
+// replay copies the most recent request.  Cookies are left to the cookie jar
+// of the client sending the copy.
+func replay(result *detector.Result) (*http.Request, error) {
+	orig := result.Request
+	req, err := http.NewRequest(orig.Method, orig.URL.String(), bytes.NewReader(result.RequestBody))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for name, values := range orig.Header {
+		if name == "Cookie" {
+			continue
+		}
+		req.Header[name] = append([]string{}, values...)
+	}
+	return req, nil
+}
+
+// violation returns a description of why a successful replay as other is an
+// access control violation, or the empty string if it isn't
+func violation(method string, primary *httpclient.Identity, other *httpclient.Identity,
+	original []byte, replayed []byte) string {
+	// The replay leaked data that only the original identity should see
+	leaked := []string{}
+	for _, marker := range primary.Markers {
+		if marker != "" && bytes.Contains(original, []byte(marker)) &&
+			bytes.Contains(replayed, []byte(marker)) {
+			leaked = append(leaked, marker)
+		}
+	}
+	if len(leaked) > 0 {
+		return fmt.Sprintf("response to %s contains data belonging to %s: %s",
+			other.Name, primary.Name, strings.Join(leaked, ", "))
+	}
+
+	// A less privileged identity did the same thing as the original
+	if method != "GET" && other.Privilege < primary.Privilege && similar(original, replayed) {
+		return fmt.Sprintf("%s request by %s succeeded for less privileged %s",
+			method, primary.Name, other.Name)
+	}
+	return ""
+}
+
+// similar checks if two responses look like the same response.  JSON
+// responses are compared on their keys, since values such as timestamps and
+// ids change between requests.
+func similar(body1 []byte, body2 []byte) bool {
+	if bytes.Equal(body1, body2) {
+		return true
+	}
+	var obj1, obj2 interface{}
+	if json.Unmarshal(body1, &obj1) == nil && json.Unmarshal(body2, &obj2) == nil {
+		keys1 := keys(obj1, "", map[string]bool{})
+		keys2 := keys(obj2, "", map[string]bool{})
+		union := len(keys1)
+		shared := 0
+		for key := range keys2 {
+			if keys1[key] {
+				shared++
+			} else {
+				union++
+			}
+		}
+		if union == 0 {
+			return true
+		}
+		return float64(shared)/float64(union) >= similarityThreshold
+	}
+	// Not json, fall back to comparing lengths
+	len1, len2 := float64(len(body1)), float64(len(body2))
+	if len1 > len2 {
+		len1, len2 = len2, len1
+	}
+	return len1/len2 >= similarityThreshold
+}
+
+// keys flattens obj into the set of paths to its keys
+func keys(obj interface{}, prefix string, acc map[string]bool) map[string]bool {
+	switch typed := obj.(type) {
+	case map[string]interface{}:
+		for name, value := range typed {
+			path := prefix + "." + name
+			acc[path] = true
+			keys(value, path, acc)
+		}
+	case []interface{}:
+		for _, elem := range typed {
+			keys(elem, prefix+"[]", acc)
+		}
+	}
+	return acc
+}
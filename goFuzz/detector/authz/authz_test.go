@@ -0,0 +1,124 @@
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/stretchr/testify/require"
+)
+
+var admin = &httpclient.Identity{Name: "admin", Privilege: 2, Markers: []string{"admin@example.com"}}
+var user = &httpclient.Identity{Name: "user", Privilege: 1, Markers: []string{"user@example.com"}}
+var anonymous = &httpclient.Identity{Name: "anonymous"}
+
+func TestSimilar(t *testing.T) {
+	require.True(t, similar([]byte(""), []byte("")))
+	require.True(t, similar([]byte(`{"id": 1, "user": {"name": "a"}}`), []byte(`{"id": 2, "user": {"name": "b"}}`)))
+	require.False(t, similar([]byte(`{"id": 1, "user": {"name": "a"}}`), []byte(`{"errors": ["forbidden"]}`)))
+	require.True(t, similar([]byte("<html>aaaa</html>"), []byte("<html>bbbb</html>")))
+	require.False(t, similar([]byte("<html>aaaa</html>"), []byte("<html></html>")))
+}
+
+func TestViolation(t *testing.T) {
+	original := []byte(`{"email": "admin@example.com"}`)
+	// Public data
+	require.Empty(t, violation("GET", admin, anonymous, []byte(`{"posts": []}`), []byte(`{"posts": []}`)))
+	// Leaked data
+	require.NotEmpty(t, violation("GET", admin, anonymous, original, original))
+	require.NotEmpty(t, violation("GET", admin, user, original, original))
+	// State changing request
+	require.NotEmpty(t, violation("DELETE", admin, user, []byte(""), []byte("")))
+	require.Empty(t, violation("DELETE", admin, user, []byte(`{"success": "OK"}`), []byte(`{"errors": []}`)))
+	// Peers doing the same thing to their own data
+	require.Empty(t, violation("DELETE", user, &httpclient.Identity{Name: "user2", Privilege: 1}, []byte(""), []byte("")))
+}
+
+func TestCheck(t *testing.T) {
+	// Every user can read the admin's profile
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"email": "admin@example.com"}`)
+	}))
+	defer ts.Close()
+	url, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	clients := []*httpclient.Client{}
+	for _, identity := range []*httpclient.Identity{admin, user, anonymous} {
+		client, err := httpclient.NewAs(url, identity)
+		require.NoError(t, err)
+		clients = append(clients, client)
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+"/users/admin.json", nil)
+	require.NoError(t, err)
+	resp, body, err := detector.Send(clients[0], req)
+	require.NoError(t, err)
+
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/users/{username}.json"},
+		Request:  req,
+		Response: resp,
+		Body:     body,
+		Client:   clients[0],
+	}
+	authz := New(clients)
+	findings, err := authz.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	require.Equal(t, KindPrivilege, findings[0].Kind)
+	require.Equal(t, "user", findings[0].Param)
+	require.Equal(t, "anonymous", findings[1].Param)
+
+	// The data doesn't belong to the user, so anonymous seeing it is fine
+	result.Client = clients[1]
+	findings, err = authz.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
+
+func TestCheckSendError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"email": "admin@example.com"}`)
+	}))
+	defer ts.Close()
+	up, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	// Nothing is listening here
+	down, err := url.Parse("http://127.0.0.1:1")
+	require.NoError(t, err)
+
+	clients := []*httpclient.Client{}
+	for i, identity := range []*httpclient.Identity{admin, user, anonymous} {
+		target := up
+		if i == 1 {
+			target = down
+		}
+		client, err := httpclient.NewAs(target, identity)
+		require.NoError(t, err)
+		clients = append(clients, client)
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+"/users/admin.json", nil)
+	require.NoError(t, err)
+	resp, body, err := detector.Send(clients[0], req)
+	require.NoError(t, err)
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/users/{username}.json"},
+		Request:  req,
+		Response: resp,
+		Body:     body,
+		Client:   clients[0],
+	}
+
+	// The user's replay fails, anonymous is still replayed
+	findings, err := New(clients).Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "anonymous", findings[0].Param)
+}
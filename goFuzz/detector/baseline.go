@@ -0,0 +1,29 @@
+package detector
+
+import "time"
+
+// Baseline tracks the mean latency of a route
+type Baseline struct {
+	Requests int
+	Mean     time.Duration
+}
+
+// Update adds the latency of a request to the mean
+func (base *Baseline) Update(latency time.Duration) {
+	base.Requests++
+	base.Mean += (latency - base.Mean) / time.Duration(base.Requests)
+}
+
+// Baselines are latency baselines keyed by method and path
+type Baselines map[string]*Baseline
+
+// Get returns the baseline of a route, starting an empty one if it has none
+func (baselines Baselines) Get(method string, path string) *Baseline {
+	key := method + " " + path
+	base, ok := baselines[key]
+	if !ok {
+		base = &Baseline{}
+		baselines[key] = base
+	}
+	return base
+}
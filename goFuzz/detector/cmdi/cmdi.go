@@ -0,0 +1,241 @@
+package cmdi
+
+// OS command injection detection.  String leaves are sent a command wrapped in
+// shell metacharacters.  The command touches a marker file in the results
+// directory shared with the target and calls back to the canary listener, both
+// named after a unique token, so whichever side effect shows up tells us which
+// payload ran.  As a last resort, sleep payloads are timed against the route
+// baseline for targets that can't write files or reach the listener.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mruck/athena/goFuzz/canary"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "command-injection"
+
+// Marker files are named with this prefix followed by the token
+const markerPrefix = "athena_cmdi_"
+
+// How long sleep payloads sleep for
+const sleepSeconds = 5
+
+// A sleep payload must slow the request down by at least this much
+const minSleep = sleepSeconds * time.Second * 4 / 5
+
+// Shell metacharacters to break out of the command the value is used in.
+// Quoted variants close a quoted argument first.
+var wrappers = []string{
+	";%s;",
+	"|%s",
+	"&&%s&&",
+	"$(%s)",
+	"`%s`",
+	"\n%s\n",
+	"';%s;'",
+	"\";%s;\"",
+}
+
+// Sleep payloads, tried after all the side effect payloads
+var sleepWrappers = []string{
+	";%s;",
+	"$(%s)",
+}
+
+// pending is a payload injected but not yet checked.  Sleep payloads have no
+// token and are resent to rule out a one off slow response.
+type pending struct {
+	detector.Pending
+	sleep    bool
+	metadata *swagger.Metadata
+}
+
+// Detector for command injection
+type Detector struct {
+	resultsPath string
+	listener    *canary.Listener
+	// Payloads injected since the last check
+	pending []pending
+	// Every side effect token sent so far
+	origins detector.Origins
+	// Index of the next payload to send for each leaf
+	next map[*swagger.Metadata]int
+	// Latency baselines keyed by method and path
+	baselines detector.Baselines
+	// Number of listener hits already processed
+	offset int
+}
+
+// New returns a command injection detector.  Marker files are written to
+// resultsPath, the directory shared with the target.
+func New(resultsPath string, listener *canary.Listener) *Detector {
+	return &Detector{
+		resultsPath: resultsPath,
+		listener:    listener,
+		origins:     detector.Origins{},
+		next:        map[*swagger.Metadata]int{},
+		baselines:   detector.Baselines{},
+	}
+}
+
+// command returns a shell command leaving side effects named after token
+func (cmdi *Detector) command(token string) string {
+	marker := filepath.Join(cmdi.resultsPath, markerPrefix+token)
+	url := cmdi.listener.URL(token)
+	return fmt.Sprintf("touch %s;curl -s %s||wget -qO- %s", marker, url, url)
+}
+
+// Inject sends each payload once through every string leaf
+func (cmdi *Detector) Inject(leaf *detector.Leaf) interface{} {
+	if leaf.Type != "string" {
+		return nil
+	}
+	i := cmdi.next[leaf.Metadata]
+	if i >= len(wrappers)+len(sleepWrappers) {
+		return nil
+	}
+	cmdi.next[leaf.Metadata] = i + 1
+
+	sent := pending{Pending: detector.Pending{Param: leaf.Name}, metadata: leaf.Metadata}
+	if i < len(wrappers) {
+		sent.Token = canary.NewToken()
+		sent.Payload = fmt.Sprintf(wrappers[i], cmdi.command(sent.Token))
+	} else {
+		sent.sleep = true
+		sent.Payload = fmt.Sprintf(sleepWrappers[i-len(wrappers)], fmt.Sprintf("sleep %d", sleepSeconds))
+	}
+	cmdi.pending = append(cmdi.pending, sent)
+	return sent.Payload
+}
+
+// Reset drops payloads injected into a request that got no response, so
+// they aren't attributed to the next one
+func (cmdi *Detector) Reset() {
+	cmdi.pending = nil
+}
+
+// Check looks for side effects of any payload sent so far, and times sleep
+// payloads sent in the most recent request
+func (cmdi *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	injected := cmdi.pending
+	cmdi.pending = nil
+
+	findings := []*finding.Finding{}
+	sleeping := false
+	for _, sent := range injected {
+		if !sent.sleep {
+			cmdi.origins.Record(result, sent.Pending)
+			continue
+		}
+		sleeping = true
+		flagged := cmdi.checkSleep(result, sent)
+		if flagged != nil {
+			findings = append(findings, flagged)
+		}
+	}
+
+	// Sleep payloads would skew the baseline
+	if !sleeping {
+		cmdi.baselines.Get(result.Route.Method, result.Route.Path).Update(result.Latency)
+	}
+
+	markers, err := cmdi.markers()
+	if err != nil {
+		return findings, err
+	}
+	for _, token := range markers {
+		findings = append(findings, cmdi.sideEffect(token, "marker file", nil)...)
+	}
+	hits := cmdi.listener.Hits(cmdi.offset)
+	cmdi.offset += len(hits)
+	for _, hit := range hits {
+		findings = append(findings, cmdi.sideEffect(hit.Token, "callback", &hit)...)
+	}
+	return findings, nil
+}
+
+// sideEffect returns a finding for the request that sent token, if we sent it
+func (cmdi *Detector) sideEffect(token string, oracle string, hit *canary.Hit) []*finding.Finding {
+	sent, ok := cmdi.origins[token]
+	// Someone else's token
+	if !ok {
+		return nil
+	}
+	msg := fmt.Sprintf("%s left by %s sent in %s", oracle, sent.Payload, sent.Param)
+	flagged := sent.NewFinding(Kind, msg)
+	flagged.Details = bson.M{"Payload": sent.Payload, "Token": token, "Oracle": oracle}
+	if hit != nil {
+		flagged.Details["Hit"] = *hit
+	}
+	return []*finding.Finding{flagged}
+}
+
+// markers returns the tokens of marker files left by the target, removing
+// the files so they are only reported once
+func (cmdi *Detector) markers() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(cmdi.resultsPath, markerPrefix+"*"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tokens := []string{}
+	for _, path := range paths {
+		tokens = append(tokens, strings.TrimPrefix(filepath.Base(path), markerPrefix))
+		err := os.Remove(path)
+		if err != nil {
+			log.Warnf("%+v", errors.WithStack(err))
+		}
+	}
+	return tokens, nil
+}
+
+// checkSleep flags a sleep payload that slowed the request down.  The request
+// is sent again to rule out a one off slow response.
+func (cmdi *Detector) checkSleep(result *detector.Result, sent pending) *finding.Finding {
+	base := cmdi.baselines.Get(result.Route.Method, result.Route.Path)
+	if base.Requests == 0 || !slept(result.Latency, base.Mean) {
+		return nil
+	}
+
+	req, err := result.Route.Variant(sent.metadata, sent.Payload)
+	if err != nil {
+		log.Warnf("%+v", err)
+		return nil
+	}
+	_, _, err = detector.Send(result.Client, req)
+	if err != nil {
+		log.Warnf("%+v", err)
+		return nil
+	}
+	if !slept(result.Client.Latency, base.Mean) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("request took %v with %s in %s, baseline is %v",
+		result.Latency, sent.Payload, sent.Param, base.Mean)
+	flagged := result.NewFinding(Kind, sent.Param, msg)
+	flagged.Details = bson.M{
+		"Payload":  sent.Payload,
+		"Oracle":   "sleep",
+		"Latency":  result.Latency,
+		"Retry":    result.Client.Latency,
+		"Baseline": base.Mean,
+	}
+	return flagged
+}
+
+// slept checks if latency is long enough to include our sleep
+func slept(latency time.Duration, baseline time.Duration) bool {
+	return latency-baseline >= minSleep
+}
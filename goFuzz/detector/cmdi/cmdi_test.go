@@ -0,0 +1,88 @@
+package cmdi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/canary"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func newLeaf(name string) *detector.Leaf {
+	param := &spec.Parameter{}
+	param.Name = name
+	param.In = "query"
+	param.Type = "string"
+	return detector.NewLeaf(param, &swagger.Metadata{Name: name})
+}
+
+func TestSideEffects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmdi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	listener := &canary.Listener{Host: "localhost", Port: "0"}
+	require.NoError(t, listener.Start())
+	defer listener.Close()
+	cmdi := New(dir, listener)
+
+	leaf := newLeaf("host")
+	payload := cmdi.Inject(leaf).(string)
+	require.Contains(t, payload, markerPrefix)
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/ping"},
+		Response: &http.Response{StatusCode: 200},
+	}
+
+	// Nothing ran yet
+	findings, err := cmdi.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// The target runs our payload in a shell
+	_, err = exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	exec.Command("sh", "-c", "ping -c1 127.0.0.1"+payload).Run()
+
+	findings, err = cmdi.Check(result)
+	require.NoError(t, err)
+	require.NotEmpty(t, findings)
+	require.Equal(t, Kind, findings[0].Kind)
+	require.Equal(t, "host", findings[0].Param)
+	require.Equal(t, "marker file", findings[0].Details["Oracle"])
+
+	// Markers are cleaned up
+	paths, err := filepath.Glob(filepath.Join(dir, markerPrefix+"*"))
+	require.NoError(t, err)
+	require.Empty(t, paths)
+}
+
+func TestPayloads(t *testing.T) {
+	cmdi := New("/tmp/results", &canary.Listener{Host: "localhost", Port: "8889"})
+	leaf := newLeaf("cmd")
+	payloads := []string{}
+	for payload := cmdi.Inject(leaf); payload != nil; payload = cmdi.Inject(leaf) {
+		payloads = append(payloads, payload.(string))
+	}
+	require.Len(t, payloads, len(wrappers)+len(sleepWrappers))
+	require.Equal(t, ";sleep 5;", payloads[len(payloads)-2])
+
+	// Only strings
+	leaf.Type = "integer"
+	require.Nil(t, cmdi.Inject(leaf))
+}
+
+func TestSlept(t *testing.T) {
+	require.True(t, slept(5200*time.Millisecond, 100*time.Millisecond))
+	require.False(t, slept(2*time.Second, 100*time.Millisecond))
+}
@@ -0,0 +1,139 @@
+package detector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/pkg/errors"
+)
+
+// Detector looks for a class of vulnerability.  It may inject payloads into
+// parameters before a request is sent, and inspects the response afterwards.
+type Detector interface {
+	// Inject returns a value to send for the leaf, or nil if the detector
+	// has nothing to inject
+	Inject(leaf *Leaf) interface{}
+	// Check inspects the most recent request and returns any findings
+	Check(result *Result) ([]*finding.Finding, error)
+	// Reset forgets what was injected into the most recent request, when
+	// it can't be checked
+	Reset()
+}
+
+// Verifier is implemented by detectors that can tell whether a stored finding
+// still reproduces from the response to its replayed reproducer, without any
+// state from the run that found it
+type Verifier interface {
+	// Verify reports whether the finding reproduced.  Findings the detector
+	// can't verify this way return ErrUnverifiable.
+	Verify(found *finding.Finding, result *Result) (bool, error)
+}
+
+// ErrUnverifiable is returned by Verify for findings that can't be verified
+// by replaying a single request
+var ErrUnverifiable = errors.New("finding can't be verified by replaying it")
+
+// Reported checks if the findings include one of the same kind, for the same
+// parameter, as found
+func Reported(findings []*finding.Finding, found *finding.Finding) bool {
+	for _, f := range findings {
+		if f.Kind == found.Kind && f.Param == found.Param {
+			return true
+		}
+	}
+	return false
+}
+
+// Leaf describes a single value we send, i.e. a query param or a leaf in a
+// body param
+type Leaf struct {
+	// Parameter name, or key of the leaf in its parent object for body params
+	Name string
+	// Where the parameter lives: path, query, body, etc
+	In string
+	// Swagger type and format of the leaf
+	Type   string
+	Format string
+	// Mutation state of the leaf
+	Metadata *swagger.Metadata
+}
+
+// NewLeaf describes the leaf stored in metadata of the top level param
+func NewLeaf(param *spec.Parameter, metadata *swagger.Metadata) *Leaf {
+	leaf := &Leaf{
+		Name:     metadata.Name,
+		In:       param.In,
+		Type:     param.Type,
+		Format:   param.Format,
+		Metadata: metadata,
+	}
+	// The type of body leaves lives in the copy of the schema
+	if param.In == "body" {
+		leaf.Type = ""
+		if len(metadata.Schema.Type) > 0 {
+			leaf.Type = metadata.Schema.Type[0]
+		}
+		leaf.Format = metadata.Schema.Format
+	}
+	return leaf
+}
+
+// Leaves returns every leaf of the route
+func Leaves(route *route.Route) []*Leaf {
+	leaves := []*Leaf{}
+	for _, param := range route.Params {
+		for _, metadata := range param.GetMetadata() {
+			leaves = append(leaves, NewLeaf(&param.Parameter, metadata))
+		}
+	}
+	return leaves
+}
+
+// Result of sending a request
+type Result struct {
+	// Route the request was generated from
+	Route   *route.Route
+	Request *http.Request
+	// Request body, already read from Request.Body
+	RequestBody []byte
+	Response    *http.Response
+	// Response body, already read from Response.Body
+	Body    []byte
+	Latency time.Duration
+	Curl    string
+	// Queries postgres ran for the request, if the database is instrumented
+	Queries []string
+	// Redirects followed before Response, if the client captures them
+	Redirects []httpclient.Redirect
+	// Client that sent the request, for sending follow up requests
+	Client *httpclient.Client
+}
+
+// Send sends a follow up request and reads the response body
+func Send(client *httpclient.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp, body, errors.WithStack(err)
+}
+
+// NewFinding allocates a finding describing the most recent request
+func (result *Result) NewFinding(kind string, param string, message string) *finding.Finding {
+	return &finding.Finding{
+		Kind:    kind,
+		Method:  result.Route.Method,
+		Path:    result.Route.Path,
+		Param:   param,
+		Message: message,
+		Curl:    result.Curl,
+	}
+}
@@ -0,0 +1,33 @@
+package detector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaselines(t *testing.T) {
+	baselines := Baselines{}
+	base := baselines.Get("GET", "/posts")
+	base.Update(10 * time.Millisecond)
+	base.Update(20 * time.Millisecond)
+	require.Equal(t, 2, baselines.Get("GET", "/posts").Requests)
+	require.Equal(t, 15*time.Millisecond, baselines.Get("GET", "/posts").Mean)
+	require.Equal(t, 0, baselines.Get("POST", "/posts").Requests)
+}
+
+func TestOrigins(t *testing.T) {
+	origins := Origins{}
+	result := &Result{Route: &route.Route{Method: "GET", Path: "/fetch"}, Curl: "curl"}
+	origins.Record(result, Pending{Token: "abc", Param: "url", Payload: "http://x/abc"})
+
+	sent, ok := origins["abc"]
+	require.True(t, ok)
+	flagged := sent.NewFinding("ssrf", "called back")
+	require.Equal(t, "GET", flagged.Method)
+	require.Equal(t, "/fetch", flagged.Path)
+	require.Equal(t, "url", flagged.Param)
+	require.Equal(t, "curl", flagged.Curl)
+}
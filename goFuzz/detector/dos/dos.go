@@ -0,0 +1,338 @@
+package dos
+
+// Time based denial of service detection.  We keep a latency baseline for
+// every route, and for parameters that look like they control how much work
+// the server does (array sizes, LIMIT/per_page values, search strings) we
+// send the same request with increasingly large values and fit a curve to the
+// response times.  If response time grows faster than the size of the input,
+// an attacker can stall the server with a single request.
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/sql/postgres"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "dos"
+
+// Sizes we probe a parameter with
+var probeSizes = []int{1, 10, 100, 1000, 10000, 100000}
+
+// A probe that takes longer than this is considered to have stalled the
+// server.  A variable so tests don't have to wait.
+var probeTimeout = 60 * time.Second
+
+// A request slower than this and anomalyFactor times the route baseline is
+// flagged even if we can't attribute it to a parameter
+const stallThreshold = 10 * time.Second
+const anomalyFactor = 10
+
+// Number of requests before we trust a route baseline
+const minBaselineRequests = 3
+
+// On a log-log plot of time against size, linear growth has a slope of 1.
+// Anything above this is superlinear.
+const superlinearSlope = 1.5
+
+// Ignore curves where the largest probe is barely slower than the smallest,
+// it's just noise
+const minSlowdown = time.Second
+
+// Below this we can't distinguish extra work from noise
+const noise = 5 * time.Millisecond
+
+// Parameter names that usually control the number of results
+var sizeNameRe = regexp.MustCompile(`(?i)(limit|per_?page|page_?size|count|size|max|num|amount|take|top|depth|length|batch)`)
+
+// Parameter names that are usually matched against, sometimes as regexes
+var patternNameRe = regexp.MustCompile(`(?i)(regex|pattern|search|query|^q$|term|filter|match|glob|title|raw|body|content|text)`)
+
+// Point on a scaling curve
+type Point struct {
+	Size    int           `bson:"Size"`
+	Latency time.Duration `bson:"Latency"`
+	// Total time postgres spent running queries for the request
+	QueryTime time.Duration `bson:"QueryTime"`
+	// Slowest query logged for the request
+	SlowestQuery string `bson:"SlowestQuery"`
+	TimedOut     bool   `bson:"TimedOut"`
+}
+
+// Detector for time based denial of service
+type Detector struct {
+	// Postgres log for correlating probes with slow queries.  Nil if the
+	// target database isn't instrumented.
+	pgLog *postgres.PGLog
+	// Latency baselines keyed by method and path
+	baselines detector.Baselines
+	// Leaves we have already probed
+	probed map[*swagger.Metadata]bool
+}
+
+// New returns a denial of service detector
+func New(pgLog *postgres.PGLog) *Detector {
+	return &Detector{
+		pgLog:     pgLog,
+		baselines: detector.Baselines{},
+		probed:    map[*swagger.Metadata]bool{},
+	}
+}
+
+// Inject is a no-op, we send our own probes once we have a baseline
+func (dos *Detector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+// Reset is a no-op, nothing is injected
+func (dos *Detector) Reset() {}
+
+// scaler returns a function generating a value of the given size for the
+// leaf, or nil if the leaf doesn't look like it controls how much work the
+// server does
+func scaler(leaf *detector.Leaf) func(int) interface{} {
+	switch leaf.Type {
+	case "integer", "number":
+		if !sizeNameRe.MatchString(leaf.Name) {
+			return nil
+		}
+		return func(size int) interface{} {
+			return size
+		}
+	case "array":
+		// Body arrays are formatted from their elements, so we can only
+		// resize arrays in primitive params
+		if leaf.In == "body" {
+			return nil
+		}
+		return func(size int) interface{} {
+			elem := latestElement(leaf.Metadata)
+			obj := make([]interface{}, size)
+			for i := range obj {
+				obj[i] = elem
+			}
+			return obj
+		}
+	case "string":
+		if !patternNameRe.MatchString(leaf.Name) {
+			return nil
+		}
+		// Trailing mismatch forces backtracking in naive regex engines
+		return func(size int) interface{} {
+			return strings.Repeat("a", size) + "!"
+		}
+	}
+	return nil
+}
+
+// latestElement returns the first element of the most recent array sent
+func latestElement(metadata *swagger.Metadata) interface{} {
+	if len(metadata.Values) > 0 {
+		if array, ok := metadata.Values[0].([]interface{}); ok && len(array) > 0 {
+			return array[0]
+		}
+	}
+	return util.RandString()
+}
+
+// Check compares the latency of the most recent request against the route
+// baseline, then probes any parameter that could control the amount of
+// work done by the server
+func (dos *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	findings := []*finding.Finding{}
+
+	// The request stalled the server outright
+	base := dos.baselines.Get(result.Route.Method, result.Route.Path)
+	if base.Requests >= minBaselineRequests &&
+		result.Latency > stallThreshold &&
+		result.Latency > base.Mean*anomalyFactor {
+		msg := fmt.Sprintf("request took %v, baseline is %v", result.Latency, base.Mean)
+		stall := result.NewFinding(Kind, "", msg)
+		stall.Details = bson.M{"Latency": result.Latency, "Baseline": base.Mean}
+		findings = append(findings, stall)
+	}
+	base.Update(result.Latency)
+
+	// Probes are compared against the baseline
+	if base.Requests < minBaselineRequests {
+		return findings, nil
+	}
+	for _, leaf := range detector.Leaves(result.Route) {
+		if dos.probed[leaf.Metadata] {
+			continue
+		}
+		sizer := scaler(leaf)
+		if sizer == nil {
+			continue
+		}
+		dos.probed[leaf.Metadata] = true
+
+		curve, curl := dos.probe(result, leaf, sizer)
+		flagged := analyze(curve, base.Mean)
+		if flagged == nil {
+			continue
+		}
+		flagged.Method = result.Route.Method
+		flagged.Path = result.Route.Path
+		flagged.Param = leaf.Name
+		flagged.Curl = curl
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
+
+// probe sends the most recent request once for each probe size and records
+// how long it took.  It returns the curve and the curl command for the
+// largest probe sent.
+func (dos *Detector) probe(result *detector.Result, leaf *detector.Leaf,
+	sizer func(int) interface{}) ([]Point, string) {
+	client := result.Client
+
+	// Don't let a stalled server hang the fuzzer
+	timeout := client.Timeout
+	client.Timeout = probeTimeout
+	defer func() { client.Timeout = timeout }()
+
+	curve := []Point{}
+	curl := ""
+	for _, size := range probeSizes {
+		req, err := result.Route.Variant(leaf.Metadata, sizer(size))
+		if err != nil {
+			log.Warnf("%+v", err)
+			break
+		}
+		_, _, err = detector.Send(client, req)
+		point := Point{Size: size, Latency: client.Latency}
+		if client.CurlCmd != nil {
+			curl = client.CurlCmd.String()
+		}
+		// Read the queries run for this probe
+		dos.readQueries(&point)
+		if err != nil {
+			// The server stalled, there's no point in sending anything bigger
+			if netErr, ok := errors.Cause(err).(net.Error); ok && netErr.Timeout() {
+				point.TimedOut = true
+				curve = append(curve, point)
+				break
+			}
+			// Anything else says nothing about how long the request takes
+			log.Warnf("dos probe failed: %+v", err)
+			return nil, ""
+		}
+		curve = append(curve, point)
+	}
+	return curve, curl
+}
+
+// readQueries records the time spent in postgres by the most recent request
+func (dos *Detector) readQueries(point *Point) {
+	if dos.pgLog == nil {
+		return
+	}
+	_, err := dos.pgLog.Next()
+	if err != nil {
+		log.Warnf("%+v", err)
+		return
+	}
+	slowest := time.Duration(0)
+	for _, query := range dos.pgLog.TimedQueries() {
+		point.QueryTime += query.Duration
+		if query.Duration > slowest {
+			slowest = query.Duration
+			point.SlowestQuery = query.Query
+		}
+	}
+}
+
+// analyze fits the curve and returns a finding if time grows superlinearly
+// with size, or if the server stalled.  Route specific fields are left empty.
+func analyze(curve []Point, mean time.Duration) *finding.Finding {
+	if len(curve) == 0 {
+		return nil
+	}
+	latencies := make([]time.Duration, len(curve))
+	queryTimes := make([]time.Duration, len(curve))
+	for i, point := range curve {
+		latencies[i] = point.Latency
+		queryTimes[i] = point.QueryTime
+	}
+	latencySlope, latencyOk := fitSlope(curve, latencies)
+	querySlope, queryOk := fitSlope(curve, queryTimes)
+
+	last := curve[len(curve)-1]
+	var msg string
+	switch {
+	case last.TimedOut:
+		msg = fmt.Sprintf("request with size %d timed out after %v", last.Size, probeTimeout)
+	case latencyOk && latencySlope >= superlinearSlope:
+		msg = fmt.Sprintf("response time grows superlinearly with size (slope %.2f)", latencySlope)
+	case queryOk && querySlope >= superlinearSlope:
+		msg = fmt.Sprintf("query time grows superlinearly with size (slope %.2f)", querySlope)
+	default:
+		return nil
+	}
+	details := bson.M{
+		"Curve":        curve,
+		"LatencySlope": latencySlope,
+		"QuerySlope":   querySlope,
+		"Baseline":     mean,
+	}
+	return &finding.Finding{Kind: Kind, Message: msg, Details: details}
+}
+
+// fitSlope fits a line to log(time) against log(size) and returns the slope.
+// The time taken by the smallest probe is treated as fixed overhead.  The
+// bool is false if there weren't enough points above the noise or the
+// slowdown was too small to matter.
+func fitSlope(curve []Point, times []time.Duration) (float64, bool) {
+	floor := times[0]
+	for _, t := range times {
+		if t < floor {
+			floor = t
+		}
+	}
+	xs := []float64{}
+	ys := []float64{}
+	slowdown := time.Duration(0)
+	for i, point := range curve {
+		excess := times[i] - floor
+		if excess > slowdown {
+			slowdown = excess
+		}
+		if excess < noise {
+			continue
+		}
+		xs = append(xs, math.Log(float64(point.Size)))
+		ys = append(ys, math.Log(float64(excess)))
+	}
+	if len(xs) < 2 || slowdown < minSlowdown {
+		return 0, false
+	}
+
+	// Least squares
+	n := float64(len(xs))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
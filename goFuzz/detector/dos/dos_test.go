@@ -0,0 +1,135 @@
+package dos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+// Generate a curve where time = overhead + size^exponent microseconds
+func mockCurve(exponent float64) []Point {
+	curve := []Point{}
+	for _, size := range probeSizes[:5] {
+		work := time.Duration(1)
+		for i := 0; i < int(exponent); i++ {
+			work *= time.Duration(size)
+		}
+		latency := 50*time.Millisecond + work*time.Microsecond/10
+		curve = append(curve, Point{Size: size, Latency: latency})
+	}
+	return curve
+}
+
+func TestAnalyzeQuadratic(t *testing.T) {
+	finding := analyze(mockCurve(2), 50*time.Millisecond)
+	require.NotNil(t, finding)
+	require.Equal(t, Kind, finding.Kind)
+	require.InDelta(t, 2, finding.Details["LatencySlope"], 0.2)
+}
+
+func TestAnalyzeLinear(t *testing.T) {
+	// Linear growth is expected, don't flag it
+	finding := analyze(mockCurve(1), 50*time.Millisecond)
+	require.Nil(t, finding)
+}
+
+func TestAnalyzeTimeout(t *testing.T) {
+	curve := []Point{
+		{Size: 1, Latency: time.Millisecond},
+		{Size: 10, Latency: probeTimeout, TimedOut: true},
+	}
+	finding := analyze(curve, time.Millisecond)
+	require.NotNil(t, finding)
+}
+
+func TestScaler(t *testing.T) {
+	metadata := &swagger.Metadata{Values: []interface{}{[]interface{}{"a"}}}
+
+	// Integers are only resized if they look like a size
+	leaf := &detector.Leaf{Name: "per_page", In: "query", Type: "integer", Metadata: metadata}
+	require.Equal(t, 10, scaler(leaf)(10))
+	leaf.Name = "id"
+	require.Nil(t, scaler(leaf))
+
+	// Primitive arrays are resized
+	leaf = &detector.Leaf{Name: "ids", In: "query", Type: "array", Metadata: metadata}
+	require.Len(t, scaler(leaf)(100), 100)
+
+	// Search strings are lengthened
+	leaf = &detector.Leaf{Name: "term", In: "body", Type: "string", Metadata: metadata}
+	require.Len(t, scaler(leaf)(100), 101)
+}
+
+// loginResult describes a request to the login route of the test swagger,
+// sent by a client for ts
+func loginResult(t *testing.T, ts *httptest.Server) *detector.Result {
+	r := route.FromSwagger("../../route/test/query.json")[0]
+	r.MockData()
+	for _, param := range r.Params {
+		swagger.StoreValue(&param.Parameter, "original")
+	}
+	r.FormatParams()
+	target, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+	return &detector.Result{Route: r, Client: client, Response: &http.Response{StatusCode: 200}}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	probeTimeout = 50 * time.Millisecond
+	defer func() { probeTimeout = 60 * time.Second }()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") == "10" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer ts.Close()
+
+	result := loginResult(t, ts)
+	leaf := detector.Leaves(result.Route)[0]
+	curve, _ := New(nil).probe(result, leaf, func(size int) interface{} { return size })
+	require.Len(t, curve, 2)
+	require.True(t, curve[1].TimedOut)
+	require.NotNil(t, analyze(curve, time.Millisecond))
+}
+
+func TestProbeError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	result := loginResult(t, ts)
+	// Connection refused isn't a stall
+	ts.Close()
+	leaf := detector.Leaves(result.Route)[0]
+	curve, _ := New(nil).probe(result, leaf, func(size int) interface{} { return size })
+	require.Nil(t, curve)
+	require.Nil(t, analyze(curve, time.Millisecond))
+}
+
+func TestCheckWaitsForBaseline(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	// Only search strings are probed
+	result := loginResult(t, ts)
+	detector.Leaves(result.Route)[0].Metadata.Name = "search"
+	dos := New(nil)
+	for i := 1; i < minBaselineRequests; i++ {
+		_, err := dos.Check(result)
+		require.NoError(t, err)
+		require.Equal(t, 0, requests)
+	}
+	_, err := dos.Check(result)
+	require.NoError(t, err)
+	require.Equal(t, len(probeSizes), requests)
+}
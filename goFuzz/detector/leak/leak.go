@@ -0,0 +1,177 @@
+package leak
+
+// Sensitive information leak detection.  Response bodies and headers are
+// scanned for stack traces, SQL errors, framework debug pages, internal
+// addresses, secrets and email addresses belonging to someone other than the
+// identity that sent the request.  Findings are attributed to where the leak
+// was found and its category, e.g. "header:internal-address", so each route
+// reports each once.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/lib/finding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "info-leak"
+
+// Categories of leak
+const (
+	stackTrace      = "stack-trace"
+	sqlError        = "sql-error"
+	debugPage       = "debug-page"
+	internalAddress = "internal-address"
+	secret          = "secret"
+	email           = "email"
+)
+
+// Keep this many matches per category as evidence
+const maxMatches = 5
+
+// Patterns for each category
+var patterns = map[string][]*regexp.Regexp{
+	stackTrace: {
+		// Ruby
+		regexp.MustCompile(`[\w/.-]+\.rb:\d+:in ` + "[`']" + `[^'\n]+'`),
+		// Python
+		regexp.MustCompile(`Traceback \(most recent call last\)`),
+		// Java
+		regexp.MustCompile(`\bat [\w$.]+\([\w$]+\.java:\d+\)`),
+		// Go
+		regexp.MustCompile(`goroutine \d+ \[running\]`),
+	},
+	sqlError: {
+		regexp.MustCompile(`PG::[A-Z][A-Za-z]+`),
+		regexp.MustCompile(`ActiveRecord::(StatementInvalid|RecordNotUnique)`),
+		regexp.MustCompile(`(?i)syntax error at or near "[^"]*"`),
+		regexp.MustCompile(`You have an error in your SQL syntax`),
+		regexp.MustCompile(`SQLSTATE\[\w+\]`),
+	},
+	debugPage: {
+		regexp.MustCompile(`Action Controller: Exception caught`),
+		regexp.MustCompile(`(?i)better_errors`),
+		regexp.MustCompile(`Werkzeug Debugger`),
+		regexp.MustCompile(`X-Web-Console-Session-Id`),
+		regexp.MustCompile(`Django Version:`),
+	},
+	internalAddress: {
+		regexp.MustCompile(`\b(10\.\d{1,3}\.\d{1,3}\.\d{1,3}|192\.168\.\d{1,3}\.\d{1,3}|172\.(1[6-9]|2\d|3[01])\.\d{1,3}\.\d{1,3})\b`),
+		regexp.MustCompile(`\b[\w-]+(\.[\w-]+)*\.(internal|localdomain|svc\.cluster\.local)\b`),
+	},
+	secret: {
+		// AWS access key
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`),
+		// Slack
+		regexp.MustCompile(`\bxox[baprs]-[0-9A-Za-z-]{10,}`),
+		// Github
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`),
+		// Google
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		// Key value pairs in json, yaml, env files
+		regexp.MustCompile(`(?i)["']?\b(secret|secret_key_base|api_?key|access_token|auth_token|password|private_key)["']?\s*[:=]\s*["'][^"'\s]{8,}["']`),
+	},
+	email: {
+		regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+}
+
+// Detector for sensitive information in responses
+type Detector struct{}
+
+// New returns an information leak detector
+func New() *Detector {
+	return &Detector{}
+}
+
+// Inject is a no-op, we only look at responses
+func (leak *Detector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+// Reset is a no-op, nothing is injected
+func (leak *Detector) Reset() {}
+
+// Check scans the headers and body of the most recent response
+func (leak *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	// Data belonging to the identity that sent the request isn't a leak
+	own := []string{}
+	if result.Client != nil && result.Client.Identity != nil {
+		own = result.Client.Identity.Markers
+	}
+
+	findings := []*finding.Finding{}
+	for _, location := range []string{"header", "body"} {
+		text := string(result.Body)
+		if location == "header" {
+			text = headers(result)
+		}
+		for category, matches := range scan(text, own) {
+			msg := fmt.Sprintf("%s in response %s: %s", category, location, strings.Join(matches, ", "))
+			flagged := result.NewFinding(Kind, location+":"+category, msg)
+			flagged.Details = bson.M{"Category": category, "Location": location, "Matches": matches}
+			findings = append(findings, flagged)
+		}
+	}
+	return findings, nil
+}
+
+// Verify checks if the response still leaks the same category of information
+func (leak *Detector) Verify(found *finding.Finding, result *detector.Result) (bool, error) {
+	findings, err := leak.Check(result)
+	return detector.Reported(findings, found), err
+}
+
+// headers formats the response headers as they were on the wire
+func headers(result *detector.Result) string {
+	lines := []string{}
+	for name, values := range result.Response.Header {
+		for _, value := range values {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// scan returns the unique matches for each category found in text, ignoring
+// matches in own
+func scan(text string, own []string) map[string][]string {
+	found := map[string][]string{}
+	for category, regexes := range patterns {
+		seen := map[string]bool{}
+		for _, re := range regexes {
+			for _, match := range re.FindAllString(text, -1) {
+				if seen[match] || ignored(category, match, own) {
+					continue
+				}
+				seen[match] = true
+				if len(found[category]) < maxMatches {
+					found[category] = append(found[category], match)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// ignored checks if a match is expected
+func ignored(category string, match string, own []string) bool {
+	if category != email {
+		return false
+	}
+	for _, marker := range own {
+		if strings.EqualFold(marker, match) {
+			return true
+		}
+	}
+	// Reserved for documentation, and our own payloads
+	lowered := strings.ToLower(match)
+	return strings.HasSuffix(lowered, "example.com") || strings.HasSuffix(lowered, "example.org")
+}
@@ -0,0 +1,470 @@
+package massassign
+
+// Mass assignment detection.  Requests that write state are replayed with
+// fields the swagger doesn't declare: common privileged names, keys harvested
+// from responses for the same resource, and columns of tables the route's
+// parameters map to.  A field is flagged if postgres writes a column by that
+// name that the original request didn't write, or if the value we sent comes
+// back in the response or a follow up GET of the same URL.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/sql/postgres"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "mass-assignment"
+
+// Fields worth setting on any model
+var commonFields = []string{
+	"admin", "is_admin", "role", "roles", "user_id", "owner_id", "account_id",
+	"approved", "verified", "active", "staff", "moderator", "trust_level",
+	"email_confirmed",
+}
+
+// Fields we never send.  Assigning them on our own user would lock the
+// fuzzer, and replay, out of the identities they log in as.
+var credentialNameRe = regexp.MustCompile(`(?i)password|passwd|digest|token|secret|salt`)
+
+// Undeclared fields sent per request.  Sending everything at once makes
+// strict targets reject the request.
+const batchSize = 10
+
+// Cap on harvested keys per resource
+const maxHarvested = 100
+
+// Field names that are usually booleans
+var boolNameRe = regexp.MustCompile(`^(is_|has_|can_)|admin|approved|verified|active|staff|moderator|confirmed|enabled|locked|banned`)
+
+// Columns written by UPDATE and INSERT statements
+var (
+	updateRe = regexp.MustCompile(`(?is)^\s*update\s+([\w.]+)\s+set\s+(.*?)(\s+where\s+.*)?$`)
+	assignRe = regexp.MustCompile(`(?i)(?:^|,)\s*([\w.]+)\s*=`)
+	insertRe = regexp.MustCompile(`(?is)^\s*insert\s+into\s+([\w.]+)\s*\(([^)]*)\)`)
+)
+
+// Methods that write state
+var writeMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true}
+
+// field is an undeclared field and the value we send in it
+type field struct {
+	name  string
+	value interface{}
+}
+
+// Detector for mass assignment
+type Detector struct {
+	routes []*route.Route
+	// Target database, nil if not instrumented
+	db *postgres.Postgres
+	// Response keys and sample values keyed by resource
+	harvested map[string]map[string]interface{}
+	// Columns keyed by table
+	columns map[string][]string
+	// Fields already sent, keyed by method and path
+	tried map[string]map[string]bool
+}
+
+// New returns a mass assignment detector
+func New(routes []*route.Route, db *postgres.Postgres) *Detector {
+	return &Detector{
+		routes:    routes,
+		db:        db,
+		harvested: map[string]map[string]interface{}{},
+		columns:   map[string][]string{},
+		tried:     map[string]map[string]bool{},
+	}
+}
+
+// Inject is a no-op, we send our own requests
+func (massassign *Detector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+// Reset is a no-op, nothing is injected
+func (massassign *Detector) Reset() {}
+
+// resource returns the first segment of the path, i.e. users for
+// /users/{id}.json
+func resource(path string) string {
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	return strings.SplitN(segment, ".", 2)[0]
+}
+
+func success(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// Check harvests keys from the response, then replays successful writes with
+// undeclared fields
+func (massassign *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	if !success(result.Response.StatusCode) {
+		return nil, nil
+	}
+	massassign.harvest(resource(result.Route.Path), result.Body)
+	if !writeMethods[result.Route.Method] {
+		return nil, nil
+	}
+
+	findings := []*finding.Finding{}
+	candidates := massassign.candidates(result.Route)
+	for start := 0; start < len(candidates); start += batchSize {
+		end := start + batchSize
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		found, err := massassign.send(result, candidates[start:end])
+		if err != nil {
+			return findings, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+// harvest remembers the keys of objects in a json response
+func (massassign *Detector) harvest(resource string, body []byte) {
+	var obj interface{}
+	if json.Unmarshal(body, &obj) != nil {
+		return
+	}
+	keys, ok := massassign.harvested[resource]
+	if !ok {
+		keys = map[string]interface{}{}
+		massassign.harvested[resource] = keys
+	}
+	collect(obj, keys, 2)
+}
+
+// collect adds the keys of obj and its children up to depth levels deep
+func collect(obj interface{}, keys map[string]interface{}, depth int) {
+	if depth == 0 {
+		return
+	}
+	switch typed := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range typed {
+			if len(keys) >= maxHarvested {
+				return
+			}
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				collect(value, keys, depth-1)
+			default:
+				keys[key] = value
+			}
+		}
+	case []interface{}:
+		for _, elem := range typed {
+			collect(elem, keys, depth)
+		}
+	}
+}
+
+// candidates returns fields we haven't sent to the route yet
+func (massassign *Detector) candidates(route *route.Route) []field {
+	key := route.Method + " " + route.Path
+	tried, ok := massassign.tried[key]
+	if !ok {
+		tried = map[string]bool{}
+		massassign.tried[key] = tried
+	}
+	// Don't send fields the route declares
+	for _, leaf := range detector.Leaves(route) {
+		tried[leaf.Name] = true
+	}
+	for _, param := range route.Params {
+		tried[param.Name] = true
+	}
+
+	fields := []field{}
+	add := func(name string, sample interface{}) {
+		if tried[name] || credentialNameRe.MatchString(name) {
+			return
+		}
+		tried[name] = true
+		fields = append(fields, field{name: name, value: sentinel(name, sample)})
+	}
+	for _, name := range commonFields {
+		add(name, nil)
+	}
+	for name, sample := range massassign.harvested[resource(route.Path)] {
+		add(name, sample)
+	}
+	for _, column := range massassign.tableColumns(route) {
+		add(column, nil)
+	}
+	return fields
+}
+
+// tableColumns returns the columns of every table the route's params were
+// found in
+func (massassign *Detector) tableColumns(route *route.Route) []string {
+	if massassign.db == nil {
+		return nil
+	}
+	columns := []string{}
+	for _, leaf := range detector.Leaves(route) {
+		query := leaf.Metadata.TaintedQuery
+		if query == nil || query.Table == "" {
+			continue
+		}
+		cached, ok := massassign.columns[query.Table]
+		if !ok {
+			var err error
+			cached, err = massassign.db.Conn.Columns(query.Table)
+			if err != nil {
+				log.Warnf("%+v", err)
+			}
+			massassign.columns[query.Table] = cached
+		}
+		columns = append(columns, cached...)
+	}
+	return columns
+}
+
+// sentinel returns a value for the field that we can recognize and that does
+// damage if assigned
+func sentinel(name string, sample interface{}) interface{} {
+	switch typed := sample.(type) {
+	case bool:
+		return !typed
+	case float64:
+		return 1337
+	}
+	lowered := strings.ToLower(name)
+	switch {
+	case boolNameRe.MatchString(lowered):
+		return true
+	case strings.HasSuffix(lowered, "_id"):
+		return 1
+	case strings.HasSuffix(lowered, "level"):
+		return 4
+	case strings.HasPrefix(lowered, "role"):
+		return "admin"
+	}
+	return "athm" + strings.Replace(uuid.New().String(), "-", "", -1)[:8]
+}
+
+// send replays the request with fields added and returns findings for any
+// that stuck
+func (massassign *Detector) send(result *detector.Result, fields []field) ([]*finding.Finding, error) {
+	req, err := withFields(result.Request, result.RequestBody, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// What the resource looks like before we write to it
+	hasGet := massassign.hasGet(result.Route.Path)
+	var before []byte
+	if hasGet {
+		before = massassign.get(result, req.URL.String())
+	}
+
+	resp, body, err := detector.Send(result.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	curl := ""
+	if result.Client.CurlCmd != nil {
+		curl = result.Client.CurlCmd.String()
+	}
+	if !success(resp.StatusCode) {
+		return nil, nil
+	}
+
+	// Columns written by the original request don't count
+	var written map[string]string
+	if massassign.db != nil {
+		queries, err := massassign.db.Log.Next()
+		if err != nil {
+			log.Warnf("%+v", err)
+		}
+		written = newColumns(writtenColumns(result.Queries), writtenColumns(queries))
+	}
+
+	// Read back what we wrote
+	var after []byte
+	if hasGet {
+		after = massassign.get(result, req.URL.String())
+	}
+
+	findings := []*finding.Finding{}
+	for _, field := range fields {
+		oracle, evidence := "", ""
+		if table, ok := written[strings.ToLower(field.name)]; ok {
+			oracle, evidence = "postgres", "written to "+table+"."+field.name
+		} else if contains(after, field) && !contains(before, field) {
+			oracle, evidence = "follow-up", "returned by GET "+result.Route.Path
+		} else if contains(body, field) && !contains(result.Body, field) {
+			oracle, evidence = "response", "returned in the response"
+		}
+		if oracle == "" {
+			continue
+		}
+		msg := fmt.Sprintf("undeclared field %s=%v was accepted: %s", field.name, field.value, evidence)
+		flagged := result.NewFinding(Kind, field.name, msg)
+		flagged.Curl = curl
+		flagged.Details = bson.M{"Field": field.name, "Value": field.value, "Oracle": oracle}
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
+
+// get fetches url and returns the body, or nil on error
+func (massassign *Detector) get(result *detector.Result, url string) []byte {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		log.Warnf("%+v", errors.WithStack(err))
+		return nil
+	}
+	_, body, err := detector.Send(result.Client, req)
+	if err != nil {
+		log.Warnf("%+v", err)
+		return nil
+	}
+	return body
+}
+
+// hasGet checks if there is a GET route at path
+func (massassign *Detector) hasGet(path string) bool {
+	for _, route := range massassign.routes {
+		if route.Method == "GET" && route.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// withFields copies the request with fields added to the json body, and to
+// any objects nested one level down since Rails usually wraps params in the
+// model name.  Requests without a json object body get the fields in the
+// query string.  Cookies are left to the client sending it, which holds the
+// same session.
+func withFields(orig *http.Request, body []byte, fields []field) (*http.Request, error) {
+	url := *orig.URL
+	obj := map[string]interface{}{}
+	if len(body) > 0 && json.Unmarshal(body, &obj) == nil {
+		for _, value := range obj {
+			if nested, ok := value.(map[string]interface{}); ok {
+				addFields(nested, fields)
+			}
+		}
+		addFields(obj, fields)
+		var err error
+		body, err = json.Marshal(obj)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		query := url.Query()
+		for _, field := range fields {
+			query.Set(field.name, fmt.Sprintf("%v", field.value))
+		}
+		url.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(orig.Method, url.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for name, values := range orig.Header {
+		if name == "Cookie" {
+			continue
+		}
+		req.Header[name] = append([]string{}, values...)
+	}
+	return req, nil
+}
+
+func addFields(obj map[string]interface{}, fields []field) {
+	for _, field := range fields {
+		obj[field.name] = field.value
+	}
+}
+
+// writtenColumns returns the columns written by UPDATE and INSERT queries,
+// mapped to their table
+func writtenColumns(queries []string) map[string]string {
+	columns := map[string]string{}
+	for _, query := range queries {
+		if match := updateRe.FindStringSubmatch(query); match != nil {
+			for _, assign := range assignRe.FindAllStringSubmatch(match[2], -1) {
+				columns[column(assign[1])] = match[1]
+			}
+		} else if match := insertRe.FindStringSubmatch(query); match != nil {
+			for _, name := range strings.Split(match[2], ",") {
+				columns[column(name)] = match[1]
+			}
+		}
+	}
+	return columns
+}
+
+// column strips the table from a column name
+func column(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// newColumns returns the columns written in after that weren't in before
+func newColumns(before map[string]string, after map[string]string) map[string]string {
+	added := map[string]string{}
+	for name, table := range after {
+		if _, ok := before[name]; !ok {
+			added[name] = table
+		}
+	}
+	return added
+}
+
+// contains checks if a json body has field set to our value
+func contains(body []byte, field field) bool {
+	// Our random strings are unique enough to search for directly
+	if str, ok := field.value.(string); ok && strings.HasPrefix(str, "athm") {
+		return bytes.Contains(body, []byte(str))
+	}
+	var obj interface{}
+	if json.Unmarshal(body, &obj) != nil {
+		return false
+	}
+	return hasValue(obj, field.name, fmt.Sprintf("%v", field.value))
+}
+
+// hasValue searches obj for key set to value
+func hasValue(obj interface{}, key string, value string) bool {
+	switch typed := obj.(type) {
+	case map[string]interface{}:
+		for name, child := range typed {
+			if name == key && fmt.Sprintf("%v", child) == value {
+				return true
+			}
+			if hasValue(child, key, value) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, elem := range typed {
+			if hasValue(elem, key, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
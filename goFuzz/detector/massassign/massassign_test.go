@@ -0,0 +1,127 @@
+package massassign
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrittenColumns(t *testing.T) {
+	queries := []string{
+		"SELECT users.* FROM users WHERE users.id = 1 LIMIT 1",
+		"UPDATE users SET admin = $1, updated_at = $2 WHERE users.id = $3",
+		"INSERT INTO user_histories (user_id, action) VALUES (1, 'edit') RETURNING id",
+	}
+	columns := writtenColumns(queries)
+	require.Equal(t, map[string]string{
+		"admin":      "users",
+		"updated_at": "users",
+		"user_id":    "user_histories",
+		"action":     "user_histories",
+	}, columns)
+
+	before := writtenColumns([]string{"UPDATE users SET updated_at = now() WHERE id = 1"})
+	require.Equal(t, map[string]string{"admin": "users", "user_id": "user_histories", "action": "user_histories"},
+		newColumns(before, columns))
+}
+
+func TestSentinel(t *testing.T) {
+	require.Equal(t, true, sentinel("is_admin", nil))
+	require.Equal(t, true, sentinel("admin", false))
+	require.Equal(t, false, sentinel("enabled", true))
+	require.Equal(t, 1, sentinel("user_id", nil))
+	require.Equal(t, "admin", sentinel("role", nil))
+	require.Regexp(t, "^athm", sentinel("bio", "hello"))
+}
+
+func TestWithFields(t *testing.T) {
+	orig, err := http.NewRequest("PUT", "http://localhost/users/1", nil)
+	require.NoError(t, err)
+	orig.Header.Set("Cookie", "_session=abc")
+	orig.Header.Set("X-Csrf-Token", "token")
+	fields := []field{{name: "admin", value: true}}
+
+	// Nested Rails style params
+	req, err := withFields(orig, []byte(`{"user": {"name": "bob"}}`), fields)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	obj := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(body, &obj))
+	require.Equal(t, true, obj["admin"])
+	require.Equal(t, true, obj["user"].(map[string]interface{})["admin"])
+	// The client sending it supplies the session
+	require.Empty(t, req.Header.Get("Cookie"))
+	require.Equal(t, "token", req.Header.Get("X-Csrf-Token"))
+
+	// No body
+	req, err = withFields(orig, nil, fields)
+	require.NoError(t, err)
+	require.Equal(t, "admin=true", req.URL.RawQuery)
+}
+
+func TestCheck(t *testing.T) {
+	// A user whose existing attributes can all be assigned
+	user := map[string]interface{}{"id": 1, "name": "bob", "admin": false, "password_digest": "secret", "auth_token": "abc"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			params := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&params)
+			for key, value := range params {
+				if _, ok := user[key]; ok {
+					user[key] = value
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(user)
+	}))
+	defer ts.Close()
+	target, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+
+	put := &route.Route{Method: "PUT", Path: "/users/{id}"}
+	get := &route.Route{Method: "GET", Path: "/users/{id}"}
+	massassign := New([]*route.Route{put, get}, nil)
+
+	reqBody := []byte(`{"name": "alice"}`)
+	req, err := http.NewRequest("PUT", ts.URL+"/users/1", bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	result := &detector.Result{
+		Route:       put,
+		Request:     req,
+		RequestBody: reqBody,
+		Response:    &http.Response{StatusCode: 200},
+		Body:        []byte(`{"id": 1, "name": "alice", "admin": false, "password_digest": "secret", "auth_token": "abc"}`),
+		Client:      client,
+	}
+	findings, err := massassign.Check(result)
+	require.NoError(t, err)
+	require.Equal(t, true, user["admin"])
+	names := []string{}
+	for _, found := range findings {
+		require.Equal(t, Kind, found.Kind)
+		names = append(names, found.Param)
+	}
+	require.Contains(t, names, "admin")
+	// Dropped by the target
+	require.NotContains(t, names, "role")
+	// Credentials are never sent
+	require.Equal(t, "secret", user["password_digest"])
+	require.Equal(t, "abc", user["auth_token"])
+
+	// Fields are only sent once per route
+	findings, err = massassign.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
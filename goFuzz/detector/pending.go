@@ -0,0 +1,58 @@
+package detector
+
+import (
+	"time"
+
+	"github.com/mruck/athena/lib/finding"
+)
+
+// Pending is a payload injected but not yet checked.  Token identifies the
+// payload when its effects are only seen after the request, i.e. callbacks
+// and files written by the target.
+type Pending struct {
+	Token   string
+	Param   string
+	Payload string
+}
+
+// Origin is the request a payload was sent in
+type Origin struct {
+	Method  string    `bson:"Method"`
+	Path    string    `bson:"Path"`
+	Param   string    `bson:"Param"`
+	Payload string    `bson:"Payload"`
+	Curl    string    `bson:"Curl"`
+	Sent    time.Time `bson:"Sent"`
+}
+
+// Origins maps the token of every payload sent so far to its origin, so
+// effects seen later are attributed to the right request
+type Origins map[string]*Origin
+
+// Record attributes payloads injected since the last check to the most recent
+// request
+func (origins Origins) Record(result *Result, injected ...Pending) {
+	for _, sent := range injected {
+		origins[sent.Token] = &Origin{
+			Method:  result.Route.Method,
+			Path:    result.Route.Path,
+			Param:   sent.Param,
+			Payload: sent.Payload,
+			Curl:    result.Curl,
+			Sent:    time.Now(),
+		}
+	}
+}
+
+// NewFinding allocates a finding describing the request the payload was sent
+// in
+func (origin *Origin) NewFinding(kind string, message string) *finding.Finding {
+	return &finding.Finding{
+		Kind:    kind,
+		Method:  origin.Method,
+		Path:    origin.Path,
+		Param:   origin.Param,
+		Message: message,
+		Curl:    origin.Curl,
+	}
+}
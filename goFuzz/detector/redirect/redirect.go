@@ -0,0 +1,184 @@
+package redirect
+
+// Open redirect and response header injection detection.  Parameters named
+// like redirect targets are sent URLs on an external host, spelled in the ways
+// that slip past naive "is this a relative path" checks, and then CRLF
+// sequences smuggling in a header of our own.  Every response in the redirect
+// chain is checked for a Location on our host or for our header.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of finding reported by this detector
+const (
+	KindRedirect = "open-redirect"
+	KindHeader   = "header-injection"
+)
+
+// External host we redirect to.  Reserved, so nothing is listening on it.
+const evilHost = "athena-redirect.example.com"
+
+// Header we smuggle in with CRLF sequences
+const injectedHeader = "X-Athena-Injected"
+
+// Parameter names that usually hold a redirect target
+var redirectNameRe = regexp.MustCompile(`(?i)(return|redirect|next|dest|continue|goto|forward|back|origin|target|url|uri)`)
+
+// Payloads tried in order for each leaf.  Each takes a token identifying the
+// payload.  They're spelled raw since the request is url encoded when it's
+// built.
+var payloads = []func(token string) string{
+	func(token string) string { return "https://" + evilHost + "/" + token },
+	// Protocol relative
+	func(token string) string { return "//" + evilHost + "/" + token },
+	// Browsers treat backslashes as slashes
+	func(token string) string { return `/\` + evilHost + "/" + token },
+	// Header injection
+	func(token string) string { return "/\r\n" + injectedHeader + ": " + token },
+	func(token string) string { return "/\r\nSet-Cookie: athena=" + token },
+}
+
+// Detector for open redirects and header injection
+type Detector struct {
+	// Payloads injected since the last check
+	pending []detector.Pending
+	// Index of the next payload to send for each leaf
+	next map[*swagger.Metadata]int
+}
+
+// New returns an open redirect detector.  The clients sending fuzzed requests
+// must capture redirects, since we can't follow them to our host.
+func New(clients []*httpclient.Client) *Detector {
+	for _, client := range clients {
+		client.CaptureRedirects = true
+	}
+	return &Detector{next: map[*swagger.Metadata]int{}}
+}
+
+func newToken() string {
+	return "athr" + strings.Replace(uuid.New().String(), "-", "", -1)[:8]
+}
+
+// Inject sends each payload once through every leaf named like a redirect
+// target
+func (redirect *Detector) Inject(leaf *detector.Leaf) interface{} {
+	if leaf.Type != "string" || !redirectNameRe.MatchString(leaf.Name) {
+		return nil
+	}
+	i := redirect.next[leaf.Metadata]
+	if i >= len(payloads) {
+		return nil
+	}
+	redirect.next[leaf.Metadata] = i + 1
+
+	token := newToken()
+	payload := payloads[i](token)
+	redirect.pending = append(redirect.pending, detector.Pending{Token: token, Param: leaf.Name, Payload: payload})
+	return payload
+}
+
+// Reset drops payloads injected into a request that got no response, so
+// they aren't attributed to the next one
+func (redirect *Detector) Reset() {
+	redirect.pending = nil
+}
+
+// hop is a response in the redirect chain
+type hop struct {
+	url    string
+	status int
+	header http.Header
+}
+
+// chain returns every response we received for the request, in order
+func chain(result *detector.Result) []hop {
+	hops := []hop{}
+	for _, redirect := range result.Redirects {
+		hops = append(hops, hop{url: redirect.URL, status: redirect.StatusCode, header: redirect.Header})
+	}
+	return append(hops, hop{
+		url:    result.Request.URL.String(),
+		status: result.Response.StatusCode,
+		header: result.Response.Header,
+	})
+}
+
+// Check looks for our host in Location headers and our headers anywhere in
+// the redirect chain
+func (redirect *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	injected := redirect.pending
+	redirect.pending = nil
+
+	findings := []*finding.Finding{}
+	for _, sent := range injected {
+		for _, hop := range chain(result) {
+			kind, msg := check(hop, sent.Token)
+			if kind == "" {
+				continue
+			}
+			flagged := result.NewFinding(kind, sent.Param, fmt.Sprintf("%s after sending %q in %s", msg, sent.Payload, sent.Param))
+			flagged.Details = bson.M{
+				"Payload": sent.Payload,
+				"URL":     hop.url,
+				"Status":  hop.status,
+				"Headers": hop.header,
+			}
+			findings = append(findings, flagged)
+			break
+		}
+	}
+	return findings, nil
+}
+
+// check returns the kind of finding and a description if the response is
+// attacker controlled, or the empty string
+func check(hop hop, token string) (string, string) {
+	// A header we smuggled in
+	if value := hop.header.Get(injectedHeader); strings.Contains(value, token) {
+		return KindHeader, fmt.Sprintf("response has injected header %s: %s", injectedHeader, value)
+	}
+	for _, cookie := range hop.header["Set-Cookie"] {
+		if strings.HasPrefix(cookie, "athena="+token) {
+			return KindHeader, fmt.Sprintf("response sets injected cookie %s", cookie)
+		}
+	}
+
+	// Redirects to our host
+	location := hop.header.Get("Location")
+	if location == "" || !strings.Contains(location, token) {
+		return "", ""
+	}
+	if offsite(location) {
+		return KindRedirect, fmt.Sprintf("%d redirect to %s", hop.status, location)
+	}
+	return "", ""
+}
+
+// offsite checks if a browser following location would end up on our host
+func offsite(location string) bool {
+	// Browsers treat backslashes as slashes
+	normalized := strings.Replace(location, `\`, "/", -1)
+	parsed, err := url.Parse(normalized)
+	if err != nil {
+		return false
+	}
+	if parsed.Host == "" && strings.HasPrefix(parsed.Path, "//") {
+		parsed, err = url.Parse(parsed.Path)
+		if err != nil {
+			return false
+		}
+	}
+	return strings.EqualFold(parsed.Hostname(), evilHost)
+}
@@ -0,0 +1,107 @@
+package redirect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsite(t *testing.T) {
+	require.True(t, offsite("https://"+evilHost+"/x"))
+	require.True(t, offsite("//"+evilHost+"/x"))
+	require.True(t, offsite(`/\`+evilHost+"/x"))
+	require.False(t, offsite("/"+evilHost+"/x"))
+	require.False(t, offsite("https://discourse.example.com/?next="+evilHost))
+}
+
+func TestCheck(t *testing.T) {
+	target, err := url.Parse("http://localhost:3000")
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+	redirect := New([]*httpclient.Client{client})
+	require.True(t, client.CaptureRedirects)
+
+	param := &spec.Parameter{}
+	param.Name = "return_to"
+	param.In = "query"
+	param.Type = "string"
+	leaf := detector.NewLeaf(param, &swagger.Metadata{Name: "return_to"})
+
+	req, err := http.NewRequest("GET", "http://localhost:3000/login", nil)
+	require.NoError(t, err)
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/login"},
+		Request:  req,
+		Response: &http.Response{StatusCode: 200, Header: http.Header{}},
+	}
+
+	// Redirected through the target to our host
+	payload := redirect.Inject(leaf).(string)
+	result.Redirects = []httpclient.Redirect{{
+		URL:        "http://localhost:3000/login",
+		StatusCode: 302,
+		Location:   "/session",
+		Header:     http.Header{"Location": []string{"/session"}},
+	}}
+	result.Response = &http.Response{StatusCode: 302, Header: http.Header{"Location": []string{payload}}}
+	findings, err := redirect.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, KindRedirect, findings[0].Kind)
+	require.Equal(t, "return_to", findings[0].Param)
+
+	// Payload reflected somewhere harmless
+	redirect.Inject(leaf)
+	result.Redirects = nil
+	result.Response = &http.Response{StatusCode: 302, Header: http.Header{"Location": []string{"/login?return_to=" + evilHost}}}
+	findings, err = redirect.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// CRLF injection
+	redirect.Inject(leaf)
+	payload = redirect.Inject(leaf).(string)
+	token := payload[len(payload)-12:]
+	result.Response = &http.Response{StatusCode: 200, Header: http.Header{injectedHeader: []string{token}}}
+	findings, err = redirect.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, KindHeader, findings[0].Kind)
+}
+
+func TestPayloadsReceived(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Query().Get("username")
+	}))
+	defer ts.Close()
+	target, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+	login := route.FromSwagger("../../route/test/query.json")[0]
+	login.MockData()
+
+	// CRLF sequences reach the target as is, not escaped a second time
+	for _, payload := range payloads {
+		sent := payload("athr1234")
+		for _, param := range login.Params {
+			param.Next = sent
+		}
+		req, err := login.ToHTTPRequest()
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, sent, received)
+		require.NotContains(t, received, "%")
+	}
+}
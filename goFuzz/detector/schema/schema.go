@@ -0,0 +1,131 @@
+package schema
+
+// Response validation against the swagger.  Every response is checked for a
+// status code the operation doesn't document, and JSON bodies are validated
+// against the schema declared for their status code.  Besides bugs, this
+// catches drift between the target and our swagger.
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of finding reported by this detector.  Undocumented status findings
+// are attributed to the status code, schema violations to the json path of
+// the offending value.
+const (
+	KindStatus = "undocumented-status"
+	KindSchema = "schema-violation"
+)
+
+// Only report this many violations per response, one bad schema can
+// otherwise flag every element of an array
+const maxViolations = 10
+
+// Array indices in json paths, dropped so a violation in any element is the
+// same finding
+var indexRe = regexp.MustCompile(`\[\d+\]`)
+
+// Detector for responses that don't match the swagger
+type Detector struct{}
+
+// New returns a response validator
+func New() *Detector {
+	return &Detector{}
+}
+
+// Inject is a no-op, we only look at responses
+func (schema *Detector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+// Reset is a no-op, nothing is injected
+func (schema *Detector) Reset() {}
+
+// response returns the documented response for the status code, or nil
+func response(op *spec.Operation, code int) *spec.Response {
+	if op.Responses == nil {
+		return nil
+	}
+	if resp, ok := op.Responses.StatusCodeResponses[code]; ok {
+		return &resp
+	}
+	return op.Responses.Default
+}
+
+// Check validates the status code and body of the most recent response
+func (schema *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	op := result.Route.Meta
+	// Nothing documented, nothing to check against
+	if op == nil || op.Responses == nil {
+		return nil, nil
+	}
+	code := result.Response.StatusCode
+	status := strconv.Itoa(code)
+
+	documented := response(op, code)
+	if documented == nil {
+		msg := fmt.Sprintf("status %d is not documented", code)
+		flagged := result.NewFinding(KindStatus, status, msg)
+		flagged.Details = bson.M{"Status": code, "Documented": documentedCodes(op)}
+		return []*finding.Finding{flagged}, nil
+	}
+
+	if documented.Schema == nil || !strings.Contains(result.Response.Header.Get("Content-Type"), "json") {
+		return nil, nil
+	}
+	var data interface{}
+	err := json.Unmarshal(result.Body, &data)
+	if err != nil {
+		msg := fmt.Sprintf("status %d body is not valid json", code)
+		flagged := result.NewFinding(KindSchema, "$", msg)
+		flagged.Details = bson.M{"Status": code, "Error": err.Error()}
+		return []*finding.Finding{flagged}, nil
+	}
+
+	findings := []*finding.Finding{}
+	reported := map[string]bool{}
+	for _, violation := range swagger.Validate(documented.Schema, data) {
+		if len(findings) == maxViolations {
+			break
+		}
+		// $[3].id and $[4].id are the same violation
+		param := indexRe.ReplaceAllString(violation.Path, "[]")
+		if reported[param] {
+			continue
+		}
+		reported[param] = true
+		msg := fmt.Sprintf("status %d body at %s: %s", code, violation.Path, violation.Message)
+		flagged := result.NewFinding(KindSchema, param, msg)
+		flagged.Details = bson.M{"Status": code, "Violation": violation.Message}
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
+
+// Verify checks if the response still violates the spec in the same way
+func (schema *Detector) Verify(found *finding.Finding, result *detector.Result) (bool, error) {
+	if result.Route.Meta == nil {
+		return false, detector.ErrUnverifiable
+	}
+	findings, err := schema.Check(result)
+	return detector.Reported(findings, found), err
+}
+
+// documentedCodes lists the status codes the operation documents
+func documentedCodes(op *spec.Operation) []int {
+	codes := []int{}
+	for code := range op.Responses.StatusCodeResponses {
+		codes = append(codes, code)
+	}
+	return codes
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/stretchr/testify/require"
+)
+
+func getRoute(t *testing.T, method string, path string) *route.Route {
+	routes := route.FromSwagger("../../swagger/test/discourseSwagger.json")
+	for _, route := range routes {
+		if route.Method == method && route.Path == path {
+			return route
+		}
+	}
+	require.FailNow(t, "no route", "%s %s", method, path)
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	route := getRoute(t, "GET", "/categories.json")
+	result := &detector.Result{
+		Route: route,
+		Response: &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		},
+		Body: []byte(`{"category_list": {"can_create_category": "yes", "categories": []}}`),
+	}
+	schema := New()
+	findings, err := schema.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, KindSchema, findings[0].Kind)
+	require.Equal(t, "$.category_list.can_create_category", findings[0].Param)
+
+	result.Body = []byte(`{"category_list": {"can_create_category": true, "categories": []}}`)
+	findings, err = schema.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// Violations in any element of an array are the same finding
+	result.Body = []byte(`{"category_list": {"can_create_category": true, "categories": [{"id": "a"}, {"id": "b"}]}}`)
+	findings, err = schema.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "$.category_list.categories[].id", findings[0].Param)
+
+	result.Response.StatusCode = 418
+	findings, err = schema.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, KindStatus, findings[0].Kind)
+	require.Equal(t, "418", findings[0].Param)
+}
@@ -0,0 +1,123 @@
+package ssrf
+
+// Server side request forgery detection.  Parameters that look like they hold
+// a URL are sent callback URLs pointing at the canary listener embedded in the
+// fuzzer, each with a unique token.  The same callback is also sent through
+// internal address spellings (loopback, decimal and hex IPs) to catch filters
+// that only block the obvious ones.  If the target ever requests a callback,
+// the hit is linked back to the request that carried its token.  Callbacks
+// made from background jobs are picked up whenever they arrive.
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/mruck/athena/goFuzz/canary"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "ssrf"
+
+// Parameter names that usually hold a URL
+var urlNameRe = regexp.MustCompile(`(?i)(url|uri|callback|webhook|endpoint)`)
+
+// Hosts the callback is sent to, in order.  Everything but the listener's own
+// host is an internal address, which only reaches the listener because the
+// fuzzer runs in the same pod as the target.
+func hosts(listener *canary.Listener) []string {
+	return []string{
+		listener.Host,
+		"127.0.0.1",
+		"[::1]",
+		// 127.0.0.1 in decimal and hex
+		"2130706433",
+		"0x7f000001",
+		"0",
+	}
+}
+
+// Detector for server side request forgery
+type Detector struct {
+	listener *canary.Listener
+	// Tokens injected since the last check
+	pending []detector.Pending
+	// Every token sent so far
+	origins detector.Origins
+	// Index of the next host to send for each leaf
+	next map[*swagger.Metadata]int
+	// Number of listener hits already processed
+	offset int
+}
+
+// New returns an ssrf detector injecting callbacks to the listener
+func New(listener *canary.Listener) *Detector {
+	return &Detector{
+		listener: listener,
+		origins:  detector.Origins{},
+		next:     map[*swagger.Metadata]int{},
+	}
+}
+
+// takesURL checks if the leaf looks like it holds a URL
+func takesURL(leaf *detector.Leaf) bool {
+	if leaf.Type != "string" {
+		return false
+	}
+	return leaf.Format == "uri" || leaf.Format == "url" || urlNameRe.MatchString(leaf.Name)
+}
+
+// Inject sends a callback through every URL leaf once for each host
+func (ssrf *Detector) Inject(leaf *detector.Leaf) interface{} {
+	if !takesURL(leaf) {
+		return nil
+	}
+	hosts := hosts(ssrf.listener)
+	i := ssrf.next[leaf.Metadata]
+	if i >= len(hosts) {
+		return nil
+	}
+	ssrf.next[leaf.Metadata] = i + 1
+
+	token := canary.NewToken()
+	payload := fmt.Sprintf("http://%s:%s/%s", hosts[i], ssrf.listener.Port, token)
+	ssrf.pending = append(ssrf.pending, detector.Pending{Token: token, Param: leaf.Name, Payload: payload})
+	return payload
+}
+
+// Reset drops payloads injected into a request that got no response, so
+// they aren't attributed to the next one
+func (ssrf *Detector) Reset() {
+	ssrf.pending = nil
+}
+
+// Check links callbacks received since the last check to the requests that
+// carried their tokens
+func (ssrf *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	// Attribute tokens sent in this request
+	ssrf.origins.Record(result, ssrf.pending...)
+	ssrf.pending = nil
+
+	findings := []*finding.Finding{}
+	hits := ssrf.listener.Hits(ssrf.offset)
+	ssrf.offset += len(hits)
+	for _, hit := range hits {
+		sent, ok := ssrf.origins[hit.Token]
+		// Someone else's token
+		if !ok {
+			continue
+		}
+		msg := fmt.Sprintf("target requested %s sent in %s", sent.Payload, sent.Param)
+		flagged := sent.NewFinding(Kind, msg)
+		flagged.Details = bson.M{
+			"Payload": sent.Payload,
+			"Hit":     hit,
+			"Delay":   hit.Time.Sub(sent.Sent),
+		}
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
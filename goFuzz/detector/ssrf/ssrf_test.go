@@ -0,0 +1,63 @@
+package ssrf
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/canary"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTakesURL(t *testing.T) {
+	require.True(t, takesURL(&detector.Leaf{Name: "avatar_url", Type: "string"}))
+	require.True(t, takesURL(&detector.Leaf{Name: "payload", Type: "string", Format: "uri"}))
+	require.True(t, takesURL(&detector.Leaf{Name: "webhook", Type: "string"}))
+	require.False(t, takesURL(&detector.Leaf{Name: "title", Type: "string"}))
+	require.False(t, takesURL(&detector.Leaf{Name: "url_count", Type: "integer"}))
+}
+
+func TestCallback(t *testing.T) {
+	listener := &canary.Listener{Host: "localhost", Port: "0"}
+	require.NoError(t, listener.Start())
+	defer listener.Close()
+	ssrf := New(listener)
+
+	param := &spec.Parameter{}
+	param.Name = "url"
+	param.In = "query"
+	param.Type = "string"
+	leaf := detector.NewLeaf(param, &swagger.Metadata{Name: "url"})
+
+	// Every host is sent once
+	payloads := []string{}
+	for payload := ssrf.Inject(leaf); payload != nil; payload = ssrf.Inject(leaf) {
+		payloads = append(payloads, payload.(string))
+	}
+	require.Len(t, payloads, len(hosts(listener)))
+
+	// The target fetched the first payload, which points at the listener
+	resp, err := http.Get(payloads[0])
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	result := &detector.Result{
+		Route: &route.Route{Method: "POST", Path: "/webhooks"},
+		Curl:  "curl",
+	}
+	findings, err := ssrf.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, Kind, findings[0].Kind)
+	require.Equal(t, "url", findings[0].Param)
+	require.Equal(t, "/webhooks", findings[0].Path)
+	require.Equal(t, payloads[0], findings[0].Details["Payload"])
+
+	// Hits are only reported once
+	findings, err = ssrf.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
@@ -0,0 +1,276 @@
+package traversal
+
+// Path traversal and file disclosure detection.  Parameters whose name or
+// value looks like a file path are sent traversal payloads reaching for
+// /etc/passwd, win.ini, and a canary file we write to the shared results
+// mount.  Responses are scanned for the contents of those files.  When the
+// target is instrumented to log the files it opens, those events are a
+// stronger oracle since they catch traversals whose contents never make it
+// into the response.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kind of finding reported by this detector
+const Kind = "path-traversal"
+
+// File in the results directory the instrumentation logs file opens to, one
+// json object per line
+const EventsFile = "file_opens.json"
+
+// File in the results directory we plant for the target to disclose
+const canaryFile = "athena_traversal_canary"
+
+// Number of ../ to prepend, enough to reach / from anywhere reasonable
+const depth = 10
+
+// Parameter names that usually hold a file path
+var fileNameRe = regexp.MustCompile(`(?i)(file|path|dir|folder|template|page|doc|download|include|attachment|upload|resource|locale|lang|theme|src)`)
+
+// Values that look like file paths: contain a separator or end in an
+// extension
+var fileValueRe = regexp.MustCompile(`[/\\]|^[\w-]+\.[a-zA-Z0-9]{1,5}$`)
+
+// Contents of well known files
+var signatures = map[string]*regexp.Regexp{
+	"/etc/passwd": regexp.MustCompile(`root:[^:\n]*:0:0:`),
+	"win.ini":     regexp.MustCompile(`; for 16-bit app support`),
+}
+
+// FileEvent is a file opened by the target, as logged by the instrumentation
+type FileEvent struct {
+	Path string
+	Mode string
+}
+
+// Detector for path traversal
+type Detector struct {
+	// Absolute path of the canary file and its contents.  Empty if we
+	// couldn't write it.
+	canaryPath    string
+	canaryContent string
+	// File opens logged by the instrumentation
+	events *util.Tailer
+	// Index of the next payload to send for each leaf
+	next map[*swagger.Metadata]int
+	// Payloads injected since the last check, by the file they target
+	pending []detector.Pending
+}
+
+// New returns a path traversal detector.  resultsPath is the directory shared
+// with the target.
+func New(resultsPath string) *Detector {
+	traversal := &Detector{
+		events: util.NewTailer(filepath.Join(resultsPath, EventsFile)),
+		next:   map[*swagger.Metadata]int{},
+	}
+
+	// Plant a canary file the target can read.  Its contents are long enough
+	// that no response contains them by chance.
+	canaryPath := filepath.Join(resultsPath, canaryFile)
+	content := "athena" + strings.Replace(uuid.New().String(), "-", "", -1)
+	err := ioutil.WriteFile(canaryPath, []byte(content+"\n"), 0644)
+	if err != nil {
+		log.Warnf("not using a traversal canary: %+v", errors.WithStack(err))
+		return traversal
+	}
+	traversal.canaryPath = canaryPath
+	traversal.canaryContent = content
+	return traversal
+}
+
+// payloads returns the values sent through each leaf, in order.  They're
+// spelled raw since the request is url encoded when it's built.
+func (traversal *Detector) payloads() []string {
+	up := strings.Repeat("../", depth)
+	payloads := []string{}
+	if traversal.canaryPath != "" {
+		payloads = append(payloads,
+			up+strings.TrimPrefix(traversal.canaryPath, "/"),
+			traversal.canaryPath)
+	}
+	return append(payloads,
+		up+"etc/passwd",
+		"/etc/passwd",
+		// Survives naive removal of ../
+		strings.Repeat("....//", depth)+"etc/passwd",
+		// Truncates a forced extension
+		up+"etc/passwd\x00.png",
+		strings.Repeat(`..\`, depth)+`windows\win.ini`,
+	)
+}
+
+// takesPath checks if the leaf looks like it holds a file path
+func takesPath(leaf *detector.Leaf) bool {
+	if leaf.Type != "string" || leaf.In == "header" {
+		return false
+	}
+	if fileNameRe.MatchString(leaf.Name) {
+		return true
+	}
+	if len(leaf.Metadata.Values) > 0 {
+		if value, ok := leaf.Metadata.Values[0].(string); ok {
+			return fileValueRe.MatchString(value)
+		}
+	}
+	return false
+}
+
+// Inject sends each payload once through every leaf that looks like a path
+func (traversal *Detector) Inject(leaf *detector.Leaf) interface{} {
+	if !takesPath(leaf) {
+		return nil
+	}
+	payloads := traversal.payloads()
+	i := traversal.next[leaf.Metadata]
+	if i >= len(payloads) {
+		return nil
+	}
+	traversal.next[leaf.Metadata] = i + 1
+	traversal.pending = append(traversal.pending, detector.Pending{
+		Token:   traversal.target(payloads[i]),
+		Param:   leaf.Name,
+		Payload: payloads[i],
+	})
+	return payloads[i]
+}
+
+// Reset drops payloads injected into a request that got no response, so
+// they aren't attributed to the next one
+func (traversal *Detector) Reset() {
+	traversal.pending = nil
+}
+
+// target returns the file a payload or opened path reaches for, or the empty
+// string
+func (traversal *Detector) target(path string) string {
+	lowered := strings.ToLower(strings.Replace(path, `\`, "/", -1))
+	switch {
+	case traversal.canaryPath != "" && strings.Contains(path, canaryFile):
+		return traversal.canaryPath
+	case strings.Contains(lowered, "etc/passwd"):
+		return "/etc/passwd"
+	case strings.HasSuffix(lowered, "win.ini"):
+		return "win.ini"
+	}
+	return ""
+}
+
+// origin returns the payload that targeted file, if any
+func origin(injected []detector.Pending, file string) (detector.Pending, bool) {
+	for _, sent := range injected {
+		if file != "" && sent.Token == file {
+			return sent, true
+		}
+	}
+	return detector.Pending{}, false
+}
+
+// Check looks for disclosed files in the response and for files opened by the
+// target while handling the request
+func (traversal *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	injected := traversal.pending
+	traversal.pending = nil
+
+	findings := []*finding.Finding{}
+
+	// Only trust file contents in responses to a payload reaching for that
+	// file, plenty of pages talk about /etc/passwd
+	file := traversal.disclosed(result.Body)
+	if sent, ok := origin(injected, file); ok {
+		msg := fmt.Sprintf("response contains %s after sending %s in %s", file, sent.Payload, sent.Param)
+		flagged := result.NewFinding(Kind, sent.Param, msg)
+		flagged.Details = bson.M{"Payload": sent.Payload, "File": file, "Oracle": "response"}
+		findings = append(findings, flagged)
+	}
+
+	events, err := traversal.readEvents()
+	if err != nil {
+		return findings, err
+	}
+	for _, event := range events {
+		if !traversal.sensitive(event.Path, len(injected) > 0) {
+			continue
+		}
+		// Attribute the open to the payload reaching for the same file
+		sent, ok := origin(injected, traversal.target(event.Path))
+		msg := fmt.Sprintf("target opened %s", event.Path)
+		if ok {
+			msg += fmt.Sprintf(" after sending %s in %s", sent.Payload, sent.Param)
+		}
+		flagged := result.NewFinding(Kind, sent.Param, msg)
+		flagged.Details = bson.M{"Payload": sent.Payload, "File": event.Path, "Mode": event.Mode, "Oracle": "instrumentation"}
+		findings = append(findings, flagged)
+	}
+	return findings, nil
+}
+
+// Verify checks if the response to the reproducer still discloses a file.
+// Files opened are only attributed to requests while fuzzing, so findings from
+// the instrumentation can't be verified.
+func (traversal *Detector) Verify(found *finding.Finding, result *detector.Result) (bool, error) {
+	if found.Details["Oracle"] != "response" {
+		return false, detector.ErrUnverifiable
+	}
+	return traversal.disclosed(result.Body) != "", nil
+}
+
+// disclosed returns the file whose contents are in body, or the empty string
+func (traversal *Detector) disclosed(body []byte) string {
+	if traversal.canaryContent != "" && strings.Contains(string(body), traversal.canaryContent) {
+		return traversal.canaryPath
+	}
+	for file, signature := range signatures {
+		if signature.Match(body) {
+			return file
+		}
+	}
+	return ""
+}
+
+// sensitive checks if the target had no business opening path.  Paths that
+// weren't normalized are only suspicious if we just sent a payload.
+func (traversal *Detector) sensitive(path string, injected bool) bool {
+	clean := filepath.Clean(path)
+	if clean == "/etc/passwd" || strings.HasSuffix(strings.ToLower(path), "win.ini") {
+		return true
+	}
+	if traversal.canaryPath != "" && clean == traversal.canaryPath {
+		return true
+	}
+	return injected && strings.Contains(path, "..")
+}
+
+// readEvents returns the files opened since the last check
+func (traversal *Detector) readEvents() ([]FileEvent, error) {
+	lines, err := traversal.events.ReadLines()
+	if err != nil {
+		return nil, err
+	}
+	events := []FileEvent{}
+	for _, line := range lines {
+		event := FileEvent{}
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			log.Warnf("bad file event %q: %+v", line, errors.WithStack(err))
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
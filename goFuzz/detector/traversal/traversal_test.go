@@ -0,0 +1,182 @@
+package traversal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/stretchr/testify/require"
+)
+
+func newLeaf(name string, values ...interface{}) *detector.Leaf {
+	param := &spec.Parameter{}
+	param.Name = name
+	param.In = "query"
+	param.Type = "string"
+	return detector.NewLeaf(param, &swagger.Metadata{Name: name, Values: values})
+}
+
+func TestTakesPath(t *testing.T) {
+	require.True(t, takesPath(newLeaf("filename")))
+	require.True(t, takesPath(newLeaf("name", "logo.png")))
+	require.True(t, takesPath(newLeaf("name", "images/logo")))
+	require.False(t, takesPath(newLeaf("name", "bob")))
+	require.False(t, takesPath(newLeaf("title")))
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traversal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	traversal := New(dir)
+	require.Len(t, traversal.canaryContent, len("athena")+32)
+
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/download"},
+		Response: &http.Response{StatusCode: 200},
+		Body:     []byte("root:x:0:0:root:/root:/bin/bash\n"),
+	}
+
+	// We didn't send anything
+	findings, err := traversal.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// Part of the canary turns up by chance, e.g. in an asset digest
+	leaf := newLeaf("file")
+	payload := traversal.Inject(leaf)
+	result.Body = []byte(`<script src="/assets/app-` + traversal.canaryContent[6:10] + `.js">`)
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// The canary is disclosed
+	payload = traversal.Inject(leaf)
+	require.Contains(t, payload, canaryFile)
+	result.Body = []byte("<pre>" + traversal.canaryContent + "</pre>")
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "file", findings[0].Param)
+	require.Equal(t, traversal.canaryPath, findings[0].Details["File"])
+
+	// The instrumentation saw us open /etc/passwd
+	traversal.Inject(leaf)
+	result.Body = []byte("not found")
+	events := `{"Path": "/app/public/../../etc/passwd", "Mode": "r"}` + "\n" +
+		`{"Path": "/app/config/locales/en.yml", "Mode": "r"}` + "\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, EventsFile), []byte(events), 0644))
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "instrumentation", findings[0].Details["Oracle"])
+	require.Equal(t, "file", findings[0].Param)
+}
+
+func TestCheckAttribution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traversal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	traversal := New(dir)
+	result := &detector.Result{
+		Route:    &route.Route{Method: "GET", Path: "/download"},
+		Response: &http.Response{StatusCode: 200},
+		Body:     []byte("root:x:0:0:root:/root:/bin/bash\n"),
+	}
+
+	// Both leaves get payloads, only one reaches for /etc/passwd
+	canary, passwd := newLeaf("file"), newLeaf("template")
+	traversal.Inject(canary)
+	for i := 0; i < 2; i++ {
+		traversal.Inject(passwd)
+	}
+	payload := traversal.Inject(passwd)
+	findings, err := traversal.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "template", findings[0].Param)
+	require.Equal(t, payload, findings[0].Details["Payload"])
+
+	// Nothing we sent reached for the disclosed file
+	traversal.Inject(canary)
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+
+	// Opened files are attributed the same way
+	traversal.Inject(newLeaf("file"))
+	traversal.Inject(passwd)
+	result.Body = []byte("not found")
+	events := `{"Path": "` + traversal.canaryPath + `", "Mode": "r"}` + "\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, EventsFile), []byte(events), 0644))
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Equal(t, "file", findings[0].Param)
+
+	// Payloads sent in a request that got no response aren't attributed to
+	// the next one
+	traversal.Inject(passwd)
+	traversal.Reset()
+	result.Body = []byte("root:x:0:0:root:/root:/bin/bash\n")
+	findings, err = traversal.Check(result)
+	require.NoError(t, err)
+	require.Empty(t, findings)
+}
+
+func TestSensitive(t *testing.T) {
+	traversal := &Detector{canaryPath: "/tmp/results/" + canaryFile}
+	require.True(t, traversal.sensitive("/etc/passwd", false))
+	require.True(t, traversal.sensitive("/tmp/results/../results/"+canaryFile, false))
+	require.True(t, traversal.sensitive(`C:\windows\WIN.INI`, false))
+	require.False(t, traversal.sensitive("/app/../app/config.yml", false))
+	require.True(t, traversal.sensitive("/app/../app/config.yml", true))
+}
+
+func TestPayloadsReceived(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/pet/") {
+			received = strings.TrimPrefix(r.URL.Path, "/pet/")
+		} else {
+			received = r.URL.Query().Get("username")
+		}
+	}))
+	defer ts.Close()
+	target, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+
+	query := route.FromSwagger("../../route/test/query.json")[0]
+	query.MockData()
+	path := route.FromSwagger("../../route/test/path.json")[0]
+	path.MockData()
+
+	// The target sees exactly what we meant to send, encoded once
+	traversal := &Detector{canaryPath: "/tmp/results/" + canaryFile}
+	for _, payload := range traversal.payloads() {
+		for _, r := range []*route.Route{query, path} {
+			for _, param := range r.Params {
+				param.Next = payload
+			}
+			req, err := r.ToHTTPRequest()
+			require.NoError(t, err)
+			_, err = client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, payload, received, "%s %s", r.Method, r.Path)
+			// Nothing was escaped twice
+			require.NotContains(t, received, "%", "%s %s", r.Method, r.Path)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package xss
+
+// Reflected and stored cross site scripting detection.  Every string leaf is
+// sent a unique canary wrapped in markup.  Every response is scanned for
+// canaries that come back unescaped in a dangerous context.  A canary
+// observed on the request it was injected in is reflected, a canary observed
+// anywhere else was stored by the target.  GET routes are periodically
+// re-fetched so stored canaries have a chance to show up.
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/goFuzz/swagger"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of finding reported by this detector
+const (
+	KindReflected = "xss-reflected"
+	KindStored    = "xss-stored"
+)
+
+// Contexts a canary can be observed in
+const (
+	tagContext       = "tag"
+	attributeContext = "attribute"
+	scriptContext    = "script"
+	urlContext       = "url"
+	jsonContext      = "json"
+)
+
+// Every canary starts with this prefix so we can find them in responses
+const canaryPrefix = "athx"
+
+var canaryRe = regexp.MustCompile(canaryPrefix + `[0-9a-f]{8}`)
+
+// Markup that breaks out of attribute values and text into a new tag
+const breakout = `"'><`
+
+// Payloads wrapping a canary, tried in order for each leaf
+var payloads = []func(canary string) string{
+	func(canary string) string { return breakout + canary + ">" },
+	func(canary string) string { return "javascript:" + canary },
+}
+
+// Attributes whose value is loaded as a URL
+var urlAttributeRe = regexp.MustCompile(`(?i)(href|src|action|formaction|data)\s*=\s*["']?$`)
+
+// Re-fetch GET routes after this many requests
+const refetchInterval = 100
+
+// canary tracks where a canary was injected
+type canary struct {
+	Method string `bson:"Method"`
+	Path   string `bson:"Path"`
+	Param  string `bson:"Param"`
+	Curl   string `bson:"Curl"`
+}
+
+// observation of a canary in a response
+type observation struct {
+	canary  string
+	context string
+}
+
+// Detector for cross site scripting
+type Detector struct {
+	// Canaries injected since the last check, keyed by canary
+	pending map[string]string
+	// All canaries sent so far
+	canaries map[string]*canary
+	// Index of the next payload to send for each leaf
+	next map[*swagger.Metadata]int
+	// GET routes that have returned 2xx, for re-fetching
+	getRoutes []*route.Route
+	requests  int
+}
+
+// New returns a cross site scripting detector
+func New() *Detector {
+	return &Detector{
+		pending:  map[string]string{},
+		canaries: map[string]*canary{},
+		next:     map[*swagger.Metadata]int{},
+	}
+}
+
+// newCanary returns a unique string to look for in responses
+func newCanary() string {
+	return canaryPrefix + strings.Replace(uuid.New().String(), "-", "", -1)[:8]
+}
+
+// Inject sends each payload once through every string leaf
+func (xss *Detector) Inject(leaf *detector.Leaf) interface{} {
+	if leaf.Type != "string" {
+		return nil
+	}
+	i := xss.next[leaf.Metadata]
+	if i >= len(payloads) {
+		return nil
+	}
+	xss.next[leaf.Metadata] = i + 1
+
+	canary := newCanary()
+	xss.pending[canary] = leaf.Name
+	return payloads[i](canary)
+}
+
+// Reset drops canaries injected into a request that got no response
+func (xss *Detector) Reset() {
+	xss.pending = map[string]string{}
+}
+
+// Check scans the response for canaries, then periodically re-fetches GET
+// routes to look for stored canaries
+func (xss *Detector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	// Attribute canaries sent in this request
+	for canaryStr, param := range xss.pending {
+		xss.canaries[canaryStr] = &canary{
+			Method: result.Route.Method,
+			Path:   result.Route.Path,
+			Param:  param,
+			Curl:   result.Curl,
+		}
+	}
+	xss.pending = map[string]string{}
+
+	findings := xss.scan(result.Route, result.Response, result.Body)
+
+	// Remember GET routes for re-fetching
+	if result.Route.Method == "GET" &&
+		result.Response.StatusCode >= 200 && result.Response.StatusCode < 300 {
+		xss.addGetRoute(result.Route)
+	}
+
+	xss.requests++
+	if xss.requests%refetchInterval == 0 {
+		findings = append(findings, xss.refetch(result)...)
+	}
+	return findings, nil
+}
+
+// Verify checks if the canary in a reflected finding's reproducer is still
+// observed unescaped.  Stored findings need the route they were observed on
+// re-fetched after the reproducer, so they can't be verified.
+func (xss *Detector) Verify(found *finding.Finding, result *detector.Result) (bool, error) {
+	canary, ok := found.Details["Canary"].(string)
+	if found.Kind != KindReflected || !ok {
+		return false, detector.ErrUnverifiable
+	}
+	for _, observed := range scan(string(result.Body), result.Response.Header.Get("Content-Type")) {
+		if observed.canary == canary {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (xss *Detector) addGetRoute(route *route.Route) {
+	for _, seen := range xss.getRoutes {
+		if seen == route {
+			return
+		}
+	}
+	xss.getRoutes = append(xss.getRoutes, route)
+}
+
+// refetch re-sends the most recent request for every GET route we know of and
+// scans the responses for stored canaries
+func (xss *Detector) refetch(result *detector.Result) []*finding.Finding {
+	findings := []*finding.Finding{}
+	for _, route := range xss.getRoutes {
+		req, err := route.ToHTTPRequest()
+		if err != nil {
+			log.Warnf("%+v", err)
+			continue
+		}
+		resp, body, err := detector.Send(result.Client, req)
+		if err != nil {
+			log.Warnf("%+v", err)
+			continue
+		}
+		findings = append(findings, xss.scan(route, resp, body)...)
+	}
+	return findings
+}
+
+// scan looks for canaries in a response from route
+func (xss *Detector) scan(route *route.Route, resp *http.Response, body []byte) []*finding.Finding {
+	findings := []*finding.Finding{}
+	contentType := resp.Header.Get("Content-Type")
+	for _, observed := range scan(string(body), contentType) {
+		injected, ok := xss.canaries[observed.canary]
+		// We didn't send this
+		if !ok {
+			continue
+		}
+		kind := KindReflected
+		if injected.Method != route.Method || injected.Path != route.Path {
+			kind = KindStored
+		}
+		msg := fmt.Sprintf("canary sent in %s to %s %s observed unescaped in %s context of %s %s",
+			injected.Param, injected.Method, injected.Path, observed.context, route.Method, route.Path)
+		findings = append(findings, &finding.Finding{
+			Kind:    kind,
+			Method:  injected.Method,
+			Path:    injected.Path,
+			Param:   injected.Param,
+			Message: msg,
+			Curl:    injected.Curl,
+			Details: bson.M{
+				"Canary":         observed.canary,
+				"Context":        observed.context,
+				"ContentType":    contentType,
+				"ObservedMethod": route.Method,
+				"ObservedPath":   route.Path,
+			},
+		})
+	}
+	return findings
+}
+
+// scan returns every canary found unescaped in a dangerous context.  Only
+// HTML and JSON responses are considered.
+func scan(body string, contentType string) []observation {
+	isJSON := strings.Contains(contentType, "json")
+	isHTML := contentType == "" || strings.Contains(contentType, "html")
+	if !isJSON && !isHTML {
+		return nil
+	}
+
+	observations := []observation{}
+	lowered := lowerASCII(body)
+	for _, loc := range canaryRe.FindAllStringIndex(body, -1) {
+		context := classify(body, lowered, loc[0], loc[1])
+		if context == "" {
+			continue
+		}
+		if isJSON {
+			context = jsonContext
+		}
+		observations = append(observations, observation{canary: body[loc[0]:loc[1]], context: context})
+	}
+	return observations
+}
+
+// classify returns the context the canary at body[start:end] was reflected in,
+// or the empty string if it was escaped
+func classify(body string, lowered string, start int, end int) string {
+	// Our javascript: url landed in an attribute loading a url
+	scheme := "javascript:"
+	if strings.HasSuffix(lowered[:start], scheme) {
+		// Only look at the attribute immediately before the url
+		attrEnd := start - len(scheme)
+		attrStart := attrEnd - 32
+		if attrStart < 0 {
+			attrStart = 0
+		}
+		if urlAttributeRe.MatchString(body[attrStart:attrEnd]) {
+			return urlContext
+		}
+		return ""
+	}
+
+	// The markup around the canary is escaped
+	if !strings.HasSuffix(body[:start], "<") || !strings.HasPrefix(body[end:], ">") {
+		return ""
+	}
+
+	// We broke out of a string inside a script block
+	if insideScript(lowered, start) {
+		return scriptContext
+	}
+
+	// We broke out of an attribute value
+	if strings.HasSuffix(body[:start], breakout) && insideTag(body, start-len(breakout)) {
+		return attributeContext
+	}
+	return tagContext
+}
+
+// insideScript checks if index i is inside a <script> block
+func insideScript(lowered string, i int) bool {
+	open := strings.LastIndex(lowered[:i], "<script")
+	closed := strings.LastIndex(lowered[:i], "</script")
+	return open > closed
+}
+
+// insideTag checks if index i is inside a tag, i.e. between < and >
+func insideTag(body string, i int) bool {
+	return strings.LastIndex(body[:i], "<") > strings.LastIndex(body[:i], ">")
+}
+
+// lowerASCII lower cases ASCII letters only so that indices into the result
+// are valid indices into s
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,79 @@
+package xss
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const testCanary = canaryPrefix + "0123abcd"
+
+type scanTest struct {
+	body        string
+	contentType string
+	context     string
+}
+
+func TestScan(t *testing.T) {
+	table := []scanTest{
+		// Markup rendered as is
+		{"<p>" + breakout + testCanary + "></p>", "text/html", tagContext},
+		// Broke out of an attribute value
+		{`<input value="` + breakout + testCanary + `>">`, "text/html", attributeContext},
+		// Broke out of a string in a script
+		{`<SCRIPT>var x = '` + breakout + testCanary + `>';</SCRIPT>`, "text/html", scriptContext},
+		// Script url in a link
+		{`<a href="javascript:` + testCanary + `">`, "text/html", urlContext},
+		// Unescaped markup in json
+		{`{"name": "\"'><` + testCanary + `>"}`, "application/json", jsonContext},
+		// Escaped markup is fine
+		{"<p>&quot;&#39;&gt;&lt;" + testCanary + "&gt;</p>", "text/html", ""},
+		{`{"name": "\"'\u003e\u003c` + testCanary + `\u003e"}`, "application/json", ""},
+		// Script urls as text are fine
+		{"<p>javascript:" + testCanary + "</p>", "text/html", ""},
+		// Plain text can't be rendered
+		{breakout + testCanary + ">", "text/plain", ""},
+	}
+	for _, test := range table {
+		observations := scan(test.body, test.contentType)
+		if test.context == "" {
+			require.Empty(t, observations, test.body)
+			continue
+		}
+		require.Len(t, observations, 1, test.body)
+		require.Equal(t, testCanary, observations[0].canary)
+		require.Equal(t, test.context, observations[0].context, test.body)
+	}
+}
+
+func TestCanary(t *testing.T) {
+	canary := newCanary()
+	require.True(t, canaryRe.MatchString(canary))
+	require.NotEqual(t, canary, newCanary())
+}
+
+func TestVerify(t *testing.T) {
+	found := &finding.Finding{Kind: KindReflected, Details: bson.M{"Canary": testCanary}}
+	result := &detector.Result{
+		Response: &http.Response{Header: http.Header{"Content-Type": []string{"text/html"}}},
+		Body:     []byte("<p>" + breakout + testCanary + "></p>"),
+	}
+	reproduced, err := New().Verify(found, result)
+	require.NoError(t, err)
+	require.True(t, reproduced)
+
+	// Fixed by escaping
+	result.Body = []byte("<p>&quot;&#39;&gt;&lt;" + testCanary + "&gt;</p>")
+	reproduced, err = New().Verify(found, result)
+	require.NoError(t, err)
+	require.False(t, reproduced)
+
+	// Stored findings need a re-fetch
+	found.Kind = KindStored
+	_, err = New().Verify(found, result)
+	require.Equal(t, detector.ErrUnverifiable, err)
+}
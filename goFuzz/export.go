@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/mruck/athena/goFuzz/export"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/lib/database"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+)
+
+// exportMain writes the open exceptions and findings for a target as SARIF or
+// JUnit XML
+func exportMain(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	targetID := flags.String("target", os.Getenv("TARGET_ID"), "target id to export findings for")
+	format := flags.String("format", "sarif", "sarif or junit")
+	output := flags.String("o", "", "file to write to, stdout by default")
+	_ = flags.Parse(args)
+	util.Must(*targetID != "", "no target id, pass -target or set TARGET_ID")
+
+	db := database.MustGetDatabase(database.MongoDbPort, "athena")
+	exceptions, err := exception.NewExceptionsManager(db, "").ReadAll(*targetID)
+	util.Must(err == nil, "%+v", err)
+	findings, err := finding.NewFindingsManager(db).GetAll(*targetID)
+	util.Must(err == nil, "%+v", err)
+
+	var data []byte
+	switch *format {
+	case "sarif":
+		data, err = json.MarshalIndent(export.Sarif(exceptions, findings), "", "  ")
+	case "junit":
+		// Every route in the spec gets a test case
+		routes := []string{}
+		for _, r := range route.FromSwagger(swaggerPath) {
+			routes = append(routes, r.Method+" "+r.Path)
+		}
+		data, err = xml.MarshalIndent(export.JUnit(routes, exceptions, findings), "", "  ")
+		data = append([]byte(xml.Header), data...)
+	default:
+		log.Fatalf("unknown format %q, expected sarif or junit", *format)
+	}
+	util.Must(err == nil, "%+v", errors.WithStack(err))
+
+	if *output == "" {
+		_, err = os.Stdout.Write(append(data, '\n'))
+	} else {
+		err = ioutil.WriteFile(*output, data, 0644)
+	}
+	util.Must(err == nil, "%+v", errors.WithStack(err))
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/stretchr/testify/require"
+)
+
+var exceptions = []exception.Exception{
+	{
+		Method:   "GET",
+		Path:     "/posts/{id}",
+		Class:    "NoMethodError",
+		Message:  "undefined method `name' for nil:NilClass",
+		Curl:     "curl 'http://localhost:3000/posts/1?a=b'",
+		Severity: exception.High,
+		Backtrace: []string{
+			"/usr/local/bundle/gems/activerecord-5.2.3/lib/active_record/core.rb:177:in `find'",
+			"/var/www/discourse/app/models/post.rb:42:in `owner'",
+			"/var/www/discourse/app/controllers/posts_controller.rb:123:in `show'",
+		},
+		Fingerprint: "abc",
+		Count:       3,
+		Routes:      []string{"GET /posts/{id}", "GET /posts/{id}/edit"},
+	},
+	// No backtrace
+	{Method: "DELETE", Path: "/posts/{id}", Class: "ArgumentError", Severity: exception.Low},
+	// Fixed
+	{Method: "GET", Path: "/users", Class: "ArgumentError", Closed: true},
+}
+
+var findings = []finding.Finding{
+	{
+		Kind:          "xss-reflected",
+		Method:        "POST",
+		Path:          "/posts",
+		Param:         "title",
+		Message:       "canary observed unescaped",
+		Curl:          "curl -X 'POST' 'http://localhost:3000/posts'",
+		MinimizedCurl: "curl -X 'POST' 'http://localhost:3000/posts?t=1'",
+	},
+	{Kind: schema.KindStatus, Method: "GET", Path: "/posts/{id}", Param: "500", Message: "status 500 is not documented"},
+}
+
+func TestSarif(t *testing.T) {
+	log := Sarif(exceptions, findings)
+	require.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	require.Len(t, run.Results, 4)
+	ids := []string{}
+	for _, rule := range run.Tool.Driver.Rules {
+		ids = append(ids, rule.ID)
+	}
+	require.Equal(t, []string{"exception/ArgumentError", "exception/NoMethodError", schema.KindStatus, "xss-reflected"}, ids)
+
+	// The exception points at the innermost app frame
+	exc := run.Results[0]
+	require.Equal(t, "warning", exc.Level)
+	require.Equal(t, "app/models/post.rb", exc.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	require.Equal(t, 42, exc.Locations[0].PhysicalLocation.Region.StartLine)
+	require.Len(t, exc.Stacks[0].Frames, 2)
+	require.Equal(t, "abc", exc.PartialFingerprints["athenaFingerprint/v1"])
+	// Every route it was raised on
+	routes := []string{}
+	for _, location := range exc.Locations[0].LogicalLocations {
+		routes = append(routes, location.Name)
+	}
+	require.Equal(t, exceptions[0].Routes, routes)
+
+	// Without a backtrace there's only the route
+	noBacktrace := run.Results[1]
+	require.Nil(t, noBacktrace.Locations[0].PhysicalLocation)
+	require.Equal(t, "DELETE /posts/{id}", noBacktrace.Locations[0].LogicalLocations[0].Name)
+
+	// Findings carry the route, parameter and reproducers
+	xss := run.Results[2]
+	require.Equal(t, "error", xss.Level)
+	require.Nil(t, xss.Locations[0].PhysicalLocation)
+	require.Equal(t, "title", xss.Locations[0].LogicalLocations[1].Name)
+	require.Equal(t, findings[0].MinimizedCurl, xss.Properties.MinimizedReproducer)
+	require.Equal(t, "note", run.Results[3].Level)
+
+	data, err := json.Marshal(log)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"$schema":"https://json.schemastore.org/sarif-2.1.0.json"`)
+}
+
+func TestJUnit(t *testing.T) {
+	routes := []string{"GET /posts/{id}", "GET /users", "DELETE /posts/{id}"}
+	report := JUnit(routes, exceptions, findings)
+	require.Equal(t, 5, report.Tests)
+	require.Equal(t, 4, report.Failures)
+
+	cases := map[string]JUnitCase{}
+	for _, c := range report.Suites[0].Cases {
+		cases[c.Name] = c
+	}
+	require.Nil(t, cases["GET /users"].Failure)
+	require.Equal(t, "exception", cases["DELETE /posts/{id}"].Failure.Type)
+	require.Equal(t, "exception,"+schema.KindStatus, cases["GET /posts/{id}"].Failure.Type)
+	// Every route the exception was raised on fails
+	require.Contains(t, cases["GET /posts/{id}/edit"].Failure.Text, "NoMethodError")
+	// Routes missing from the spec are added
+	require.Contains(t, cases["POST /posts"].Failure.Text, findings[0].MinimizedCurl)
+
+	data, err := xml.Marshal(report)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `<testsuites name="athena" tests="5" failures="4">`)
+}
@@ -0,0 +1,138 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+)
+
+// JUnitSuites is the top level JUnit XML document
+type JUnitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []JUnitSuite `xml:"testsuite"`
+}
+
+// JUnitSuite groups a test case per route
+type JUnitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []JUnitCase `xml:"testcase"`
+}
+
+// JUnitCase is a route, failing if anything was found on it
+type JUnitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+}
+
+// JUnitFailure lists everything found on a route
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// problem found on a route
+type problem struct {
+	kind   string
+	detail string
+}
+
+// JUnit converts open exceptions and findings to a JUnit report with a test
+// case for every route, as "METHOD path".  Routes something was found on are
+// added if they're missing.
+func JUnit(routes []string, exceptions []exception.Exception, findings []finding.Finding) *JUnitSuites {
+	problems := map[string][]problem{}
+	for _, route := range routes {
+		problems[route] = nil
+	}
+	for _, exc := range exceptions {
+		if exc.Closed {
+			continue
+		}
+		// Every route the exception was raised on fails
+		detail := fmt.Sprintf("%s: %s\n%s", exc.Class, exc.Message, reproducer(exc.Curl, exc.MinimizedCurl))
+		for _, route := range exceptionRoutes(exc) {
+			problems[route] = append(problems[route], problem{kind: "exception", detail: detail})
+		}
+	}
+	for _, found := range findings {
+		if found.Closed {
+			continue
+		}
+		route := found.Method + " " + found.Path
+		detail := fmt.Sprintf("%s: %s\n%s", found.Kind, found.Message, reproducer(found.Curl, found.MinimizedCurl))
+		problems[route] = append(problems[route], problem{kind: found.Kind, detail: detail})
+	}
+
+	names := []string{}
+	for name := range problems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suite := JUnitSuite{Name: "athena"}
+	for _, name := range names {
+		testCase := JUnitCase{Name: name, ClassName: "athena"}
+		found := problems[name]
+		if len(found) > 0 {
+			kinds := []string{}
+			details := []string{}
+			for _, p := range found {
+				if !contains(kinds, p.kind) {
+					kinds = append(kinds, p.kind)
+				}
+				details = append(details, p.detail)
+			}
+			testCase.Failure = &JUnitFailure{
+				Message: fmt.Sprintf("%d problems found on %s", len(found), name),
+				Type:    strings.Join(kinds, ","),
+				Text:    strings.Join(details, "\n\n"),
+			}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+	}
+	return &JUnitSuites{
+		Name:     "athena",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []JUnitSuite{suite},
+	}
+}
+
+// exceptionRoutes returns every route an exception was raised on.  Exceptions
+// stored before routes were collected only have the first.
+func exceptionRoutes(exc exception.Exception) []string {
+	if len(exc.Routes) > 0 {
+		return exc.Routes
+	}
+	return []string{exc.Method + " " + exc.Path}
+}
+
+// reproducer returns the smallest reproducer stored
+func reproducer(curl string, minimized string) string {
+	if minimized != "" {
+		return minimized
+	}
+	return curl
+}
+
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package export
+
+// SARIF 2.1.0, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+// Only the parts we fill in are modeled.  Exceptions with an in-app backtrace
+// frame get a physical location.  Findings, and exceptions without one, only
+// have the routes they were seen on as logical locations, since black box
+// detectors can't tell where in the source the bug is.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mruck/athena/goFuzz/detector/leak"
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+const sarifVersion = "2.1.0"
+
+// SarifLog is the top level SARIF document
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+// SarifRun is a single run of a tool
+type SarifRun struct {
+	Tool    SarifTool     `json:"tool"`
+	Results []SarifResult `json:"results"`
+}
+
+// SarifTool describes athena and the rules it reports on
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+// SarifDriver is the tool component that produced the results
+type SarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SarifRule `json:"rules"`
+}
+
+// SarifRule is a kind of result
+type SarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+}
+
+// SarifMessage is plain text
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+// SarifResult is a single exception or finding
+type SarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             SarifMessage      `json:"message"`
+	Locations           []SarifLocation   `json:"locations,omitempty"`
+	Stacks              []SarifStack      `json:"stacks,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          SarifProperties   `json:"properties"`
+}
+
+// SarifLocation is a place in the app's source, the route, or both
+type SarifLocation struct {
+	PhysicalLocation *SarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []SarifLogicalLocation `json:"logicalLocations,omitempty"`
+	Message          *SarifMessage          `json:"message,omitempty"`
+}
+
+// SarifPhysicalLocation is a line in a source file
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+	Region           SarifRegion           `json:"region"`
+}
+
+// SarifArtifactLocation is a source file relative to the app root
+type SarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+// SarifRegion is a line in a source file
+type SarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// SarifLogicalLocation is the route or parameter a result applies to
+type SarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind"`
+}
+
+// SarifStack is a backtrace
+type SarifStack struct {
+	Frames []SarifStackFrame `json:"frames"`
+}
+
+// SarifStackFrame is a single frame of a backtrace
+type SarifStackFrame struct {
+	Location SarifLocation `json:"location"`
+}
+
+// SarifProperties carry what doesn't fit anywhere else
+type SarifProperties struct {
+	Route               string `json:"route"`
+	Parameter           string `json:"parameter,omitempty"`
+	Reproducer          string `json:"reproducer,omitempty"`
+	MinimizedReproducer string `json:"minimizedReproducer,omitempty"`
+	Severity            string `json:"severity,omitempty"`
+	Count               int    `json:"count,omitempty"`
+}
+
+// Where source files live, resolved by the consumer of the log
+const appRoot = "APPROOT"
+
+// Prefix of rule ids for exceptions, followed by the class
+const exceptionRulePrefix = "exception/"
+
+// Findings that are worth knowing about, but aren't vulnerabilities
+var findingLevels = map[string]string{
+	schema.KindStatus: "note",
+	schema.KindSchema: "note",
+	leak.Kind:         "warning",
+}
+
+// Exceptions are as interesting as their triaged severity
+var exceptionLevels = map[string]string{
+	exception.Security: "error",
+	exception.High:     "warning",
+	exception.Low:      "note",
+}
+
+func level(levels map[string]string, key string, fallback string) string {
+	if level, ok := levels[key]; ok {
+		return level
+	}
+	return fallback
+}
+
+// routeLocation describes the route, as "METHOD path", and parameter if any,
+// as logical locations
+func routeLocation(route string, param string) []SarifLogicalLocation {
+	locations := []SarifLogicalLocation{{Name: route, Kind: "resource"}}
+	if param != "" {
+		locations = append(locations, SarifLogicalLocation{
+			Name:               param,
+			FullyQualifiedName: route + " " + param,
+			Kind:               "parameter",
+		})
+	}
+	return locations
+}
+
+func physicalLocation(frame exception.Frame) *SarifPhysicalLocation {
+	return &SarifPhysicalLocation{
+		ArtifactLocation: SarifArtifactLocation{URI: frame.File, URIBaseID: appRoot},
+		Region:           SarifRegion{StartLine: frame.Line},
+	}
+}
+
+func exceptionResult(exc exception.Exception) SarifResult {
+	result := SarifResult{
+		RuleID:  exceptionRulePrefix + exc.Class,
+		Level:   level(exceptionLevels, exc.Severity, "warning"),
+		Message: SarifMessage{Text: fmt.Sprintf("%s: %s", exc.Class, exc.Message)},
+		Properties: SarifProperties{
+			Route:               exc.Method + " " + exc.Path,
+			Reproducer:          exc.Curl,
+			MinimizedReproducer: exc.MinimizedCurl,
+			Severity:            exc.Severity,
+			Count:               exc.Count,
+		},
+	}
+	if exc.Fingerprint != "" {
+		result.PartialFingerprints = map[string]string{"athenaFingerprint/v1": exc.Fingerprint}
+	}
+
+	// The innermost app frame is where the bug is, the routes are how to
+	// reach it
+	location := SarifLocation{}
+	for _, route := range exceptionRoutes(exc) {
+		location.LogicalLocations = append(location.LogicalLocations, routeLocation(route, "")...)
+	}
+	frames := exc.AppFrames()
+	if len(frames) > 0 {
+		location.PhysicalLocation = physicalLocation(frames[0])
+		stack := SarifStack{}
+		for _, frame := range frames {
+			stack.Frames = append(stack.Frames, SarifStackFrame{Location: SarifLocation{
+				PhysicalLocation: physicalLocation(frame),
+				Message:          &SarifMessage{Text: frame.Method},
+			}})
+		}
+		result.Stacks = []SarifStack{stack}
+	}
+	result.Locations = []SarifLocation{location}
+	return result
+}
+
+func findingResult(found finding.Finding) SarifResult {
+	return SarifResult{
+		RuleID:    found.Kind,
+		Level:     level(findingLevels, found.Kind, "error"),
+		Message:   SarifMessage{Text: found.Message},
+		Locations: []SarifLocation{{LogicalLocations: routeLocation(found.Method+" "+found.Path, found.Param)}},
+		Properties: SarifProperties{
+			Route:               found.Method + " " + found.Path,
+			Parameter:           found.Param,
+			Reproducer:          found.Curl,
+			MinimizedReproducer: found.MinimizedCurl,
+		},
+	}
+}
+
+// Sarif converts open exceptions and findings to a SARIF log
+func Sarif(exceptions []exception.Exception, findings []finding.Finding) *SarifLog {
+	run := SarifRun{
+		Tool: SarifTool{Driver: SarifDriver{
+			Name:           "athena",
+			InformationURI: "https://github.com/mruck/athena",
+			Rules:          []SarifRule{},
+		}},
+		Results: []SarifResult{},
+	}
+
+	rules := map[string]string{}
+	for _, exc := range exceptions {
+		if exc.Closed {
+			continue
+		}
+		result := exceptionResult(exc)
+		rules[result.RuleID] = fmt.Sprintf("Unhandled %s", exc.Class)
+		run.Results = append(run.Results, result)
+	}
+	for _, found := range findings {
+		if found.Closed {
+			continue
+		}
+		rules[found.Kind] = fmt.Sprintf("Athena %s detector", found.Kind)
+		run.Results = append(run.Results, findingResult(found))
+	}
+
+	ids := []string{}
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SarifRule{
+			ID:               id,
+			ShortDescription: SarifMessage{Text: rules[id]},
+		})
+	}
+
+	return &SarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []SarifRun{run}}
+}
@@ -3,12 +3,31 @@ package fuzz
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mruck/athena/goFuzz/canary"
+	"github.com/mruck/athena/goFuzz/control"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/detector/authz"
+	"github.com/mruck/athena/goFuzz/detector/cmdi"
+	"github.com/mruck/athena/goFuzz/detector/dos"
+	"github.com/mruck/athena/goFuzz/detector/leak"
+	"github.com/mruck/athena/goFuzz/detector/massassign"
+	"github.com/mruck/athena/goFuzz/detector/redirect"
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/goFuzz/detector/ssrf"
+	"github.com/mruck/athena/goFuzz/detector/traversal"
+	"github.com/mruck/athena/goFuzz/detector/xss"
 	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/metrics"
 	"github.com/mruck/athena/goFuzz/mutator"
 	"github.com/mruck/athena/goFuzz/route"
 	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
 	"github.com/mruck/athena/lib/util"
 	"github.com/pkg/errors"
 )
@@ -32,13 +51,128 @@ func logStats(client *httpclient.Client, mutator *mutator.Mutator) {
 	fmt.Printf("Final Coverage: %v\n", mutator.SrcCoverage.Cumulative)
 	fmt.Printf("Success Ratio: %v\n", successRatio)
 	fmt.Printf("Total Requests: %v\n", totalRequests)
+	fmt.Printf("Run: %v\n", mutator.Run.RunID)
 }
 
-// Fuzz starts the fuzzer
-func Fuzz(client *httpclient.Client, routes []*route.Route, corpus []*route.Route) {
+// Store the run summary after this many requests
+const saveInterval = 100
+
+// allDetectors lists every detector we know how to build
+var allDetectors = []string{"dos", "xss", "authz", "ssrf", "traversal", "cmdi", "redirect", "massassign", "schema", "leak"}
+
+// newDetectors builds the detectors listed in the DETECTORS env var, a comma
+// separated list of names.  All detectors are enabled by default.
+func newDetectors(mutator *mutator.Mutator, clients []*httpclient.Client) []detector.Detector {
+	names := allDetectors
+	if env := os.Getenv("DETECTORS"); env != "" {
+		names = strings.Split(env, ",")
+	}
+
+	// Detectors waiting on callbacks from the target share a listener,
+	// started when the first one is built
+	var listener *canary.Listener
+	getListener := func() *canary.Listener {
+		if listener == nil {
+			listener = canary.New()
+			err := listener.Start()
+			util.Must(err == nil, "%+v", err)
+		}
+		return listener
+	}
+
+	resultsPath := util.DefaultEnv("RESULTS_PATH", "/tmp/results")
+
+	detectors := []detector.Detector{}
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "dos":
+			detectors = append(detectors, dos.New(mutator.DB.Log))
+		case "xss":
+			detectors = append(detectors, xss.New())
+		case "authz":
+			detectors = append(detectors, authz.New(followUps(clients)))
+		case "ssrf":
+			detectors = append(detectors, ssrf.New(getListener()))
+		case "traversal":
+			detectors = append(detectors, traversal.New(resultsPath))
+		case "cmdi":
+			detectors = append(detectors, cmdi.New(resultsPath, getListener()))
+		case "redirect":
+			detectors = append(detectors, redirect.New(clients))
+		case "massassign":
+			detectors = append(detectors, massassign.New(mutator.Routes, mutator.DB))
+		case "schema":
+			detectors = append(detectors, schema.New())
+		case "leak":
+			detectors = append(detectors, leak.New())
+		case "none":
+		default:
+			log.Fatalf("unknown detector %q, expected one of %v", name, allDetectors)
+		}
+	}
+	return detectors
+}
+
+// followUps returns a client for follow up requests for each client
+func followUps(clients []*httpclient.Client) []*httpclient.Client {
+	copies := make([]*httpclient.Client, len(clients))
+	for i, client := range clients {
+		copies[i] = client.FollowUp()
+	}
+	return copies
+}
+
+// publish saves the status of the run, logging any errors
+func publish(mutator *mutator.Mutator, phase string) {
+	err := mutator.Runs.SaveStatus(mutator.Status(phase))
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// Fuzz starts the fuzzer.  Requests are sent as the first client, the
+// others are used to replay requests as different identities.  Stats are
+// recorded to summary and stored as we go.  The controller pauses and stops
+// the fuzzer in between requests.
+func Fuzz(clients []*httpclient.Client, routes []*route.Route, corpus []*route.Route,
+	summary *run.Run, controller *control.Controller) {
+	client := clients[0]
 	// Parse routes
-	mutator := mutator.New(routes, corpus)
+	mutator := mutator.New(routes, corpus, summary)
+	mutator.Detectors = newDetectors(mutator, clients)
+
+	// Expose progress to prometheus and let the frontend pause and stop us
+	metrics.Serve(map[string]http.Handler{"/control/": controller})
+
+	// Store the run right away so it's listed before the first checkpoint
+	err := mutator.Runs.Save(mutator.Run)
+	if err != nil {
+		log.Error(err)
+	}
+
+	// When the status was last published
+	var published time.Time
 	for {
+		// Wait to be resumed, letting the frontend know we're paused and
+		// still alive
+		if controller.Paused() {
+			log.Info("paused")
+			// Checkpoint in case we're stopped without getting to
+			err := mutator.Runs.Save(mutator.Run)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+		for controller.Paused() {
+			publish(mutator, run.Paused)
+			published = time.Now()
+			controller.WaitFor(run.StatusInterval)
+		}
+		if !controller.Wait() {
+			log.Info("stopping")
+			break
+		}
+
 		// Get next request
 		request := mutator.Next()
 
@@ -54,12 +188,50 @@ func Fuzz(client *httpclient.Client, routes []*route.Route, corpus []*route.Rout
 		}
 
 		// Collect our deltas
-		err = mutator.UpdateState(resp, client.CurlCmd)
+		err = mutator.UpdateState(resp, client.CurlCmd, client.Latency)
 		if err != nil {
 			// Log the error with some additional context
 			mutator.LogError(err)
 		}
+
+		// Look for vulnerabilities
+		err = mutator.Detect(request, resp, client)
+		if err != nil {
+			mutator.LogError(err)
+		}
+
+		// Shrink reproducers for anything new
+		err = mutator.Minimize(client.FollowUp())
+		if err != nil {
+			mutator.LogError(err)
+		}
+
+		// Store the run summary every so often so a crash doesn't lose it
+		if mutator.Run.Requests%saveInterval == 0 {
+			err = mutator.Runs.Save(mutator.Run)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+
+		// Let the frontend know how we're doing
+		if time.Since(published) >= run.StatusInterval {
+			publish(mutator, run.Fuzzing)
+			published = time.Now()
+		}
 	}
 
+	// Checkpoint the run.  Findings and exceptions are stored as they are
+	// found.
+	mutator.Run.End = time.Now()
+	err = mutator.Runs.Save(mutator.Run)
+	if err != nil {
+		log.Error(err)
+	}
+	if controller.Stopped() {
+		publish(mutator, run.Stopped)
+	} else {
+		publish(mutator, run.Finished)
+	}
 	logStats(client, mutator)
 }
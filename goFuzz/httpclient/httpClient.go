@@ -33,6 +33,39 @@ type Client struct {
 	StatusCodes     map[int]int
 	// Latest request as a curl cmd
 	CurlCmd *http2curl.CurlCommand
+	// Time taken for the latest request to receive response headers
+	Latency time.Duration
+	// User the client is logged in as
+	Identity *Identity
+	// Record redirects followed instead of silently following them
+	CaptureRedirects bool
+	// Redirects followed by the latest request, if capturing
+	Redirects []Redirect
+}
+
+// Redirect is a single hop in a redirect chain
+type Redirect struct {
+	// URL that responded with the redirect
+	URL        string
+	StatusCode int
+	Location   string
+	Header     http.Header
+}
+
+// Same limit as the default http client
+const maxRedirects = 10
+
+// Identity is a named user of the target.  Every identity gets its own
+// client, and therefore its own cookie jar.
+type Identity struct {
+	Name string
+	// Higher privileges can do more.  Anonymous users are 0.
+	Privilege int
+	// Har file replicating the login, empty for anonymous users
+	LoginHar string
+	// Strings that only show up in data belonging to this identity, i.e.
+	// username or email
+	Markers []string
 }
 
 // New allocates an http client with a cookie jar.
@@ -42,14 +75,63 @@ func New(url *url.URL) (*Client, error) {
 		return nil, err
 	}
 	httpClient := &http.Client{Jar: jar}
-	return &Client{
+	client := &Client{
 		Client:          httpClient,
 		URL:             url,
 		HealthcheckPath: healthCheckRoute,
 		StatusCodes:     map[int]int{},
 		// TODO: same thing with interval field that takes default
 		// from a constant.
-	}, nil
+	}
+	httpClient.CheckRedirect = client.checkRedirect
+	return client, nil
+}
+
+// checkRedirect records each hop when capturing redirects.  Redirects off the
+// target are recorded but not followed, we return the redirect instead.
+func (cli *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !cli.CaptureRedirects {
+		return nil
+	}
+	if req.Response != nil {
+		cli.Redirects = append(cli.Redirects, Redirect{
+			URL:        via[len(via)-1].URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Location:   req.Response.Header.Get("Location"),
+			Header:     req.Response.Header,
+		})
+	}
+	if req.URL.Host != cli.URL.Host {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// NewAs allocates an http client for the given identity
+func NewAs(url *url.URL, identity *Identity) (*Client, error) {
+	client, err := New(url)
+	if err != nil {
+		return nil, err
+	}
+	client.Identity = identity
+	return client, nil
+}
+
+// FollowUp returns a client sharing the cookie jar and identity of cli, but
+// with its own status codes, latency and curl command, so follow up requests
+// sent by detectors aren't mistaken for fuzzed ones
+func (cli *Client) FollowUp() *Client {
+	httpClient := *cli.Client
+	client := *cli
+	client.Client = &httpClient
+	client.StatusCodes = map[int]int{}
+	client.CurlCmd = nil
+	client.Redirects = nil
+	httpClient.CheckRedirect = client.checkRedirect
+	return &client
 }
 
 // HealthCheck checks if a hard coded rails fork endpoint is up
@@ -106,7 +188,10 @@ func (cli *Client) Do(req *http.Request) (*http.Response, error) {
 		req.Body = ioutil.NopCloser(io.TeeReader(req.Body, &buf))
 	}
 
+	cli.Redirects = nil
+	start := time.Now()
 	resp, err := cli.Client.Do(req)
+	cli.Latency = time.Since(start)
 
 	// Body buffer has been read, replenish it
 	if req.Body != nil {
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -91,3 +92,90 @@ func TestHealthCheck(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, true, alive)
 }
+
+func TestLatency(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url := urlFromTestServer(t, ts)
+
+	client, err := New(url)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest("GET", ts.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(request)
+	require.NoError(t, err)
+	require.True(t, client.Latency >= 50*time.Millisecond)
+}
+
+func TestCaptureRedirects(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login":
+			http.Redirect(w, req, "/home", http.StatusFound)
+		case "/home":
+			http.Redirect(w, req, "http://evil.example.com/", http.StatusFound)
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url := urlFromTestServer(t, ts)
+
+	client, err := New(url)
+	require.NoError(t, err)
+	client.CaptureRedirects = true
+
+	request, err := http.NewRequest("GET", ts.URL+"/login", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(request)
+	require.NoError(t, err)
+
+	// We stop at the redirect off the target
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	require.Equal(t, "http://evil.example.com/", resp.Header.Get("Location"))
+	require.Len(t, client.Redirects, 2)
+	require.Equal(t, "/home", client.Redirects[0].Location)
+	require.Equal(t, ts.URL+"/login", client.Redirects[0].URL)
+	require.Equal(t, "http://evil.example.com/", client.Redirects[1].Location)
+
+	// The chain is reset on every request
+	request, err = http.NewRequest("GET", ts.URL+"/other", nil)
+	require.NoError(t, err)
+	_, err = client.Do(request)
+	require.NoError(t, err)
+	require.Empty(t, client.Redirects)
+}
+
+func TestFollowUp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			w.WriteHeader(201)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	client, err := New(urlFromTestServer(t, ts))
+	require.NoError(t, err)
+	req, err := http.NewRequest("GET", ts.URL+"/login", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.NoError(t, err)
+	curl := client.CurlCmd
+
+	// The follow up client is logged in as well, but keeps its own stats
+	followUp := client.FollowUp()
+	req, err = http.NewRequest("GET", ts.URL+"/posts", nil)
+	require.NoError(t, err)
+	resp, err := followUp.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, map[int]int{200: 1}, followUp.StatusCodes)
+	require.Equal(t, map[int]int{201: 1}, client.StatusCodes)
+	require.Equal(t, curl, client.CurlCmd)
+}
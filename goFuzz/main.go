@@ -2,21 +2,25 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/mruck/athena/goFuzz/control"
 	"github.com/mruck/athena/goFuzz/fuzz"
 	"github.com/mruck/athena/goFuzz/httpclient"
 	"github.com/mruck/athena/goFuzz/preprocess"
 	"github.com/mruck/athena/goFuzz/route"
 	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
 	"github.com/mruck/athena/lib/util"
 )
 
 // TODO: this should be in the shared mount.
 // Add to target img?
-const harLogin = "tests/login_har.json"
+const identitiesPath = "tests/identities.json"
 const swaggerPath = "tests/discourseSwagger.json"
 const harCorpus = "tests/corpus_har.json"
 
@@ -30,41 +34,90 @@ func readDB() {
 	os.Exit(0)
 }
 
-func main() {
-	// Read the database and exit
-	readDB()
-
+// newClients returns a logged in client for every identity.  The first one
+// drives the fuzzer.
+func newClients() []*httpclient.Client {
 	port := util.MustGetTargetAppPort()
 	host := util.MustGetTargetAppHost()
 
-	// Load swagger info
-	routes := route.FromSwagger(swaggerPath)
-
-	// Parse initial corpus
-	corpus := preprocess.GetCorpus(routes, harCorpus)
-
-	// Retrieve HTTP state for logging in
-	login, err := preprocess.GetLogin(harLogin)
-	if err != nil {
-		log.Fatalf("%+v", err)
-	}
+	// Identities to send requests as.  The first one drives the fuzzer.
+	identities := preprocess.GetIdentities(util.DefaultEnv("IDENTITIES", identitiesPath))
 
 	// Parse the URL
 	url, err := url.Parse(fmt.Sprintf("http://%s:%s", host, port))
 	util.Must(err == nil, "%+v", err)
 
-	// Get a new client.
-	client, err := httpclient.New(url)
-	util.Must(err == nil, "%+v", err)
+	// Get a new client for each identity, each with its own cookie jar
+	clients := make([]*httpclient.Client, len(identities))
+	for i, identity := range identities {
+		clients[i], err = httpclient.NewAs(url, identity)
+		util.Must(err == nil, "%+v", err)
+	}
 
 	// Health check
-	alive, err := client.HealthCheck()
+	alive, err := clients[0].HealthCheck()
 	util.Must(err == nil, "%+v", err)
 	util.Must(alive, "target app not alive")
 
 	// Login
-	err = client.DoAll(login)
+	for _, client := range clients {
+		err = preprocess.Login(client)
+		util.Must(err == nil, "%+v", err)
+	}
+	return clients
+}
+
+func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			replayMain(os.Args[2:])
+			return
+		case "export":
+			exportMain(os.Args[2:])
+			return
+		case "report":
+			reportMain(os.Args[2:])
+			return
+		case "compare":
+			compareMain(os.Args[2:])
+			return
+		default:
+			log.Fatalf("unknown command %q", os.Args[1])
+		}
+	}
+
+	// Read the database and exit
+	readDB()
+
+	// Describe the run so it can be compared against others
+	summary := run.New(util.MustGetTargetID())
+	summary.GitRef = os.Getenv("GIT_REF")
+	summary.Seed = util.GetSeed()
+	util.SeedRand(summary.Seed)
+	specHash, err := run.HashFile(swaggerPath)
 	util.Must(err == nil, "%+v", err)
+	summary.SpecHash = specHash
+	log.Infof("run %s with seed %d", summary.RunID, summary.Seed)
+
+	// Load swagger info
+	routes := route.FromSwagger(swaggerPath)
+
+	// Parse initial corpus
+	corpus := preprocess.GetCorpus(routes, harCorpus)
+
+	clients := newClients()
+
+	// Stop gracefully when the pod is deleted so the run summary is stored
+	controller := control.New(os.Getenv(control.TokenEnvVar))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Infof("received %v, stopping after the current request", sig)
+		controller.Stop()
+	}()
 
-	fuzz.Fuzz(client, routes, corpus)
+	fuzz.Fuzz(clients, routes, corpus, summary, controller)
 }
@@ -0,0 +1,137 @@
+package metrics
+
+// Prometheus metrics for watching long fuzzing campaigns.  Everything is
+// registered with the default registry and served on /metrics.
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "athena"
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests sent by route, method and status code. Status is \"error\" if no response was received.",
+	}, []string{"method", "route", "status"})
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time to receive a response, by route and method.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route"})
+
+	currentRoute = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "current_route",
+		Help:      "Route currently being fuzzed, set to 1.",
+	}, []string{"method", "route"})
+
+	coverage = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "coverage_percent",
+		Help:      "Cumulative source code coverage of the target.",
+	})
+
+	// rate() of this is the coverage delta rate
+	coverageGained = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coverage_gained_percent_total",
+		Help:      "Sum of the coverage deltas of every request, in percentage points.",
+	})
+
+	coverageIncreases = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coverage_increases_total",
+		Help:      "Requests that hit new code.",
+	})
+
+	taintedQueries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tainted_queries",
+		Help:      "Unique parameter, table and column combinations seen in queries.",
+	})
+
+	exceptions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unique_exceptions",
+		Help:      "Unique exceptions raised by the target, by fingerprint.",
+	})
+
+	postgresErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "postgres_errors_total",
+		Help:      "Errors logged by postgres, by severity.",
+	}, []string{"severity"})
+)
+
+func init() {
+	prometheus.MustRegister(requests, latency, currentRoute, coverage, coverageGained,
+		coverageIncreases, taintedQueries, exceptions, postgresErrors)
+}
+
+// Serve exposes /metrics on METRICS_PORT in the background, along with any
+// other handlers keyed by pattern
+func Serve(handlers map[string]http.Handler) {
+	port := util.DefaultEnv("METRICS_PORT", "2112")
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
+	go func() {
+		err := http.ListenAndServe(":"+port, mux)
+		log.Errorf("metrics server stopped: %v", err)
+	}()
+}
+
+// Request records a request sent to a route.  Status is 0 if we never got a
+// response.
+func Request(method string, route string, status int, duration time.Duration) {
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	requests.WithLabelValues(method, route, code).Inc()
+	latency.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// CurrentRoute marks the route being fuzzed
+func CurrentRoute(method string, route string) {
+	currentRoute.Reset()
+	currentRoute.WithLabelValues(method, route).Set(1)
+}
+
+// Coverage records the cumulative coverage and the coverage gained by the
+// most recent request, both as percentages
+func Coverage(cumulative float64, delta float64) {
+	coverage.Set(cumulative)
+	if delta > 0 {
+		coverageGained.Add(delta)
+		coverageIncreases.Inc()
+	}
+}
+
+// TaintedQueries records the number of unique tainted queries
+func TaintedQueries(count int) {
+	taintedQueries.Set(float64(count))
+}
+
+// Exceptions records the number of unique exceptions
+func Exceptions(count int) {
+	exceptions.Set(float64(count))
+}
+
+// PostgresError counts an error logged by postgres
+func PostgresError(severity string) {
+	postgresErrors.WithLabelValues(severity).Inc()
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	Request("GET", "/posts/{id}.json", 200, 30*time.Millisecond)
+	Request("GET", "/posts/{id}.json", 200, 60*time.Millisecond)
+	Request("POST", "/posts", 0, time.Second)
+	require.Equal(t, 2.0, testutil.ToFloat64(requests.WithLabelValues("GET", "/posts/{id}.json", "200")))
+	require.Equal(t, 1.0, testutil.ToFloat64(requests.WithLabelValues("POST", "/posts", "error")))
+
+	CurrentRoute("GET", "/posts")
+	CurrentRoute("POST", "/posts")
+	require.Equal(t, 0.0, testutil.ToFloat64(currentRoute.WithLabelValues("GET", "/posts")))
+	require.Equal(t, 1.0, testutil.ToFloat64(currentRoute.WithLabelValues("POST", "/posts")))
+
+	Coverage(10, 10)
+	Coverage(10, 0)
+	Coverage(12.5, 2.5)
+	require.Equal(t, 12.5, testutil.ToFloat64(coverage))
+	require.Equal(t, 12.5, testutil.ToFloat64(coverageGained))
+	require.Equal(t, 2.0, testutil.ToFloat64(coverageIncreases))
+
+	PostgresError("ERROR")
+	Exceptions(3)
+	TaintedQueries(7)
+
+	// Everything shows up on /metrics
+	recorder := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	for _, name := range []string{
+		"athena_requests_total", "athena_request_duration_seconds_bucket", "athena_current_route",
+		"athena_coverage_percent", "athena_coverage_gained_percent_total", "athena_tainted_queries 7",
+		"athena_unique_exceptions 3", `athena_postgres_errors_total{severity="ERROR"} 1`,
+	} {
+		require.Contains(t, string(body), name)
+	}
+}
@@ -0,0 +1,306 @@
+package minimize
+
+// Requests that trigger a bug often carry a lot of noise: every mutated leaf,
+// huge arrays and long strings.  We shrink them by greedily applying edits
+// and keeping any edit after which the bug still reproduces.  Edits are tried
+// from most to least aggressive: shrinking arrays, dropping parameters,
+// reverting leaves to baseline values, then shrinking strings.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// MaxAttempts bounds the number of requests sent to minimize one request
+const MaxAttempts = 200
+
+// Oracle sends a candidate request and reports whether the bug still
+// reproduces
+type Oracle func(req *http.Request) (bool, error)
+
+// Roots of the tree we minimize
+const (
+	queryRoot = "query"
+	bodyRoot  = "body"
+)
+
+// testCase is a request broken down into something we can edit
+type testCase struct {
+	// Method, url and headers are copied from here
+	template *http.Request
+	// Query params and the json body, keyed by queryRoot and bodyRoot
+	tree map[string]interface{}
+	// Body that isn't json, sent as is
+	rawBody []byte
+}
+
+func newTestCase(req *http.Request, body []byte) *testCase {
+	query := map[string]interface{}{}
+	for name, values := range req.URL.Query() {
+		if len(values) == 1 {
+			query[name] = values[0]
+			continue
+		}
+		list := []interface{}{}
+		for _, value := range values {
+			list = append(list, value)
+		}
+		query[name] = list
+	}
+	tc := &testCase{
+		template: req,
+		tree:     map[string]interface{}{queryRoot: query},
+	}
+	if len(body) > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			tc.tree[bodyRoot] = decoded
+		} else {
+			tc.rawBody = body
+		}
+	}
+	return tc
+}
+
+// request converts the test case back to an http.Request
+func (tc *testCase) request() (*http.Request, error) {
+	u := *tc.template.URL
+	query := url.Values{}
+	for name, value := range tc.tree[queryRoot].(map[string]interface{}) {
+		if list, ok := value.([]interface{}); ok {
+			for _, elem := range list {
+				query.Add(name, stringify(elem))
+			}
+			continue
+		}
+		query.Add(name, stringify(value))
+	}
+	u.RawQuery = query.Encode()
+
+	var body []byte
+	if decoded, ok := tc.tree[bodyRoot]; ok {
+		data, err := json.Marshal(decoded)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		body = data
+	} else {
+		body = tc.rawBody
+	}
+
+	req, err := http.NewRequest(tc.template.Method, u.String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	for name, values := range tc.template.Header {
+		req.Header[name] = append([]string{}, values...)
+	}
+	// The client sets this on every request
+	req.Header.Del("Content-Type")
+	req.Host = tc.template.Host
+	return req, nil
+}
+
+func stringify(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// Kinds of edits, in the order they are tried
+const (
+	halve = iota
+	drop
+	revert
+	shrink
+)
+
+// edit is a single reduction applied to the node at path.  Path elements are
+// map keys or array indices.
+type edit struct {
+	kind int
+	path []interface{}
+	// Value to revert to
+	value interface{}
+}
+
+// edits lists every reduction that applies to the test case
+func (tc *testCase) edits(baselines map[string]interface{}) []edit {
+	buckets := make([][]edit, shrink+1)
+	var walk func(node interface{}, path []interface{})
+	walk = func(node interface{}, path []interface{}) {
+		// Copy so edits don't share the backing array
+		here := append([]interface{}{}, path...)
+		// Parameters and object keys can be dropped, but not the roots
+		if len(path) > 1 {
+			if _, ok := path[len(path)-1].(string); ok {
+				buckets[drop] = append(buckets[drop], edit{kind: drop, path: here})
+			}
+		}
+		switch node := node.(type) {
+		case map[string]interface{}:
+			// Sort so we minimize deterministically
+			keys := []string{}
+			for key := range node {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(node[key], append(here, key))
+			}
+			return
+		case []interface{}:
+			if len(node) > 0 {
+				buckets[halve] = append(buckets[halve], edit{kind: halve, path: here})
+			}
+			for i, child := range node {
+				walk(child, append(here, i))
+			}
+			return
+		case string:
+			if len([]rune(node)) > 1 {
+				buckets[shrink] = append(buckets[shrink], edit{kind: shrink, path: here})
+			}
+		}
+		// Revert leaves to the value seen in the har or first sent, as long
+		// as it's smaller
+		if name, ok := path[len(path)-1].(string); ok && len(path) > 1 {
+			baseline, ok := baselines[name]
+			if ok && len(stringify(baseline)) < len(stringify(node)) {
+				buckets[revert] = append(buckets[revert], edit{kind: revert, path: here, value: baseline})
+			}
+		}
+	}
+	walk(tc.tree[queryRoot], []interface{}{queryRoot})
+	if body, ok := tc.tree[bodyRoot]; ok {
+		walk(body, []interface{}{bodyRoot})
+	}
+
+	edits := []edit{}
+	for _, bucket := range buckets {
+		edits = append(edits, bucket...)
+	}
+	return edits
+}
+
+// apply returns a copy of the test case with the edit applied
+func (tc *testCase) apply(e edit) *testCase {
+	tree := deepCopy(tc.tree).(map[string]interface{})
+	// Find the parent of the node we are editing
+	var parent interface{} = tree
+	for _, key := range e.path[:len(e.path)-1] {
+		parent = child(parent, key)
+	}
+	last := e.path[len(e.path)-1]
+	node := child(parent, last)
+
+	var replacement interface{}
+	switch e.kind {
+	case drop:
+		delete(parent.(map[string]interface{}), last.(string))
+		return &testCase{template: tc.template, tree: tree, rawBody: tc.rawBody}
+	case halve:
+		list := node.([]interface{})
+		replacement = list[:len(list)/2]
+	case shrink:
+		runes := []rune(node.(string))
+		replacement = string(runes[:len(runes)/2])
+	case revert:
+		replacement = e.value
+	}
+	switch parent := parent.(type) {
+	case map[string]interface{}:
+		parent[last.(string)] = replacement
+	case []interface{}:
+		parent[last.(int)] = replacement
+	}
+	return &testCase{template: tc.template, tree: tree, rawBody: tc.rawBody}
+}
+
+func child(node interface{}, key interface{}) interface{} {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		return node[key.(string)]
+	case []interface{}:
+		return node[key.(int)]
+	}
+	return nil
+}
+
+func deepCopy(node interface{}) interface{} {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(node))
+		for key, child := range node {
+			copied[key] = deepCopy(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(node))
+		for i, child := range node {
+			copied[i] = deepCopy(child)
+		}
+		return copied
+	}
+	return node
+}
+
+// Request returns the smallest variant of req that the oracle says still
+// reproduces the bug.  body is the already read request body.  Baselines map
+// parameter names to known good values, i.e. from the har.  If the original
+// request doesn't reproduce, nil is returned.
+func Request(req *http.Request, body []byte, baselines map[string]interface{}, oracle Oracle) (*http.Request, error) {
+	tc := newTestCase(req, body)
+
+	// Make sure the bug reproduces at all
+	candidate, err := tc.request()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := oracle(candidate)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	attempts := 1
+	for attempts < MaxAttempts {
+		progress := false
+		for _, e := range tc.edits(baselines) {
+			if attempts >= MaxAttempts {
+				break
+			}
+			next := tc.apply(e)
+			candidate, err := next.request()
+			if err != nil {
+				return nil, err
+			}
+			attempts++
+			ok, err := oracle(candidate)
+			if err != nil {
+				return nil, err
+			}
+			// Keep the edit and start over with the smaller test case
+			if ok {
+				tc = next
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return tc.request()
+}
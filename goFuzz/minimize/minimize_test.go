@@ -0,0 +1,96 @@
+package minimize
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// decode reads back the query and body of a request
+func decode(t *testing.T, req *http.Request) (map[string][]string, interface{}) {
+	var body interface{}
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &body))
+	}
+	return req.URL.Query(), body
+}
+
+func TestRequest(t *testing.T) {
+	items := []interface{}{"xxbugxx"}
+	for i := 0; i < 1000; i++ {
+		items = append(items, strings.Repeat("a", 100))
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"items":  items,
+		"name":   "aaaaaaaaaaaaaaaaaaaa",
+		"nested": map[string]interface{}{"keep": "yes", "junk": 1},
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", "http://localhost:3000/posts?id=12345&noise=zzzz", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Test", "1")
+
+	// The bug needs an id and an item containing "bug"
+	attempts := 0
+	oracle := func(req *http.Request) (bool, error) {
+		attempts++
+		query, body := decode(t, req)
+		if _, ok := query["id"]; !ok {
+			return false, nil
+		}
+		obj, ok := body.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		items, _ := obj["items"].([]interface{})
+		for _, item := range items {
+			if s, ok := item.(string); ok && strings.Contains(s, "bug") {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	baselines := map[string]interface{}{"id": "7", "name": "bob"}
+	minimal, err := Request(req, body, baselines, oracle)
+	require.NoError(t, err)
+	require.NotNil(t, minimal)
+	require.True(t, attempts <= MaxAttempts)
+
+	require.Equal(t, "POST", minimal.Method)
+	require.Equal(t, "/posts", minimal.URL.Path)
+	require.Equal(t, "1", minimal.Header.Get("X-Test"))
+	query, decoded := decode(t, minimal)
+	require.Equal(t, map[string][]string{"id": {"7"}}, query)
+	require.Equal(t, map[string]interface{}{"items": []interface{}{"xxbugxx"}}, decoded)
+}
+
+func TestRequestNotReproduced(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://localhost:3000/posts?id=1", nil)
+	require.NoError(t, err)
+	never := func(req *http.Request) (bool, error) { return false, nil }
+	minimal, err := Request(req, nil, nil, never)
+	require.NoError(t, err)
+	require.Nil(t, minimal)
+}
+
+func TestRequestRawBody(t *testing.T) {
+	req, err := http.NewRequest("PUT", "http://localhost:3000/upload?a=bbbb", nil)
+	require.NoError(t, err)
+	raw := []byte("not json at all")
+
+	// Anything reproduces, but we can't shrink a body we don't understand
+	always := func(req *http.Request) (bool, error) { return true, nil }
+	minimal, err := Request(req, raw, nil, always)
+	require.NoError(t, err)
+	require.Empty(t, minimal.URL.RawQuery)
+	data, err := ioutil.ReadAll(minimal.Body)
+	require.NoError(t, err)
+	require.Equal(t, raw, data)
+}
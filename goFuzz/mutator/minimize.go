@@ -0,0 +1,263 @@
+package mutator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/moul/http2curl"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/detector/leak"
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/minimize"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/pkg/errors"
+)
+
+// Findings about the response as a whole.  Every parameter of the request
+// that got it matters as much as any other, so they aren't minimized.
+var minimalKinds = map[string]bool{
+	schema.KindStatus: true,
+	schema.KindSchema: true,
+	leak.Kind:         true,
+}
+
+// Requests sent minimizing everything found on a single route.  Minimizing
+// runs in the fuzz loop, so this bounds how long a route stalls it.
+const maxRouteMinimizeRequests = 2 * minimize.MaxAttempts
+
+// baselines maps parameter names of the route to known good values: the value
+// in the har if there is one, otherwise the first value we sent
+func baselines(route *route.Route) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, param := range route.Params {
+		for _, metadata := range param.GetMetadata() {
+			if len(metadata.Values) > 0 {
+				values[metadata.Name] = metadata.Values[len(metadata.Values)-1]
+			}
+		}
+	}
+	if route.Entries == nil {
+		return values
+	}
+	for _, entry := range *route.Entries {
+		for _, query := range entry.Request.QueryString {
+			values[query.Name] = query.Value
+		}
+		for _, param := range entry.Request.PostData.Params {
+			values[param.Name] = param.Value
+		}
+		var body interface{}
+		if json.Unmarshal([]byte(entry.Request.PostData.Text), &body) == nil {
+			harLeaves(body, values)
+		}
+	}
+	return values
+}
+
+// harLeaves stores every leaf of a json body in values, keyed by the key of
+// the leaf in its parent object
+func harLeaves(node interface{}, values map[string]interface{}) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			switch child.(type) {
+			case map[string]interface{}, []interface{}:
+				harLeaves(child, values)
+			default:
+				values[key] = child
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			harLeaves(child, values)
+		}
+	}
+}
+
+// drain reads the coverage and queries for follow up requests, sent by
+// detectors or while minimizing, so they aren't attributed to the next fuzzed
+// request.  Queries are discarded.  Coverage counts towards the cumulative
+// coverage, but the delta stays that of the fuzzed request.
+func (mutator *Mutator) drain() error {
+	if mutator.SrcCoverage != nil {
+		delta := mutator.SrcCoverage.Delta
+		err := mutator.SrcCoverage.Update()
+		mutator.SrcCoverage.Delta = delta
+		if err != nil {
+			return err
+		}
+	}
+	if mutator.DB == nil {
+		return nil
+	}
+	_, err := mutator.DB.Log.Next()
+	return err
+}
+
+// drainFollowUps drains the instrumentation for the follow up requests sent
+// by detectors.  Exceptions they raised are real bugs, so they're recorded
+// against the current route with the most recent follow up sent by client,
+// or the fuzzed request if client sent nothing.
+func (mutator *Mutator) drainFollowUps(client *httpclient.Client) error {
+	err := mutator.drain()
+	if err != nil {
+		return err
+	}
+	if mutator.ExceptionsManager == nil {
+		return nil
+	}
+	curl := ""
+	if client != nil && client.CurlCmd != nil {
+		curl = client.CurlCmd.String()
+	} else if mutator.lastResult != nil {
+		curl = mutator.lastResult.Curl
+	}
+	route := mutator.currentRoute()
+	return mutator.ExceptionsManager.UpdateFollowUps(route.Path, route.Method, mutator.TargetID, curl)
+}
+
+// exceptionOracle checks if a request still raises the exception
+func (mutator *Mutator) exceptionOracle(client *httpclient.Client, exc exception.Exception) minimize.Oracle {
+	return func(req *http.Request) (bool, error) {
+		_, _, err := detector.Send(client, req)
+		if err != nil {
+			return false, err
+		}
+		if err := mutator.drain(); err != nil {
+			return false, err
+		}
+		return mutator.ExceptionsManager.Reproduces(exc.Method, exc.Path, exc.Fingerprint)
+	}
+}
+
+// findingOracle checks if the detector that reported the finding still
+// verifies it from the response to a request.  Verify doesn't touch the state
+// the detector keeps while fuzzing, unlike Check.
+func (mutator *Mutator) findingOracle(client *httpclient.Client, verifier detector.Verifier,
+	found finding.Finding) minimize.Oracle {
+	return func(req *http.Request) (bool, error) {
+		var reqBody []byte
+		if req.Body != nil {
+			var err error
+			reqBody, err = ioutil.ReadAll(req.Body)
+			if err != nil {
+				return false, errors.WithStack(err)
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		}
+		resp, body, err := detector.Send(client, req)
+		if err != nil {
+			return false, err
+		}
+		if err := mutator.drain(); err != nil {
+			return false, err
+		}
+		// Exceptions raised while minimizing aren't attributed to anything
+		if _, err := mutator.ExceptionsManager.ReadExceptions(); err != nil {
+			return false, err
+		}
+		return verifier.Verify(&found, mutator.newResult(req, reqBody, resp, body, client))
+	}
+}
+
+// budgetSpent checks if the current route has used up its minimize requests
+func (mutator *Mutator) budgetSpent() bool {
+	route := mutator.lastResult.Route
+	stats := mutator.Run.Route(route.Method, route.Path)
+	return stats != nil && stats.MinimizeRequests >= maxRouteMinimizeRequests
+}
+
+// budgeted counts the requests oracle sends in the run stats.  Once the
+// route's budget is spent, the bug is reported gone without sending anything,
+// so the minimizer settles for what it has.
+func (mutator *Mutator) budgeted(oracle minimize.Oracle) minimize.Oracle {
+	route := mutator.lastResult.Route
+	return func(req *http.Request) (bool, error) {
+		if mutator.budgetSpent() {
+			return false, nil
+		}
+		mutator.Run.RecordMinimize(route.Method, route.Path)
+		return oracle(req)
+	}
+}
+
+// minimized shrinks the most recent request with the oracle and returns the
+// curl command for it, or "" if it couldn't be reproduced
+func (mutator *Mutator) minimized(oracle minimize.Oracle) (string, error) {
+	result := mutator.lastResult
+	req, err := minimize.Request(result.Request, result.RequestBody, baselines(result.Route), mutator.budgeted(oracle))
+	if err != nil || req == nil {
+		return "", err
+	}
+	curl, err := http2curl.GetCurlCommand(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return curl.String(), nil
+}
+
+// Minimize finds the smallest request reproducing each exception and finding
+// first seen for the most recent request, and stores it alongside the original
+func (mutator *Mutator) Minimize(client *httpclient.Client) error {
+	if !mutator.minimize || mutator.lastResult == nil {
+		return nil
+	}
+
+	for _, exc := range mutator.ExceptionsManager.Latest {
+		if mutator.budgetSpent() {
+			log.Infof("not minimizing %s, done enough on %s %s", exc.Class, exc.Method, exc.Path)
+			break
+		}
+		curl, err := mutator.minimized(mutator.exceptionOracle(client, exc))
+		if err != nil {
+			return err
+		}
+		if curl == "" {
+			log.Infof("couldn't reproduce %s on %s %s", exc.Class, exc.Method, exc.Path)
+			continue
+		}
+		err = mutator.ExceptionsManager.SetMinimized(exc, curl)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, found := range mutator.FindingsManager.Latest {
+		if minimalKinds[found.Kind] {
+			continue
+		}
+		if mutator.budgetSpent() {
+			log.Infof("not minimizing %s finding, done enough on %s %s", found.Kind, found.Method, found.Path)
+			break
+		}
+		// Only findings that can be verified from a single response are
+		// minimized
+		verifier, ok := mutator.findingDetectors[found.Kind].(detector.Verifier)
+		if !ok {
+			continue
+		}
+		curl, err := mutator.minimized(mutator.findingOracle(client, verifier, found))
+		if errors.Cause(err) == detector.ErrUnverifiable {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if curl == "" {
+			log.Infof("couldn't reproduce %s finding on %s %s", found.Kind, found.Method, found.Path)
+			continue
+		}
+		err = mutator.FindingsManager.SetMinimized(found, curl)
+		if err != nil {
+			return err
+		}
+	}
+	// Verifying sends follow up requests of its own
+	return mutator.drainFollowUps(client)
+}
@@ -0,0 +1,51 @@
+package mutator
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/har"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaselines(t *testing.T) {
+	entry := har.Entry{Request: har.Request{
+		QueryString: []har.Query{{Name: "page", Value: "2"}},
+		PostData: har.PostData{
+			Text: `{"post": {"title": "hello", "tags": [{"name": "go"}]}, "draft": false}`,
+		},
+	}}
+	r := &route.Route{Entries: &[]har.Entry{entry}}
+	values := baselines(r)
+	require.Equal(t, map[string]interface{}{
+		"page":  "2",
+		"title": "hello",
+		"name":  "go",
+		"draft": false,
+	}, values)
+}
+
+func TestBudgeted(t *testing.T) {
+	mutator := mock()
+	mutator.lastResult = &detector.Result{Route: &route.Route{Method: "GET", Path: "/posts"}}
+	sent := 0
+	oracle := mutator.budgeted(func(req *http.Request) (bool, error) {
+		sent++
+		return true, nil
+	})
+
+	// Requests are counted until the route's budget is spent
+	for i := 0; i < maxRouteMinimizeRequests+10; i++ {
+		_, err := oracle(nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, maxRouteMinimizeRequests, sent)
+	require.Equal(t, maxRouteMinimizeRequests, mutator.Run.MinimizeRequests)
+	require.True(t, mutator.budgetSpent())
+	reproduced, err := oracle(nil)
+	require.NoError(t, err)
+	require.False(t, reproduced)
+	require.Zero(t, mutator.Run.Requests)
+}
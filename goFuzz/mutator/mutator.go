@@ -1,19 +1,28 @@
 package mutator
 
 import (
+	"bytes"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/moul/http2curl"
 	"github.com/mruck/athena/goFuzz/coverage"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/metrics"
 	"github.com/mruck/athena/goFuzz/route"
 	"github.com/mruck/athena/goFuzz/sql/postgres"
 	"github.com/mruck/athena/goFuzz/sql/sqlparser"
 	"github.com/mruck/athena/lib/database"
 	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
 	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
 	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
 )
 
 // Mutator contains state for mutating
@@ -26,18 +35,32 @@ type Mutator struct {
 	// Did we get new query coverage?
 	QueryDelta        bool
 	ExceptionsManager *exception.ExceptionsManager
-	TargetID          string
+	// Did a detector inject a payload into the most recent request?
+	InjectionDelta  bool
+	Detectors       []detector.Detector
+	FindingsManager *finding.FindingsManager
+	TargetID        string
 	// Target database
 	DB *postgres.Postgres
+	// Summary of this run
+	Run  *run.Run
+	Runs *run.RunsManager
 	// user specified route via env vars ROUTE and METHOD
 	userRoute *route.Route
+	// Shrink reproducers for new exceptions and findings
+	minimize bool
+	// Detector that reported each kind of finding, for reproducing it
+	findingDetectors map[string]detector.Detector
+	// Most recent request checked by the detectors
+	lastResult *detector.Result
 }
 
-// New creates a new mutator
-func New(routes []*route.Route, corpus []*route.Route) *Mutator {
+// New creates a new mutator.  Stats are recorded to summary.
+func New(routes []*route.Route, corpus []*route.Route, summary *run.Run) *Mutator {
 	// Connect to mongodb to log exceptions
 	db := database.MustGetDatabase(database.MongoDbPort, "athena")
-	manager := exception.NewExceptionsManager(db, exception.Path)
+	srcCoverage, exceptionsPath := newReaders()
+	manager := exception.NewExceptionsManager(db, exceptionsPath)
 
 	// Make the order deterministic for debugging.  Order routes alphabetically
 	route.Order(routes)
@@ -51,11 +74,16 @@ func New(routes []*route.Route, corpus []*route.Route) *Mutator {
 	mutator := &Mutator{
 		Routes:            routes,
 		routeIndex:        -1,
-		SrcCoverage:       coverage.New(coverage.Path),
+		SrcCoverage:       srcCoverage,
 		ExceptionsManager: manager,
+		FindingsManager:   finding.NewFindingsManager(db),
 		TargetID:          util.MustGetTargetID(),
 		DB:                targetDB,
 		SQLParser:         sqlparser.NewParser(),
+		Run:               summary,
+		Runs:              run.NewRunsManager(db),
+		minimize:          os.Getenv("MINIMIZE") != "0",
+		findingDetectors:  map[string]detector.Detector{},
 	}
 
 	// Check if user specified route, and if so update our mutator to reflect that
@@ -66,7 +94,10 @@ func New(routes []*route.Route, corpus []*route.Route) *Mutator {
 
 // Allocate a new dummy mutator.  For testing only.
 func mock() *Mutator {
-	return &Mutator{}
+	return &Mutator{
+		findingDetectors: map[string]detector.Detector{},
+		Run:              run.New(""),
+	}
 }
 
 // get user specified route
@@ -113,7 +144,8 @@ func (mutator *Mutator) Mutate() *route.Route {
 	// We didn't get new coverage, next route
 	if mutator.SrcCoverage.Delta == 0 &&
 		!mutator.QueryDelta &&
-		!mutator.ExceptionsManager.Delta {
+		!mutator.ExceptionsManager.Delta &&
+		!mutator.InjectionDelta {
 		mutator.routeIndex++
 		// A user specified route was provided
 		if mutator.userRoute != nil {
@@ -128,6 +160,7 @@ func (mutator *Mutator) Mutate() *route.Route {
 		}
 	}
 	route := mutator.Routes[mutator.routeIndex]
+	metrics.CurrentRoute(route.Method, route.Path)
 
 	// Mutate each parameter
 	mutator.MutateRoute(route)
@@ -156,6 +189,16 @@ func (mutator *Mutator) currentRoute() *route.Route {
 	return mutator.Routes[mutator.routeIndex]
 }
 
+// Status snapshots the progress of the run
+func (mutator *Mutator) Status(phase string) *run.Status {
+	current := ""
+	if mutator.routeIndex >= 0 && mutator.routeIndex < len(mutator.Routes) {
+		route := mutator.currentRoute()
+		current = run.RouteKey(route.Method, route.Path)
+	}
+	return mutator.Run.Status(phase, current)
+}
+
 func (mutator *Mutator) logStats(route *route.Route) {
 	route.PrettyPrint(nil)
 	//log.Infof("Delta: %v", mutator.SrcCoverage.Delta)
@@ -164,16 +207,26 @@ func (mutator *Mutator) logStats(route *route.Route) {
 }
 
 // UpdateState parses the response and updates source code, parameter and
-// query coverage
-func (mutator *Mutator) UpdateState(resp *http.Response, curlCmd *http2curl.CurlCommand) error {
+// query coverage.  Latency is how long the response took.
+func (mutator *Mutator) UpdateState(resp *http.Response, curlCmd *http2curl.CurlCommand, latency time.Duration) error {
 	// Get current route
 	route := mutator.currentRoute()
 
+	// Count the request
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	mutator.Run.Record(route.Method, route.Path, status)
+	metrics.Request(route.Method, route.Path, status, latency)
+
 	// Update source code coverage
 	err := mutator.SrcCoverage.Update()
 	if err != nil {
 		return err
 	}
+	mutator.Run.UpdateCoverage(mutator.SrcCoverage.Cumulative)
+	metrics.Coverage(mutator.SrcCoverage.Cumulative, mutator.SrcCoverage.Delta)
 
 	// Read log dumped by postgres
 	queries, err := mutator.DB.Log.Next()
@@ -182,7 +235,17 @@ func (mutator *Mutator) UpdateState(resp *http.Response, curlCmd *http2curl.Curl
 	}
 
 	// Triage postgres log for errors, hints, etc
-	mutator.DB.Log.Triage()
+	for _, pgErr := range mutator.DB.Log.Triage() {
+		mutator.Run.AddPostgresError(run.PostgresError{
+			Method:   route.Method,
+			Path:     route.Path,
+			Severity: pgErr.ErrorSeverity,
+			Code:     pgErr.SQLStateCode,
+			Message:  pgErr.Message,
+			Query:    pgErr.Query,
+		})
+		metrics.PostgresError(pgErr.ErrorSeverity)
+	}
 
 	// Search for params present in queries
 	params := route.CurrentParams()
@@ -198,12 +261,133 @@ func (mutator *Mutator) UpdateState(resp *http.Response, curlCmd *http2curl.Curl
 	// TODO: queries will need to be canonicalized. For now lets just
 	// compare tainted queries cause we can just use the struct to compare
 	mutator.QueryDelta = route.UpdateQueries(taintedQueries)
+	mutator.recordTaintedQueries(route, taintedQueries)
+	metrics.TaintedQueries(len(mutator.Run.TaintedQueries))
 
 	// Check for sql inj
 	sqlparser.CheckForSQLInj(queries, params)
 
 	// Store any new exceptions
-	return mutator.ExceptionsManager.Update(route.Path, route.Method, mutator.TargetID, curlCmd)
+	err = mutator.ExceptionsManager.Update(route.Path, route.Method, mutator.TargetID, curlCmd)
+	if err != nil {
+		return err
+	}
+	for _, exc := range mutator.ExceptionsManager.Hits {
+		mutator.Run.AddFinding(run.FromException(exc))
+	}
+	metrics.Exceptions(mutator.ExceptionsManager.Unique())
+	return nil
+}
+
+// recordTaintedQueries stores the table and column each parameter ended up in
+func (mutator *Mutator) recordTaintedQueries(route *route.Route, queries []sqlparser.TaintedQuery) {
+	for _, query := range queries {
+		for _, param := range route.Params {
+			for _, metadata := range param.GetMetadata() {
+				if len(metadata.Values) == 0 || metadata.Values[0] != query.Param {
+					continue
+				}
+				mutator.Run.AddTaintedQuery(run.TaintedQuery{
+					Method: route.Method,
+					Path:   route.Path,
+					Param:  metadata.Name,
+					Table:  query.Table,
+					Column: query.Column,
+					Query:  query.Query,
+				})
+			}
+		}
+	}
+}
+
+// Detect runs each detector against the most recent request and stores any
+// findings.  The response body is consumed.
+func (mutator *Mutator) Detect(req *http.Request, resp *http.Response, client *httpclient.Client) error {
+	// We never got a response
+	if resp == nil {
+		mutator.resetDetectors()
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		mutator.resetDetectors()
+		return errors.WithStack(err)
+	}
+
+	// Keep the request body around for detectors replaying the request
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			mutator.resetDetectors()
+			return errors.WithStack(err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	result := mutator.newResult(req, reqBody, resp, body, client)
+	mutator.lastResult = result
+
+	findings := []*finding.Finding{}
+	for _, detector := range mutator.Detectors {
+		found, err := detector.Check(result)
+		if err != nil {
+			// Don't let one detector stop the others, and keep whatever it
+			// found before the error
+			mutator.LogError(err)
+		}
+		for _, finding := range found {
+			mutator.findingDetectors[finding.Kind] = detector
+		}
+		findings = append(findings, found...)
+	}
+
+	// Detectors may have sent follow up requests
+	err = mutator.drainFollowUps(result.Client)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	// Add extra metadata to the findings
+	for _, finding := range findings {
+		finding.TargetID = mutator.TargetID
+		mutator.Run.AddFinding(run.FromFinding(*finding))
+	}
+	return mutator.FindingsManager.Update(findings)
+}
+
+// resetDetectors drops payloads injected into a request that can't be checked
+func (mutator *Mutator) resetDetectors() {
+	for _, detector := range mutator.Detectors {
+		detector.Reset()
+	}
+}
+
+// newResult describes a request sent for the current route
+func (mutator *Mutator) newResult(req *http.Request, reqBody []byte, resp *http.Response,
+	body []byte, client *httpclient.Client) *detector.Result {
+	result := &detector.Result{
+		Route:       mutator.currentRoute(),
+		Request:     req,
+		RequestBody: reqBody,
+		Response:    resp,
+		Body:        body,
+		Latency:     client.Latency,
+		Redirects:   client.Redirects,
+		// Follow up requests aren't counted as fuzzed
+		Client: client.FollowUp(),
+	}
+	if mutator.DB != nil {
+		result.Queries = mutator.DB.Log.Queries()
+	}
+	if client.CurlCmd != nil {
+		result.Curl = client.CurlCmd.String()
+	}
+	return result
 }
 
 // LogError logs an error with context from the most recent request sent
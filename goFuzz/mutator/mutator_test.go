@@ -0,0 +1,105 @@
+package mutator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/coverage"
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/stretchr/testify/require"
+)
+
+// followUpDetector sends a follow up request for every request checked
+type followUpDetector struct {
+	url string
+}
+
+func (det *followUpDetector) Inject(leaf *detector.Leaf) interface{} {
+	return nil
+}
+
+func (det *followUpDetector) Reset() {}
+
+func (det *followUpDetector) Check(result *detector.Result) ([]*finding.Finding, error) {
+	req, err := http.NewRequest("GET", det.url+"/other", nil)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = detector.Send(result.Client, req)
+	return nil, err
+}
+
+func TestDetectFollowUps(t *testing.T) {
+	// Every request to the target covers another line
+	tmp, err := ioutil.TempFile("/tmp", "cov-")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	lines := []string{"0", "0", "0", "0"}
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lines[hits] = "1"
+		hits++
+		cov := `{"app.rb": [` + lines[0] + `,` + lines[1] + `,` + lines[2] + `,` + lines[3] + `]}`
+		require.NoError(t, ioutil.WriteFile(tmp.Name(), []byte(cov), 0644))
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(u)
+	require.NoError(t, err)
+
+	mutator := mock()
+	mutator.Routes = []*route.Route{&route.Route{Method: "GET", Path: "/posts"}}
+	mutator.routeIndex = 0
+	mutator.SrcCoverage = coverage.New(tmp.Name())
+	mutator.Detectors = []detector.Detector{&followUpDetector{url: ts.URL}}
+
+	req, err := http.NewRequest("GET", ts.URL+"/posts", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, mutator.SrcCoverage.Update())
+	require.Equal(t, 25.0, mutator.SrcCoverage.Delta)
+
+	err = mutator.Detect(req, resp, client)
+	require.NoError(t, err)
+	require.Equal(t, 2, hits)
+	// The follow up isn't counted as fuzzed, and its coverage is read
+	// without changing the delta of the fuzzed request
+	require.Equal(t, map[int]int{200: 1}, client.StatusCodes)
+	require.Equal(t, 25.0, mutator.SrcCoverage.Delta)
+	require.Equal(t, 50.0, mutator.SrcCoverage.Cumulative)
+}
+
+// resetDetector counts the requests it couldn't check
+type resetDetector struct {
+	followUpDetector
+	resets int
+}
+
+func (det *resetDetector) Reset() {
+	det.resets++
+}
+
+func TestDetectNoResponse(t *testing.T) {
+	client, err := httpclient.New(&url.URL{Scheme: "http", Host: "localhost"})
+	require.NoError(t, err)
+	mutator := mock()
+	mutator.Routes = []*route.Route{&route.Route{Method: "GET", Path: "/posts"}}
+	mutator.routeIndex = 0
+	det := &resetDetector{}
+	mutator.Detectors = []detector.Detector{det}
+
+	// Payloads injected into a request that got no response are dropped
+	req, err := http.NewRequest("GET", "http://localhost/posts", nil)
+	require.NoError(t, err)
+	require.NoError(t, mutator.Detect(req, nil, client))
+	require.Equal(t, 1, det.resets)
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 
 	"github.com/go-openapi/spec"
-	"github.com/google/uuid"
+	"github.com/mruck/athena/goFuzz/detector"
 	"github.com/mruck/athena/goFuzz/route"
 	"github.com/mruck/athena/goFuzz/swagger"
 	"github.com/mruck/athena/lib/log"
@@ -16,6 +16,9 @@ import (
 // Setting param.Next for each parameter, or nil if the paramater shouldn't
 // be sent
 func (mutator *Mutator) MutateRoute(route *route.Route) {
+	// Assume no detector wants to inject anything
+	mutator.InjectionDelta = false
+
 	for _, param := range route.Params {
 		mutator.mutateParam(&param.Parameter)
 
@@ -26,7 +29,7 @@ func (mutator *Mutator) MutateRoute(route *route.Route) {
 
 // mutateEnum returns a valid enum for the given schema
 func mutateEnum(enum []interface{}) interface{} {
-	randIndex := int(uuid.New().ID()) % len(enum)
+	randIndex := util.RandIntn(len(enum))
 	return enum[randIndex]
 }
 
@@ -103,13 +106,35 @@ func (mutator *Mutator) mutateTaintedQuery(metadata *swagger.Metadata) interface
 	return val
 }
 
+// inject asks each detector for a payload to send in the leaf, returning the
+// first one offered or nil if no detector is interested
+func (mutator *Mutator) inject(param *spec.Parameter, metadata *swagger.Metadata) interface{} {
+	if len(mutator.Detectors) == 0 {
+		return nil
+	}
+	leaf := detector.NewLeaf(param, metadata)
+	for _, detector := range mutator.Detectors {
+		val := detector.Inject(leaf)
+		if val != nil {
+			mutator.InjectionDelta = true
+			return val
+		}
+	}
+	return nil
+}
+
 // Mutate a body parameter.  At the top level *spec.Parameter, we have a list
 // of custom *swagger.Metadata, each representing a leaf in the body.
 func (mutator *Mutator) mutateBody(param *spec.Parameter) {
 	metadatas := swagger.ReadAllMetadata(param)
 	for _, metadata := range metadatas {
+		// Try injecting a payload for one of our detectors
+		val := mutator.inject(param, metadata)
+
 		// Try query based mutation
-		val := mutator.mutateTaintedQuery(metadata)
+		if val == nil {
+			val = mutator.mutateTaintedQuery(metadata)
+		}
 
 		// Query based mutation failed
 		if val == nil {
@@ -127,9 +152,14 @@ func (mutator *Mutator) mutateBody(param *spec.Parameter) {
 func (mutator *Mutator) mutatePrimitive(param *spec.Parameter) {
 	var val interface{}
 
-	// Try query based mutation
+	// Try injecting a payload for one of our detectors
 	metadata := swagger.ReadOneMetadata(param)
-	val = mutator.mutateTaintedQuery(metadata)
+	val = mutator.inject(param, metadata)
+
+	// Try query based mutation
+	if val == nil {
+		val = mutator.mutateTaintedQuery(metadata)
+	}
 
 	// We failed to use query based mutation
 	if val == nil {
@@ -0,0 +1,45 @@
+package mutator
+
+import (
+	"os"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/coverage"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/log"
+)
+
+// allReaders lists the instrumentation we know how to read after each
+// request.  "coverage" is the json written by our rails, "gocover" is a Go
+// cover profile.
+var allReaders = []string{"coverage", "gocover", "exceptions"}
+
+// defaultReaders are enabled if READERS is unset, matching a rails target
+var defaultReaders = []string{"coverage", "exceptions"}
+
+// newReaders builds the readers listed in the READERS env var, a comma
+// separated list of names.  It returns the source code coverage reader, and
+// the path to read exceptions from or "" if they aren't read.
+func newReaders() (*coverage.Coverage, string) {
+	names := defaultReaders
+	if env := os.Getenv("READERS"); env != "" {
+		names = strings.Split(env, ",")
+	}
+
+	srcCoverage := coverage.New("")
+	exceptionsPath := ""
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "coverage":
+			srcCoverage = coverage.New(coverage.Path)
+		case "gocover":
+			srcCoverage = coverage.NewGoProfile(coverage.GoProfilePath)
+		case "exceptions":
+			exceptionsPath = exception.Path
+		case "none":
+		default:
+			log.Fatalf("unknown reader %q, expected one of %v", name, allReaders)
+		}
+	}
+	return srcCoverage, exceptionsPath
+}
@@ -0,0 +1,30 @@
+package mutator
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/coverage"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReaders(t *testing.T) {
+	defer os.Unsetenv("READERS")
+
+	// Rails by default
+	srcCoverage, exceptionsPath := newReaders()
+	require.Equal(t, coverage.Path, srcCoverage.FilePath)
+	require.Equal(t, exception.Path, exceptionsPath)
+
+	os.Setenv("READERS", "gocover")
+	srcCoverage, exceptionsPath = newReaders()
+	require.Equal(t, coverage.GoProfilePath, srcCoverage.FilePath)
+	require.Equal(t, "", exceptionsPath)
+
+	// Black box targets
+	os.Setenv("READERS", "none")
+	srcCoverage, exceptionsPath = newReaders()
+	require.Equal(t, "", srcCoverage.FilePath)
+	require.Equal(t, "", exceptionsPath)
+}
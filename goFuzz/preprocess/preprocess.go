@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/mruck/athena/goFuzz/har"
+	"github.com/mruck/athena/goFuzz/httpclient"
 	"github.com/mruck/athena/goFuzz/route"
 	"github.com/mruck/athena/lib/util"
 )
@@ -15,6 +16,27 @@ func GetLogin(harPath string) ([]*http.Request, error) {
 	return harObj.ToHTTPRequests()
 }
 
+// GetIdentities parses a json file listing the identities to send requests as
+func GetIdentities(path string) []*httpclient.Identity {
+	identities := []*httpclient.Identity{}
+	util.MustUnmarshalFile(path, &identities)
+	util.Must(len(identities) > 0, "no identities in %v\n", path)
+	return identities
+}
+
+// Login logs the client in as its identity.  Anonymous identities are left
+// logged out.
+func Login(client *httpclient.Client) error {
+	if client.Identity == nil || client.Identity.LoginHar == "" {
+		return nil
+	}
+	login, err := GetLogin(client.Identity.LoginHar)
+	if err != nil {
+		return err
+	}
+	return client.DoAll(login)
+}
+
 // GetCorpus parses a harfile, initializing relevant data in
 // the list of routes.  It returns the har requests as an ordered list of *route.Routes
 func GetCorpus(routes []*route.Route, harPath string) []*route.Route {
@@ -26,3 +26,11 @@ func TestCorpus(t *testing.T) {
 	//	}
 
 }
+
+func TestGetIdentities(t *testing.T) {
+	identities := GetIdentities("../tests/identities.json")
+	require.Equal(t, "admin", identities[0].Name)
+	require.Equal(t, "tests/login_har.json", identities[0].LoginHar)
+	require.Equal(t, "anonymous", identities[1].Name)
+	require.Equal(t, 0, identities[1].Privilege)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mruck/athena/goFuzz/replay"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/lib/database"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+)
+
+// replayMain re-sends the reproducer of every exception and finding stored for
+// a target and reports which still reproduce
+func replayMain(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	targetID := flags.String("target", os.Getenv("TARGET_ID"), "target id to replay findings for")
+	closeFixed := flags.Bool("close", false, "close fixed findings and reopen ones that reproduce")
+	_ = flags.Parse(args)
+	util.Must(*targetID != "", "no target id, pass -target or set TARGET_ID")
+
+	db := database.MustGetDatabase(database.MongoDbPort, "athena")
+	routes := route.FromSwagger(swaggerPath)
+	clients := newClients()
+
+	replayer := replay.New(clients, routes, exception.NewExceptionsManager(db, exception.Path),
+		finding.NewFindingsManager(db), util.DefaultEnv("RESULTS_PATH", "/tmp/results"))
+	replayer.Close = *closeFixed
+	outcomes, err := replayer.Run(*targetID)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	// Report
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tTYPE\tKIND\tROUTE\tPARAM\tERROR")
+	for _, outcome := range outcomes {
+		counts[outcome.Status]++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s %s\t%s\t%s\n", outcome.Status, outcome.Type, outcome.Kind,
+			outcome.Method, outcome.Path, outcome.Param, outcome.Error)
+	}
+	w.Flush()
+	fmt.Printf("%d reproduced, %d fixed, %d unverified, %d errors\n", counts[replay.Reproduced],
+		counts[replay.Fixed], counts[replay.Unverified], counts[replay.Failed])
+}
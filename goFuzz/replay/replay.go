@@ -0,0 +1,249 @@
+package replay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mruck/athena/goFuzz/detector"
+	"github.com/mruck/athena/goFuzz/detector/authz"
+	"github.com/mruck/athena/goFuzz/detector/leak"
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/goFuzz/detector/traversal"
+	"github.com/mruck/athena/goFuzz/detector/xss"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/route"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+)
+
+// Status of a replayed exception or finding
+const (
+	Reproduced = "reproduced"
+	Fixed      = "fixed"
+	// Replaying the request can't tell us either way
+	Unverified = "unverified"
+	// The request couldn't be replayed
+	Failed = "error"
+)
+
+// Outcome of replaying a single exception or finding
+type Outcome struct {
+	// "exception" or "finding"
+	Type string
+	// Exception class or finding kind
+	Kind   string
+	Method string
+	Path   string
+	Param  string
+	Status string
+	Error  string
+}
+
+// Replayer re-sends stored reproducers to the target
+type Replayer struct {
+	// Client for the identity that drove the fuzzer
+	Client *httpclient.Client
+	Routes []*route.Route
+	// Detectors that can verify findings, keyed by finding kind
+	Verifiers  map[string]detector.Verifier
+	Exceptions *exception.ExceptionsManager
+	Findings   *finding.FindingsManager
+	// Close exceptions and findings that are fixed, and reopen closed ones
+	// that reproduce
+	Close bool
+}
+
+// New returns a replayer sending requests as the first client.  The others
+// are used to verify authorization findings.
+func New(clients []*httpclient.Client, routes []*route.Route, exceptions *exception.ExceptionsManager,
+	findings *finding.FindingsManager, resultsPath string) *Replayer {
+	xssDetector := xss.New()
+	schemaDetector := schema.New()
+	authzDetector := authz.New(clients)
+	return &Replayer{
+		Client: clients[0],
+		Routes: routes,
+		Verifiers: map[string]detector.Verifier{
+			xss.KindReflected:   xssDetector,
+			xss.KindStored:      xssDetector,
+			leak.Kind:           leak.New(),
+			schema.KindStatus:   schemaDetector,
+			schema.KindSchema:   schemaDetector,
+			traversal.Kind:      traversal.New(resultsPath),
+			authz.KindIDOR:      authzDetector,
+			authz.KindPrivilege: authzDetector,
+		},
+		Exceptions: exceptions,
+		Findings:   findings,
+	}
+}
+
+// reproducer parses the smallest stored reproducer.  Cookies are stale, the
+// client's cookie jar provides fresh ones.
+func reproducer(curl string, minimized string) (*http.Request, []byte, error) {
+	if minimized != "" {
+		curl = minimized
+	}
+	if curl == "" {
+		return nil, nil, errors.New("no reproducer stored")
+	}
+	req, err := util.ParseCurl(curl)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Del("Cookie")
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return req, body, nil
+}
+
+// findRoute returns the route the finding was reported for, or a bare route
+// if it's no longer in the spec
+func (replayer *Replayer) findRoute(method string, path string) *route.Route {
+	for _, r := range replayer.Routes {
+		if r.Path == path && strings.EqualFold(r.Method, method) {
+			return r
+		}
+	}
+	return &route.Route{Method: method, Path: path}
+}
+
+// failed describes an outcome that couldn't be determined
+func (outcome Outcome) failed(status string, err error) Outcome {
+	outcome.Status = status
+	outcome.Error = err.Error()
+	return outcome
+}
+
+// Exception replays the reproducer for an exception and checks if an
+// exception with the same fingerprint is raised
+func (replayer *Replayer) Exception(exc exception.Exception) Outcome {
+	outcome := Outcome{Type: "exception", Kind: exc.Class, Method: exc.Method, Path: exc.Path}
+	if exc.Fingerprint == "" {
+		return outcome.failed(Unverified, errors.New("exception has no fingerprint"))
+	}
+	req, _, err := reproducer(exc.Curl, exc.MinimizedCurl)
+	if err != nil {
+		return outcome.failed(Unverified, err)
+	}
+
+	// Drop anything logged before we sent the request
+	_, err = replayer.Exceptions.ReadExceptions()
+	if err != nil {
+		return outcome.failed(Failed, err)
+	}
+	_, _, err = detector.Send(replayer.Client, req)
+	if err != nil {
+		return outcome.failed(Failed, err)
+	}
+	reproduced, err := replayer.Exceptions.Reproduces(exc.Method, exc.Path, exc.Fingerprint)
+	if err != nil {
+		return outcome.failed(Failed, err)
+	}
+	outcome.Status = Fixed
+	if reproduced {
+		outcome.Status = Reproduced
+	}
+	return outcome
+}
+
+// Finding replays the reproducer for a finding and asks the detector that
+// reported it whether it still applies
+func (replayer *Replayer) Finding(found finding.Finding) Outcome {
+	outcome := Outcome{Type: "finding", Kind: found.Kind, Method: found.Method, Path: found.Path, Param: found.Param}
+	verifier, ok := replayer.Verifiers[found.Kind]
+	if !ok {
+		return outcome.failed(Unverified, detector.ErrUnverifiable)
+	}
+	req, reqBody, err := reproducer(found.Curl, found.MinimizedCurl)
+	if err != nil {
+		return outcome.failed(Unverified, err)
+	}
+	resp, body, err := detector.Send(replayer.Client, req)
+	if err != nil {
+		return outcome.failed(Failed, err)
+	}
+	result := &detector.Result{
+		Route:       replayer.findRoute(found.Method, found.Path),
+		Request:     req,
+		RequestBody: reqBody,
+		Response:    resp,
+		Body:        body,
+		Latency:     replayer.Client.Latency,
+		Redirects:   replayer.Client.Redirects,
+		Client:      replayer.Client,
+	}
+	if replayer.Client.CurlCmd != nil {
+		result.Curl = replayer.Client.CurlCmd.String()
+	}
+	reproduced, err := verifier.Verify(&found, result)
+	if err == detector.ErrUnverifiable {
+		return outcome.failed(Unverified, err)
+	}
+	if err != nil {
+		return outcome.failed(Failed, err)
+	}
+	outcome.Status = Fixed
+	if reproduced {
+		outcome.Status = Reproduced
+	}
+	return outcome
+}
+
+// closed returns whether an exception or finding should be marked closed
+// given the outcome of replaying it, and whether that's a change
+func closed(outcome Outcome, wasClosed bool) (bool, bool) {
+	switch outcome.Status {
+	case Fixed:
+		return true, !wasClosed
+	case Reproduced:
+		return false, wasClosed
+	}
+	return wasClosed, false
+}
+
+// Run replays every exception and finding stored for the target
+func (replayer *Replayer) Run(targetID string) ([]Outcome, error) {
+	outcomes := []Outcome{}
+
+	exceptions, err := replayer.Exceptions.ReadAll(targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, exc := range exceptions {
+		outcome := replayer.Exception(exc)
+		outcomes = append(outcomes, outcome)
+		if isClosed, changed := closed(outcome, exc.Closed); replayer.Close && changed {
+			err = replayer.Exceptions.SetClosed(exc, isClosed)
+			if err != nil {
+				return outcomes, err
+			}
+		}
+	}
+
+	findings, err := replayer.Findings.GetAll(targetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, found := range findings {
+		outcome := replayer.Finding(found)
+		outcomes = append(outcomes, outcome)
+		if isClosed, changed := closed(outcome, found.Closed); replayer.Close && changed {
+			err = replayer.Findings.SetClosed(found, isClosed)
+			if err != nil {
+				return outcomes, err
+			}
+		}
+	}
+	return outcomes, nil
+}
@@ -0,0 +1,86 @@
+package replay
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/mruck/athena/goFuzz/detector/leak"
+	"github.com/mruck/athena/goFuzz/detector/schema"
+	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinding(t *testing.T) {
+	// Leaks an internal address unless the leak is fixed
+	fixed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Cookie"))
+		if !fixed && r.URL.Query().Get("debug") == "1" {
+			fmt.Fprint(w, "backend at 10.0.0.12")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client, err := httpclient.New(target)
+	require.NoError(t, err)
+	results, err := ioutil.TempDir("", "replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(results)
+	replayer := New([]*httpclient.Client{client}, nil, nil, nil, results)
+
+	// Stored with a stale host and session
+	found := finding.Finding{
+		Kind:   leak.Kind,
+		Method: "GET",
+		Path:   "/status",
+		Param:  "body:internal-address",
+		Curl:   `curl -X 'GET' -H 'Cookie: _session=stale' 'http://fuzzed-pod:3000/status?debug=1&noise=aaaa'`,
+	}
+	outcome := replayer.Finding(found)
+	require.Equal(t, Reproduced, outcome.Status, outcome.Error)
+
+	// The minimized reproducer is preferred
+	found.MinimizedCurl = `curl -X 'GET' 'http://fuzzed-pod:3000/status'`
+	require.Equal(t, Fixed, replayer.Finding(found).Status)
+	found.MinimizedCurl = ""
+
+	fixed = true
+	require.Equal(t, Fixed, replayer.Finding(found).Status)
+
+	// Detectors that can't tell from a single request
+	found.Kind = "ssrf"
+	require.Equal(t, Unverified, replayer.Finding(found).Status)
+	found.Kind = schema.KindStatus
+	require.Equal(t, Unverified, replayer.Finding(found).Status)
+
+	// Nothing to replay
+	found.Kind = leak.Kind
+	found.Curl = ""
+	require.Equal(t, Unverified, replayer.Finding(found).Status)
+}
+
+func TestClosed(t *testing.T) {
+	isClosed, changed := closed(Outcome{Status: Fixed}, false)
+	require.True(t, isClosed)
+	require.True(t, changed)
+
+	isClosed, changed = closed(Outcome{Status: Reproduced}, true)
+	require.False(t, isClosed)
+	require.True(t, changed)
+
+	// Don't touch anything we couldn't verify
+	isClosed, changed = closed(Outcome{Status: Unverified}, true)
+	require.True(t, isClosed)
+	require.False(t, changed)
+	_, changed = closed(Outcome{Status: Failed}, false)
+	require.False(t, changed)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/mruck/athena/goFuzz/report"
+	"github.com/mruck/athena/lib/database"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/run"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+)
+
+// reportMain renders a run against a target, and everything found on the
+// target, as a static html page
+func reportMain(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	targetID := flags.String("target", os.Getenv("TARGET_ID"), "target id to report on")
+	runID := flags.String("run", "", "run to report on, the latest run by default")
+	output := flags.String("o", "report.html", "file to write to")
+	_ = flags.Parse(args)
+	util.Must(*targetID != "", "no target id, pass -target or set TARGET_ID")
+
+	db := database.MustGetDatabase(database.MongoDbPort, "athena")
+	runs := run.NewRunsManager(db)
+	var r *run.Run
+	var err error
+	if *runID == "" {
+		r, err = runs.Latest(*targetID)
+	} else {
+		r, err = runs.Get(*runID)
+	}
+	util.Must(err == nil, "%+v", err)
+	exceptions, err := exception.NewExceptionsManager(db, "").ReadAll(*targetID)
+	util.Must(err == nil, "%+v", err)
+	findings, err := finding.NewFindingsManager(db).GetAll(*targetID)
+	util.Must(err == nil, "%+v", err)
+
+	f, err := os.Create(*output)
+	util.Must(err == nil, "%+v", errors.WithStack(err))
+	defer f.Close()
+	err = report.New(r, exceptions, findings).Render(f)
+	util.Must(err == nil, "%+v", err)
+	log.Infof("wrote report for run %s to %s", r.RunID, *output)
+}
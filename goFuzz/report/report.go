@@ -0,0 +1,216 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/run"
+	"github.com/pkg/errors"
+)
+
+// Size of the coverage chart
+const (
+	chartWidth  = 600
+	chartHeight = 200
+)
+
+// Data is everything rendered in the report
+type Data struct {
+	Run *run.Run
+	// Percentage of requests that got a 2xx
+	SuccessRatio float64
+	StatusCodes  []StatusCount
+	Routes       []Route
+	// Points of the coverage chart in svg coordinates
+	CoveragePoints string
+	ChartWidth     int
+	ChartHeight    int
+	MaxCoverage    float64
+	Columns        []Column
+	Exceptions     []exception.Exception
+	Findings       []finding.Finding
+}
+
+// StatusCount is the number of responses with a status
+type StatusCount struct {
+	Status string
+	Count  int
+	// Share of all requests as a percentage
+	Percent float64
+}
+
+// Route stats with status codes in a stable order
+type Route struct {
+	*run.RouteStats
+	StatusCodes []StatusCount
+	// Responses that weren't a 5xx or error as a percentage
+	Healthy float64
+}
+
+// Column of the database that parameters ended up in
+type Column struct {
+	Table  string
+	Column string
+	// "METHOD path param" of each parameter
+	Params []string
+}
+
+// statusCounts orders status codes, with requests that got no response last
+// since "error" sorts after the digits
+func statusCounts(codes map[string]int, total int) []StatusCount {
+	counts := []StatusCount{}
+	for status, count := range codes {
+		percent := 0.0
+		if total > 0 {
+			percent = float64(count) / float64(total) * 100
+		}
+		counts = append(counts, StatusCount{Status: status, Count: count, Percent: percent})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Status < counts[j].Status
+	})
+	return counts
+}
+
+// success checks if a status code is a 2xx
+func success(status string) bool {
+	code, err := strconv.Atoi(status)
+	return err == nil && code >= 200 && code < 300
+}
+
+// healthy checks if a status code isn't a server error
+func healthy(status string) bool {
+	code, err := strconv.Atoi(status)
+	return err == nil && code < 500
+}
+
+// chart converts coverage samples to svg polyline points
+func chart(samples []run.Sample, requests int) (string, float64) {
+	maxCoverage := 0.0
+	for _, sample := range samples {
+		if sample.Coverage > maxCoverage {
+			maxCoverage = sample.Coverage
+		}
+	}
+	if maxCoverage == 0 {
+		maxCoverage = 1
+	}
+	if requests == 0 {
+		requests = 1
+	}
+	points := []string{}
+	for _, sample := range samples {
+		x := float64(sample.Requests) / float64(requests) * chartWidth
+		y := chartHeight - sample.Coverage/maxCoverage*chartHeight
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " "), maxCoverage
+}
+
+// columns groups tainted queries by the column they touched
+func columns(tainted []run.TaintedQuery) []Column {
+	byColumn := map[string]*Column{}
+	for _, query := range tainted {
+		key := query.Table + "." + query.Column
+		column, ok := byColumn[key]
+		if !ok {
+			column = &Column{Table: query.Table, Column: query.Column}
+			byColumn[key] = column
+		}
+		column.Params = append(column.Params, strings.ToUpper(query.Method)+" "+query.Path+" "+query.Param)
+	}
+	result := []Column{}
+	for _, column := range byColumn {
+		sort.Strings(column.Params)
+		result = append(result, *column)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Table != result[j].Table {
+			return result[i].Table < result[j].Table
+		}
+		return result[i].Column < result[j].Column
+	})
+	return result
+}
+
+// severityRank orders exceptions from most to least interesting
+var severityRank = map[string]int{exception.Security: 0, exception.High: 1, exception.Low: 2}
+
+// New prepares a run and everything found during it for rendering
+func New(r *run.Run, exceptions []exception.Exception, findings []finding.Finding) *Data {
+	data := &Data{
+		Run:         r,
+		StatusCodes: statusCounts(r.StatusCodes, r.Requests),
+		ChartWidth:  chartWidth,
+		ChartHeight: chartHeight,
+		Columns:     columns(r.TaintedQueries),
+		Exceptions:  append([]exception.Exception{}, exceptions...),
+		Findings:    findings,
+	}
+	data.CoveragePoints, data.MaxCoverage = chart(r.Samples, r.Requests)
+
+	successes := 0
+	for status, count := range r.StatusCodes {
+		if success(status) {
+			successes += count
+		}
+	}
+	if r.Requests > 0 {
+		data.SuccessRatio = float64(successes) / float64(r.Requests) * 100
+	}
+
+	for _, stats := range r.SortedRoutes() {
+		route := Route{RouteStats: stats, StatusCodes: statusCounts(stats.StatusCodes, stats.Requests)}
+		ok := 0
+		for status, count := range stats.StatusCodes {
+			if healthy(status) {
+				ok += count
+			}
+		}
+		if stats.Requests > 0 {
+			route.Healthy = float64(ok) / float64(stats.Requests) * 100
+		}
+		data.Routes = append(data.Routes, route)
+	}
+
+	// Most severe and most frequent bugs first
+	sort.SliceStable(data.Exceptions, func(i, j int) bool {
+		a, b := data.Exceptions[i], data.Exceptions[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		return a.Count > b.Count
+	})
+	return data
+}
+
+var funcs = template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f) },
+	"frames": func(exc exception.Exception) []exception.Frame {
+		frames := exc.AppFrames()
+		if len(frames) > 5 {
+			frames = frames[:5]
+		}
+		return frames
+	},
+	"reproducer": func(curl string, minimized string) string {
+		if minimized != "" {
+			return minimized
+		}
+		return curl
+	},
+	"join": strings.Join,
+}
+
+var page = template.Must(template.New("report").Funcs(funcs).Parse(pageTemplate))
+
+// Render writes the report as a single html page with no external resources
+func (data *Data) Render(w io.Writer) error {
+	return errors.WithStack(page.Execute(w, data))
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/mruck/athena/lib/run"
+	"github.com/stretchr/testify/require"
+)
+
+func testRun() *run.Run {
+	r := run.New("target")
+	r.Record("get", "/posts/{id}.json", 200)
+	r.UpdateCoverage(10)
+	r.Record("get", "/posts/{id}.json", 500)
+	r.UpdateCoverage(10)
+	r.Record("post", "/posts", 0)
+	r.UpdateCoverage(20)
+	r.AddTaintedQuery(run.TaintedQuery{Method: "POST", Path: "/posts", Param: "title", Table: "posts", Column: "title"})
+	r.AddTaintedQuery(run.TaintedQuery{Method: "PUT", Path: "/posts/{id}", Param: "title", Table: "posts", Column: "title"})
+	r.AddPostgresError(run.PostgresError{Method: "GET", Path: "/posts/{id}.json", Severity: "ERROR", Code: "22P02", Message: "invalid input syntax"})
+	return r
+}
+
+func TestNew(t *testing.T) {
+	exceptions := []exception.Exception{
+		{Class: "ArgumentError", Severity: exception.Low, Count: 10},
+		{Class: "NoMethodError", Severity: exception.High, Count: 1},
+		{Class: "ActiveRecord::StatementInvalid", Severity: exception.High, Count: 5},
+	}
+	data := New(testRun(), exceptions, nil)
+
+	require.InDelta(t, 100.0/3, data.SuccessRatio, 0.01)
+	statuses := []string{}
+	for _, count := range data.StatusCodes {
+		statuses = append(statuses, count.Status)
+		require.InDelta(t, 100.0/3, count.Percent, 0.01)
+	}
+	require.Equal(t, []string{"200", "500", "error"}, statuses)
+
+	require.Len(t, data.Routes, 2)
+	require.Equal(t, "/posts", data.Routes[0].Path)
+	require.Equal(t, 0.0, data.Routes[0].Healthy)
+	require.Equal(t, 50.0, data.Routes[1].Healthy)
+
+	// Coverage only changed twice
+	require.Equal(t, "200.0,100.0 600.0,0.0", data.CoveragePoints)
+	require.Equal(t, 20.0, data.MaxCoverage)
+
+	require.Equal(t, []Column{{Table: "posts", Column: "title", Params: []string{"POST /posts title", "PUT /posts/{id} title"}}}, data.Columns)
+
+	// Most severe, then most frequent first
+	classes := []string{}
+	for _, exc := range data.Exceptions {
+		classes = append(classes, exc.Class)
+	}
+	require.Equal(t, []string{"ActiveRecord::StatementInvalid", "NoMethodError", "ArgumentError"}, classes)
+}
+
+func TestRender(t *testing.T) {
+	exceptions := []exception.Exception{
+		{
+			Method:        "GET",
+			Path:          "/posts/{id}",
+			Class:         "NoMethodError",
+			Message:       "undefined method `name' for nil:NilClass",
+			Curl:          "curl 'http://localhost:3000/posts/1?a=<script>'",
+			MinimizedCurl: "curl 'http://localhost:3000/posts/1'",
+			Severity:      exception.High,
+			Backtrace:     []string{"/var/www/discourse/app/controllers/posts_controller.rb:123:in `show'"},
+			Count:         3,
+			Routes:        []string{"GET /posts/{id}"},
+		},
+	}
+	findings := []finding.Finding{{Kind: "dos", Method: "GET", Path: "/posts", Message: "slow"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, New(testRun(), exceptions, findings).Render(&buf))
+	html := buf.String()
+	require.Contains(t, html, "<polyline")
+	require.Contains(t, html, "posts_controller.rb:123 show")
+	require.Contains(t, html, "curl &#39;http://localhost:3000/posts/1&#39;")
+	require.Contains(t, html, "22P02")
+	require.Contains(t, html, "dos")
+	// Reproducers are escaped
+	require.NotContains(t, html, "<script>")
+}
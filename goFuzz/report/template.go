@@ -0,0 +1,97 @@
+package report
+
+// Everything is inlined so the report can be mailed around or attached to a
+// ticket as a single file
+const pageTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Athena report for {{.Run.TargetID}}</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1, h2 { font-weight: 400; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+pre { white-space: pre-wrap; word-break: break-all; margin: 0; font-size: 12px; }
+.security { color: #b00020; font-weight: bold; }
+.high { color: #d35400; }
+.low { color: #777; }
+.closed { color: #999; text-decoration: line-through; }
+svg { border: 1px solid #ddd; margin-bottom: 2em; }
+</style>
+</head>
+<body>
+<h1>Athena report for {{.Run.TargetID}}</h1>
+<table>
+<tr><th>Run</th><td>{{.Run.RunID}}</td></tr>
+{{if .Run.GitRef}}<tr><th>Git ref</th><td>{{.Run.GitRef}}</td></tr>
+{{end}}<tr><th>Seed</th><td>{{.Run.Seed}}</td></tr>
+<tr><th>Start</th><td>{{.Run.Start.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><th>End</th><td>{{if .Run.End.IsZero}}in progress{{else}}{{.Run.End.Format "2006-01-02 15:04:05 MST"}}{{end}}</td></tr>
+<tr><th>Requests</th><td>{{.Run.Requests}}</td></tr>
+<tr><th>Minimize requests</th><td>{{.Run.MinimizeRequests}}</td></tr>
+<tr><th>Coverage</th><td>{{percent .Run.Coverage}}</td></tr>
+<tr><th>Success ratio</th><td>{{percent .SuccessRatio}}</td></tr>
+</table>
+
+<h2>Status codes</h2>
+<table>
+<tr><th>Status</th><th>Count</th><th>Share</th></tr>
+{{range .StatusCodes}}<tr><td>{{.Status}}</td><td>{{.Count}}</td><td>{{percent .Percent}}</td></tr>
+{{end}}</table>
+
+<h2>Coverage over time</h2>
+{{if .CoveragePoints}}<svg width="{{.ChartWidth}}" height="{{.ChartHeight}}" viewBox="0 0 {{.ChartWidth}} {{.ChartHeight}}">
+<polyline fill="none" stroke="#2e86de" stroke-width="2" points="{{.CoveragePoints}}"/>
+<text x="4" y="14" font-size="12">{{percent .MaxCoverage}}</text>
+<text x="4" y="{{.ChartHeight}}" dy="-4" font-size="12">0 requests</text>
+<text x="{{.ChartWidth}}" y="{{.ChartHeight}}" dx="-4" dy="-4" font-size="12" text-anchor="end">{{.Run.Requests}} requests</text>
+</svg>{{else}}<p>No coverage samples.</p>{{end}}
+
+<h2>Routes</h2>
+<table>
+<tr><th>Route</th><th>Requests</th><th>Non 5xx</th><th>Status codes</th></tr>
+{{range .Routes}}<tr><td>{{.Method}} {{.Path}}</td><td>{{.Requests}}</td><td>{{percent .Healthy}}</td><td>{{range .StatusCodes}}{{.Status}}: {{.Count}} {{end}}</td></tr>
+{{end}}</table>
+
+<h2>Tainted columns</h2>
+{{if .Columns}}<table>
+<tr><th>Table</th><th>Column</th><th>Parameters</th></tr>
+{{range .Columns}}<tr><td>{{.Table}}</td><td>{{.Column}}</td><td>{{range .Params}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>{{else}}<p>No parameters were traced to the database.</p>{{end}}
+
+<h2>Exceptions</h2>
+{{if .Exceptions}}<table>
+<tr><th>Exception</th><th>Severity</th><th>Count</th><th>Routes</th><th>Frames</th><th>Reproducer</th></tr>
+{{range .Exceptions}}<tr{{if .Closed}} class="closed"{{end}}>
+<td><b>{{.Class}}</b><br>{{.Message}}<br><small>{{.Fingerprint}}</small></td>
+<td class="{{.Severity}}">{{.Severity}}</td>
+<td>{{.Count}}</td>
+<td>{{range .Routes}}{{.}}<br>{{end}}</td>
+<td><pre>{{range frames .}}{{.File}}:{{.Line}} {{.Method}}
+{{end}}</pre></td>
+<td><pre>{{reproducer .Curl .MinimizedCurl}}</pre>{{if .MinimizedCurl}}<details><summary>original</summary><pre>{{.Curl}}</pre></details>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>No exceptions.</p>{{end}}
+
+<h2>Findings</h2>
+{{if .Findings}}<table>
+<tr><th>Kind</th><th>Route</th><th>Param</th><th>Message</th><th>Reproducer</th></tr>
+{{range .Findings}}<tr{{if .Closed}} class="closed"{{end}}>
+<td>{{.Kind}}</td>
+<td>{{.Method}} {{.Path}}</td>
+<td>{{.Param}}</td>
+<td>{{.Message}}</td>
+<td><pre>{{reproducer .Curl .MinimizedCurl}}</pre>{{if .MinimizedCurl}}<details><summary>original</summary><pre>{{.Curl}}</pre></details>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>No findings.</p>{{end}}
+
+<h2>Postgres errors</h2>
+{{if .Run.PostgresErrors}}<table>
+<tr><th>Route</th><th>Severity</th><th>Code</th><th>Message</th><th>Query</th></tr>
+{{range .Run.PostgresErrors}}<tr><td>{{.Method}} {{.Path}}</td><td>{{.Severity}}</td><td>{{.Code}}</td><td>{{.Message}}</td><td><pre>{{.Query}}</pre></td></tr>
+{{end}}</table>{{else}}<p>No postgres errors.</p>{{end}}
+</body>
+</html>
+`
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/mruck/athena/goFuzz/swagger"
 	"github.com/mruck/athena/lib/log"
 	"github.com/mruck/athena/lib/util"
 	"github.com/pkg/errors"
@@ -23,7 +25,7 @@ func (route *Route) SetPathParams() string {
 				// Give it a dummy value so we can continue
 				param.Next = "deadbeef"
 			}
-			stringified := util.Stringify(param.Next)
+			stringified := url.PathEscape(util.Stringify(param.Next))
 			replacer := strings.NewReplacer("{"+param.Name+"}", stringified)
 			path = replacer.Replace(path)
 		}
@@ -42,15 +44,14 @@ func (route *Route) GetQueryStr() string {
 				err := fmt.Errorf("param %v is nil", param.Name)
 				panic(errors.WithStack(err))
 			}
-			stringified := util.Stringify(param.Next)
-			querystr += param.Name + "=" + stringified + "&"
+			stringified := url.QueryEscape(util.Stringify(param.Next))
+			querystr += url.QueryEscape(param.Name) + "=" + stringified + "&"
 		}
 	}
 	// We never added anything
 	if querystr == "?" {
 		return ""
 	}
-	// TODO: URL encoding?
 	// Strip the trailing &
 	return strings.TrimSuffix(querystr, "&")
 }
@@ -94,3 +95,31 @@ func (route *Route) ToHTTPRequest() (*http.Request, error) {
 	}
 	return req, nil
 }
+
+// FormatParams sets param.Next for each parameter from the most recent values
+// stored in its metadata.  Parameters that were never set are skipped.
+func (route *Route) FormatParams() {
+	for _, param := range route.Params {
+		if param.Next == nil {
+			continue
+		}
+		param.Next = swagger.Format(&param.Parameter)
+	}
+}
+
+// Variant converts the most recent request to an http.Request with a single
+// leaf set to val.  The mutation state of the route is restored afterwards, so
+// this can be used to send follow up requests without disturbing the mutator.
+func (route *Route) Variant(leaf *swagger.Metadata, val interface{}) (*http.Request, error) {
+	// Temporarily store the new value
+	leaf.Values = append([]interface{}{val}, leaf.Values...)
+	route.FormatParams()
+
+	req, err := route.ToHTTPRequest()
+
+	// Restore the old value
+	leaf.Values = leaf.Values[1:]
+	route.FormatParams()
+
+	return req, err
+}
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/mruck/athena/goFuzz/httpclient"
+	"github.com/mruck/athena/goFuzz/swagger"
 	"github.com/mruck/athena/lib/util"
 	"github.com/stretchr/testify/require"
 )
@@ -138,3 +139,31 @@ func TestSendBodyParams(t *testing.T) {
 func TestSendPathParams(t *testing.T) {
 	mockServer(t, pathTestfile, handlePathParam)
 }
+
+func TestVariant(t *testing.T) {
+	route := getRoute(queryTestfile)
+	for _, param := range route.Params {
+		swagger.StoreValue(&param.Parameter, "original")
+	}
+	route.FormatParams()
+	leaf := swagger.ReadOneMetadata(&route.Params[0].Parameter)
+
+	// The variant should carry the new value
+	req, err := route.Variant(leaf, "variant")
+	require.NoError(t, err)
+	require.True(t, strings.Contains(req.URL.RawQuery, "variant"))
+
+	// The route should be left untouched
+	req, err = route.ToHTTPRequest()
+	require.NoError(t, err)
+	require.False(t, strings.Contains(req.URL.RawQuery, "variant"))
+	require.Equal(t, "original", leaf.Values[0])
+}
+
+func TestQueryStrEscaped(t *testing.T) {
+	route := getRoute(queryTestfile)
+	route.Params[0].Next = "<a href='x'>&"
+	req, err := route.ToHTTPRequest()
+	require.NoError(t, err)
+	require.Equal(t, "<a href='x'>&", req.URL.Query().Get(route.Params[0].Name))
+}
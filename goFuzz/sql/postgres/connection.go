@@ -39,6 +39,26 @@ func (conn *Connection) LookUp(table string, col string) interface{} {
 	return val
 }
 
+// Columns returns the names of the columns in table
+func (conn *Connection) Columns(table string) ([]string, error) {
+	stmt := "SELECT column_name FROM information_schema.columns WHERE table_name = $1"
+	rows, err := conn.db.Query(stmt, table)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		err := rows.Scan(&column)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		columns = append(columns, column)
+	}
+	return columns, errors.WithStack(rows.Err())
+}
+
 // Generate table for testing. Returns the table name and any error
 func (conn *Connection) mockTable() (string, error) {
 	tableName := "table_" + util.RandString()[:4]
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mruck/athena/lib/log"
 	"github.com/mruck/athena/lib/util"
@@ -26,8 +29,8 @@ const (
 	Query         = 19
 )
 
-// jsonifiedQuery is for converting a query in array form to struct form
-type jsonifiedQuery struct {
+// LoggedQuery is a query from the log converted from array form to struct form
+type LoggedQuery struct {
 	LogTime       string
 	ErrorSeverity string
 	SQLStateCode  string
@@ -123,8 +126,8 @@ func (pglog *PGLog) Next() ([]string, error) {
 	return raw, nil
 }
 
-func toStruct(query []string) jsonifiedQuery {
-	return jsonifiedQuery{
+func toStruct(query []string) LoggedQuery {
+	return LoggedQuery{
 		LogTime:       query[LogTime],
 		ErrorSeverity: query[ErrorSeverity],
 		SQLStateCode:  query[SQLStateCode],
@@ -142,8 +145,10 @@ func toStruct(query []string) jsonifiedQuery {
 // ignoring it but eventually I should figure it out and fix it
 const vagrantMsg = "role \"vagrant\" does not exist"
 
-// Triage the postgres log for hints, errors, etc
-func (pglog *PGLog) Triage() {
+// Triage the postgres log for hints, errors, etc.  Errors are written to the
+// triaged log and returned.
+func (pglog *PGLog) Triage() []LoggedQuery {
+	triaged := []LoggedQuery{}
 	for _, query := range pglog.queryMetadata {
 		isErr := isPostgresError(query[ErrorSeverity])
 		// Nothing went wrong
@@ -154,17 +159,76 @@ func (pglog *PGLog) Triage() {
 			continue
 		}
 		data := toStruct(query)
+		triaged = append(triaged, data)
 		JSONData, err := json.Marshal(data)
 		if err != nil {
 			log.Errorf("Failed to triage postgres log: %+v", errors.WithStack(err))
-			return
+			return triaged
 		}
 		_, err = pglog.triagedLog.Write(append(JSONData, '\n'))
 		if err != nil {
 			log.Errorf("Failed to triage postgres log: %+v", errors.WithStack(err))
-			return
+			return triaged
 		}
 	}
+	return triaged
+}
+
+// Postgres prefixes the message with the statement duration when durations are
+// logged (i.e. via log_min_duration_statement or log_duration):
+// "duration: 0.045 ms  statement: SELECT 1"
+// If the statement was already logged because of log_statement, the message is
+// just the duration: "duration: 0.045 ms"
+var durationRe = regexp.MustCompile(`^duration: ([0-9.]+) ms\s*`)
+
+// TimedQuery is a query logged by postgres along with how long it took to run
+type TimedQuery struct {
+	Query    string
+	Duration time.Duration
+}
+
+// parseDuration extracts the statement duration from a postgres log message.
+// The bool is false if no duration was logged.
+func parseDuration(message string) (time.Duration, bool) {
+	match := durationRe.FindStringSubmatch(message)
+	if match == nil {
+		return 0, false
+	}
+	ms, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms * float64(time.Millisecond)), true
+}
+
+// Queries returns the raw queries read by the most recent call to Next
+func (pglog *PGLog) Queries() []string {
+	return pglog.extractRawQueries()
+}
+
+// TimedQueries returns the queries read by the most recent call to Next that
+// postgres logged a duration for.  A bare duration message is attributed to
+// the statement logged before it.
+func (pglog *PGLog) TimedQueries() []TimedQuery {
+	timed := []TimedQuery{}
+	previous := ""
+	for _, query := range pglog.queryMetadata {
+		if isPostgresError(query[ErrorSeverity]) {
+			continue
+		}
+		raw := sanitize(query[Message])
+		duration, ok := parseDuration(query[Message])
+		if !ok {
+			previous = raw
+			continue
+		}
+		// The statement was logged on its own line
+		if raw == "" {
+			raw = previous
+		}
+		timed = append(timed, TimedQuery{Query: raw, Duration: duration})
+	}
+	return timed
 }
 
 // Sanitize the query emitted by postgres log.
@@ -173,6 +237,12 @@ func (pglog *PGLog) Triage() {
 // This causes the sql parser to return an error.  Sanitize so that it looks like:
 // "SELECT  users.* FROM users WHERE users.username_lower = 'd0f815' LIMIT 1"
 func sanitize(query string) string {
+	// Strip the statement duration if present
+	query = durationRe.ReplaceAllString(query, "")
+	if query == "" {
+		return ""
+	}
+
 	// Trim leading prefix up to semicolon
 	trimmed := strings.SplitN(query, ":", 2)
 	if len(trimmed) == 2 {
@@ -204,7 +274,12 @@ func (pglog *PGLog) extractRawQueries() []string {
 		if isPostgresError(query[ErrorSeverity]) {
 			continue
 		}
-		rawQueries = append(rawQueries, sanitize(query[Message]))
+		raw := sanitize(query[Message])
+		// This message only contained the duration of a query
+		if raw == "" {
+			continue
+		}
+		rawQueries = append(rawQueries, raw)
 	}
 	return rawQueries
 }
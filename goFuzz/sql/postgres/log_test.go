@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/mruck/athena/lib/util"
 	"github.com/stretchr/testify/require"
@@ -107,12 +108,13 @@ func TestNext(t *testing.T) {
 		"syntax error at or near \"(\"",
 		"column \"sunnyvale\" does not exist",
 	}
-	pgReader.Triage()
+	triaged := pgReader.Triage()
+	require.Len(t, triaged, len(correctMessages))
 	require.NoError(t, err)
 	lines, err := util.ReadFileLineByLine(path)
 	require.NoError(t, err)
 	for i, line := range lines {
-		jsonified := &jsonifiedQuery{}
+		jsonified := &LoggedQuery{}
 		err = json.Unmarshal([]byte(line), jsonified)
 		require.NoError(t, err)
 		require.Equal(t, correctMessages[i], jsonified.Message)
@@ -136,3 +138,19 @@ func TestNext(t *testing.T) {
 		require.NotEqual(t, ts, record[LogTime])
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	duration, ok := parseDuration("duration: 1.500 ms  statement: SELECT 1")
+	require.True(t, ok)
+	require.Equal(t, 1500*time.Microsecond, duration)
+	require.Equal(t, "SELECT 1", sanitize("duration: 1.500 ms  statement: SELECT 1"))
+
+	// The statement was logged separately
+	duration, ok = parseDuration("duration: 20 ms")
+	require.True(t, ok)
+	require.Equal(t, 20*time.Millisecond, duration)
+	require.Equal(t, "", sanitize("duration: 20 ms"))
+
+	_, ok = parseDuration("statement: SELECT 1")
+	require.False(t, ok)
+}
@@ -11,8 +11,8 @@ import (
 const object = "object"
 const array = "array"
 
-func embedLeaf(schema *spec.Schema) []*Metadata {
-	data := newMetadata(*schema)
+func embedLeaf(schema *spec.Schema, name string) []*Metadata {
+	data := newMetadata(*schema, name)
 	embedSelfReferentialPtr(schema, data)
 	return []*Metadata{data}
 }
@@ -29,7 +29,7 @@ func embedObj(properties *map[string]spec.Schema) []*Metadata {
 		// Hack: pass schema by reference even though its scope is limited to
 		// the for loop so that we can modify in place and store shortly after
 		// in a newly mockd spec.Properties map
-		leaves := embedSchema(&schema)
+		leaves := embedSchema(&schema, key)
 
 		// Store the Metadata for each child
 		MetadataLeaves = append(MetadataLeaves, leaves...)
@@ -46,7 +46,7 @@ func embedObj(properties *map[string]spec.Schema) []*Metadata {
 	return MetadataLeaves
 }
 
-func embedArray(items *spec.SchemaOrArray) []*Metadata {
+func embedArray(items *spec.SchemaOrArray, name string) []*Metadata {
 	schema := items.Schema
 	if schema == nil {
 		err := fmt.Errorf("unhandled: SchemaOrArray is array")
@@ -58,19 +58,22 @@ func embedArray(items *spec.SchemaOrArray) []*Metadata {
 		return embedObj(&schema.Properties)
 	}
 
-	// Array elements are primitive, we are in the base case
-	return embedLeaf(schema)
+	// Array elements are primitive, we are in the base case.  The elements
+	// are named after the array itself
+	return embedLeaf(schema, name)
 }
 
-func embedSchema(schema *spec.Schema) []*Metadata {
+// embedSchema embeds Metadata in every leaf of the schema.  `name` is the key
+// the schema is stored under in its parent object
+func embedSchema(schema *spec.Schema, name string) []*Metadata {
 	if schema.Type[0] == object {
 		return embedObj(&schema.Properties)
 	}
 	if schema.Type[0] == array {
-		return embedArray(schema.Items)
+		return embedArray(schema.Items, name)
 	}
 	// This is a leaf
-	return embedLeaf(schema)
+	return embedLeaf(schema, name)
 }
 
 // EmbedParam embeds a list of Metadata objects inside a
@@ -83,7 +86,7 @@ func EmbedParam(param *spec.Parameter) {
 	// Handle body
 	if param.In == "body" {
 		// Allocate a Metadata object for each leaf, and embed a pointer to it
-		MetadataLeaves := embedSchema(param.Schema)
+		MetadataLeaves := embedSchema(param.Schema, param.Name)
 		// Store in a list because its easier to manipulate
 		embedMetadata(param, MetadataLeaves)
 		return
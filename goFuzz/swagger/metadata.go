@@ -24,6 +24,9 @@ const xreferential = "x-self-referential"
 // to set next values and store past values.  Multi level parameters
 // store pointers to this at the leaf level and read the next value from here
 type Metadata struct {
+	// Name of the leaf.  For body params this is the key of the leaf in its
+	// parent object, otherwise it is the parameter name
+	Name string
 	// Store past and present values
 	Values []interface{}
 	// Store a copy of the leaf for multi level data structures.
@@ -83,8 +86,9 @@ func UpdateMetadata(param *spec.Parameter, metadata *Metadata) {
 }
 
 // Allocate a new Metadata object
-func newMetadata(schema spec.Schema) *Metadata {
+func newMetadata(schema spec.Schema, name string) *Metadata {
 	return &Metadata{
+		Name:   name,
 		Values: []interface{}{},
 		Schema: schema,
 	}
@@ -96,7 +100,7 @@ func newMetadata(schema spec.Schema) *Metadata {
 func embedMetadata(param *spec.Parameter, MetadataLeaves []*Metadata) {
 	if MetadataLeaves == nil {
 		// Allocate an empty meta data obj
-		meta := newMetadata(spec.Schema{})
+		meta := newMetadata(spec.Schema{}, param.Name)
 		MetadataLeaves = []*Metadata{meta}
 	}
 	param.VendorExtensible.AddExtension(xmetadata, MetadataLeaves)
@@ -10,7 +10,6 @@ import (
 	"fmt"
 
 	"github.com/go-openapi/spec"
-	"github.com/google/uuid"
 	"github.com/mruck/athena/lib/log"
 	"github.com/mruck/athena/lib/util"
 	"github.com/pkg/errors"
@@ -87,7 +86,7 @@ func mockArray(items *spec.SchemaOrArray) []interface{} {
 
 // mockEnum returns a valid enum for the given schema
 func mockEnum(enum []interface{}) interface{} {
-	randIndex := int(uuid.New().ID()) % len(enum)
+	randIndex := util.RandIntn(len(enum))
 	return enum[randIndex]
 }
 
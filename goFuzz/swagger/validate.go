@@ -0,0 +1,122 @@
+package swagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/go-openapi/spec"
+)
+
+// Violation of a schema by a json document
+type Violation struct {
+	// Location of the offending value, i.e. $.category.id
+	Path    string
+	Message string
+}
+
+// Validate checks data, as decoded by encoding/json, against schema.  This is
+// a subset of json schema: type, required, properties, additionalProperties,
+// items and enum.  Nulls are accepted anywhere since swagger 2.0 can't
+// declare them and every rails app returns them.  Unresolved refs are
+// accepted as well.
+func Validate(schema *spec.Schema, data interface{}) []Violation {
+	violations := []Violation{}
+	validate(schema, data, "$", &violations)
+	return violations
+}
+
+func validate(schema *spec.Schema, data interface{}, path string, violations *[]Violation) {
+	if schema == nil || data == nil || schema.Ref.String() != "" {
+		return
+	}
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(schema.Type) > 0 && !matchesType(schema.Type, data) {
+		add("expected %v, got %s", []string(schema.Type), jsonType(data))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, data) {
+		add("%v not in enum %v", data, schema.Enum)
+	}
+
+	switch typed := data.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := typed[name]; !ok {
+				add("missing required property %s", name)
+			}
+		}
+		for name, value := range typed {
+			child, ok := schema.Properties[name]
+			if ok {
+				validate(&child, value, path+"."+name, violations)
+				continue
+			}
+			additional := schema.AdditionalProperties
+			if additional == nil {
+				continue
+			}
+			if !additional.Allows {
+				add("undeclared property %s", name)
+			} else if additional.Schema != nil {
+				validate(additional.Schema, value, path+"."+name, violations)
+			}
+		}
+	case []interface{}:
+		if schema.Items == nil || schema.Items.Schema == nil {
+			return
+		}
+		for i, elem := range typed {
+			validate(schema.Items.Schema, elem, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	}
+}
+
+// matchesType checks if data is one of the swagger types
+func matchesType(types spec.StringOrArray, data interface{}) bool {
+	actual := jsonType(data)
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the swagger type of a decoded json value
+func jsonType(data interface{}) string {
+	switch typed := data.(type) {
+	case map[string]interface{}:
+		return object
+	case []interface{}:
+		return array
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", data)
+}
+
+func inEnum(enum []interface{}, data interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", data) {
+			return true
+		}
+	}
+	return false
+}
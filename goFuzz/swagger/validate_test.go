@@ -0,0 +1,62 @@
+package swagger
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/stretchr/testify/require"
+)
+
+const categorySchema = `{
+	"type": "object",
+	"required": ["category"],
+	"properties": {
+		"category": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"id": {"type": "integer"},
+				"name": {"type": "string"},
+				"position": {"type": "number"},
+				"topics": {"type": "array", "items": {"type": "string"}},
+				"color": {"type": "string", "enum": ["red", "blue"]}
+			}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema := &spec.Schema{}
+	require.NoError(t, json.Unmarshal([]byte(categorySchema), schema))
+
+	decode := func(doc string) interface{} {
+		var data interface{}
+		require.NoError(t, json.Unmarshal([]byte(doc), &data))
+		return data
+	}
+
+	// Valid, nulls are fine
+	valid := `{"category": {"id": 1, "name": null, "position": 1.5, "topics": ["a"], "color": "red"}}`
+	require.Empty(t, Validate(schema, decode(valid)))
+
+	invalid := `{"category": {"id": 1.5, "name": 3, "topics": ["a", 2], "color": "green", "slug": "x"}}`
+	violations := Validate(schema, decode(invalid))
+	paths := map[string]bool{}
+	for _, violation := range violations {
+		paths[violation.Path] = true
+	}
+	require.Equal(t, map[string]bool{
+		"$.category.id":        true,
+		"$.category.name":      true,
+		"$.category.topics[1]": true,
+		"$.category.color":     true,
+		"$.category":           true,
+	}, paths)
+
+	violations = Validate(schema, decode(`{"categories": []}`))
+	require.Equal(t, []Violation{{Path: "$", Message: "missing required property category"}}, violations)
+
+	violations = Validate(schema, decode(`[]`))
+	require.Equal(t, []Violation{{Path: "$", Message: "expected [object], got array"}}, violations)
+}
@@ -1,6 +1,7 @@
 package exception
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 
@@ -21,19 +22,45 @@ type Exception struct {
 	Message  string `bson:"Message"`
 	TargetID string `bson:"TargetID"`
 	Curl     string `bson:"Curl"`
+	// Backtrace as logged by rails, innermost frame first
+	Backtrace []string `bson:"Backtrace"`
+	// Hash of the class and top in-app frames.  Identifies the bug
+	// regardless of the route it was reached from.
+	Fingerprint string `bson:"Fingerprint"`
+	// Number of times the bug was hit
+	Count int `bson:"Count"`
+	// Every route that triggered the bug, as "METHOD path"
+	Routes []string `bson:"Routes"`
+	// Ignored, low, high or security, see triage.go
+	Severity string `bson:"Severity"`
+	// The exception that was being handled when this one was raised
+	Cause *Exception `bson:"Cause,omitempty"`
+	// Smallest request found that still raises the exception
+	MinimizedCurl string `bson:"MinimizedCurl,omitempty"`
+	// Set when a replay no longer reproduces the exception
+	Closed bool `bson:"Closed"`
 }
 
 // ExceptionsManager tracks exceptions in memory and logs them to a db
 type ExceptionsManager struct {
 	collection *mgo.Collection
 	filePath   string
+	// Tracks how much of the exceptions file we've read
+	tailer *util.Tailer
 	// Keep track of exceptions in memory as well
 	uniqueExceptions []Exception
 	// Did we see a new exception?
 	Delta bool
+	// Exceptions first seen in the most recent update
+	Latest []Exception
+	// Every exception hit in the most recent update, new or not
+	Hits []Exception
+	// Rules for triaging exceptions
+	rules Rules
 }
 
-// Path to exceptions file dumped by rails
+// Path to exceptions file dumped by rails.  Rails appends one json object per
+// line for every exception raised.
 const Path = "/tmp/results/exceptions.json"
 
 // NewExceptionsManager takes a connection to a mongo db and connects to the
@@ -41,9 +68,19 @@ const Path = "/tmp/results/exceptions.json"
 // write to the db.  If the path is the empty string, nothing shall be written to the db,
 // and it will only be read from.
 func NewExceptionsManager(db *mgo.Database, path string) *ExceptionsManager {
+	// Rules for triaging exceptions, on top of the defaults
+	rules, err := LoadRules(util.DefaultEnv("EXCEPTION_RULES", ""))
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
 	manager := &ExceptionsManager{
 		collection: db.C("exceptions"),
 		filePath:   path,
+		rules:      rules,
+	}
+	if path != "" {
+		manager.tailer = util.NewTailer(path)
 	}
 
 	// We may have run on this target before.  If so, reload the exceptions
@@ -54,6 +91,12 @@ func NewExceptionsManager(db *mgo.Database, path string) *ExceptionsManager {
 		if err != nil {
 			log.Fatal(err)
 		}
+		// Exceptions logged before we fingerprinted
+		for i := range exceptions {
+			if exceptions[i].Fingerprint == "" {
+				exceptions[i].Fingerprint = exceptions[i].fingerprint()
+			}
+		}
 		manager.uniqueExceptions = exceptions
 	}
 	return manager
@@ -69,6 +112,25 @@ func (manager *ExceptionsManager) GetAll(targetID string) ([]Exception, error) {
 	return results, errors.WithStack(err)
 }
 
+// ReadAll returns every exception for the given target id.  Unlike GetAll,
+// the results aren't capped.
+func (manager *ExceptionsManager) ReadAll(targetID string) ([]Exception, error) {
+	var results []Exception
+	query := bson.M{"TargetID": targetID}
+	err := manager.collection.Find(query).All(&results)
+	return results, errors.WithStack(err)
+}
+
+// GetBySeverity returns all exceptions for the given target id triaged as one
+// of the given severities
+func (manager *ExceptionsManager) GetBySeverity(targetID string, severities []string) ([]Exception, error) {
+	var results []Exception
+	query := bson.M{"TargetID": targetID, "Severity": bson.M{"$in": severities}}
+	iter := manager.collection.Find(query).Limit(100).Iter()
+	err := iter.All(&results)
+	return results, errors.WithStack(err)
+}
+
 // ReadOne reads a single exception by target id
 func (manager *ExceptionsManager) ReadOne(targetID string) (Exception, error) {
 	var result Exception
@@ -87,76 +149,182 @@ func (manager *ExceptionsManager) Drop() error {
 	return errors.WithStack(manager.collection.DropCollection())
 }
 
-// return whether or not an exception is benign
-func (exception *Exception) benign() bool {
+func exceptionsEqual(exn1 Exception, exn2 Exception) bool {
+	return exn1.Fingerprint == exn2.Fingerprint &&
+		exn1.TargetID == exn2.TargetID
+}
+
+func hasRoute(routes []string, route string) bool {
+	for _, seen := range routes {
+		if seen == route {
+			return true
+		}
+	}
 	return false
 }
 
-func exceptionsEqual(exn1 Exception, exn2 Exception) bool {
-	return exn1.Path == exn2.Path &&
-		exn1.Method == exn2.Method &&
-		exn1.Class == exn2.Class &&
-		exn1.TargetID == exn2.TargetID
+// recordHit counts another occurrence of a known exception and stores the
+// route if it's new
+func (manager *ExceptionsManager) recordHit(old *Exception, route string) error {
+	old.Count++
+	update := bson.M{"$inc": bson.M{"Count": 1}}
+	if !hasRoute(old.Routes, route) {
+		old.Routes = append(old.Routes, route)
+		update["$addToSet"] = bson.M{"Routes": route}
+	}
+	query := bson.M{"TargetID": old.TargetID, "Fingerprint": old.Fingerprint}
+	err := manager.collection.Update(query, update)
+	// Exceptions logged before we fingerprinted can't be found by
+	// fingerprint, don't fail the run over it
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return errors.WithStack(err)
 }
 
-// Update exceptions database from exceptions written by rails
+// Update exceptions database from exceptions written by rails.  Every
+// exception logged since the last update is attributed to the given request.
 func (manager *ExceptionsManager) Update(path string, method string, targetid string,
 	curlCmd *http2curl.CurlCommand) error {
 	// Assume we don't see a unique exception
 	manager.Delta = false
+	manager.Latest = nil
+	manager.Hits = nil
+	return manager.recordAll(path, method, targetid, curlCmd.String())
+}
 
-	exception, err := manager.ReadExceptionsFile()
+// UpdateFollowUps attributes every exception logged since the last update to
+// a follow up request sent for the route, e.g. by a detector.  They're stored
+// like any other, but kept out of Latest since they weren't raised by the
+// fuzzed request.
+func (manager *ExceptionsManager) UpdateFollowUps(path string, method string, targetid string,
+	curl string) error {
+	latest := manager.Latest
+	err := manager.recordAll(path, method, targetid, curl)
+	manager.Latest = latest
+	return err
+}
+
+// recordAll reads the exceptions logged since the last read and records them
+// against the given request
+func (manager *ExceptionsManager) recordAll(path string, method string, targetid string,
+	curl string) error {
+	exceptions, err := manager.ReadExceptions()
 	if err != nil {
 		return err
 	}
-	// There was no exception
-	if exception == nil {
-		return nil
+
+	for _, exception := range exceptions {
+		// Add extra metadata to the exception
+		exception.Path = path
+		exception.Method = method
+		exception.TargetID = targetid
+		exception.Curl = curl
+
+		err = manager.record(exception)
+		if err != nil {
+			return err
+		}
 	}
-	if exception.benign() {
+	return nil
+}
+
+// record triages a single exception and stores it if it's new
+func (manager *ExceptionsManager) record(exception *Exception) error {
+	// Drop benign exceptions
+	exception.Severity = manager.rules.Classify(exception)
+	if exception.Severity == Ignored {
 		return nil
 	}
-
-	// Add extra metadata to the exception
-	exception.Path = path
-	exception.Method = method
-	exception.TargetID = targetid
-	exception.Curl = curlCmd.String()
+	exception.Fingerprint = exception.fingerprint()
+	exception.Count = 1
+	route := exception.Method + " " + exception.Path
+	exception.Routes = []string{route}
+	manager.Hits = append(manager.Hits, *exception)
 
 	// Have we seen this exception before?
-	for _, oldException := range manager.uniqueExceptions {
-		// We've already logged this exception
-		if exceptionsEqual(oldException, *exception) {
-			return nil
+	for i := range manager.uniqueExceptions {
+		// We've already logged this exception, count it
+		if exceptionsEqual(manager.uniqueExceptions[i], *exception) {
+			return manager.recordHit(&manager.uniqueExceptions[i], route)
 		}
-
 	}
 
 	// This exception is unique
 	manager.Delta = true
 	manager.uniqueExceptions = append(manager.uniqueExceptions, *exception)
+	manager.Latest = append(manager.Latest, *exception)
 
 	// Log to db
 	return manager.WriteOne(*exception)
 }
 
-// ReadExceptionsFile reads the file written by rails logging exceptions
-func (manager *ExceptionsManager) ReadExceptionsFile() (*Exception, error) {
+// Unique returns the number of unique exceptions seen on the target
+func (manager *ExceptionsManager) Unique() int {
+	return len(manager.uniqueExceptions)
+}
+
+// SetMinimized stores the minimized reproducer for an exception
+func (manager *ExceptionsManager) SetMinimized(exception Exception, curl string) error {
+	for i := range manager.uniqueExceptions {
+		if exceptionsEqual(manager.uniqueExceptions[i], exception) {
+			manager.uniqueExceptions[i].MinimizedCurl = curl
+		}
+	}
+	query := bson.M{"TargetID": exception.TargetID, "Fingerprint": exception.Fingerprint}
+	update := bson.M{"$set": bson.M{"MinimizedCurl": curl}}
+	return errors.WithStack(manager.collection.Update(query, update))
+}
+
+// SetClosed marks an exception as fixed, or reopens it
+func (manager *ExceptionsManager) SetClosed(exception Exception, closed bool) error {
+	query := bson.M{"TargetID": exception.TargetID, "Fingerprint": exception.Fingerprint}
+	update := bson.M{"$set": bson.M{"Closed": closed}}
+	return errors.WithStack(manager.collection.Update(query, update))
+}
+
+// Reproduces checks if any exception logged since the last read has the given
+// fingerprint when attributed to a request for method and path, since
+// exceptions without a backtrace are fingerprinted by route.  The exceptions
+// read are not stored.
+func (manager *ExceptionsManager) Reproduces(method string, path string, fingerprint string) (bool, error) {
+	exceptions, err := manager.ReadExceptions()
+	if err != nil {
+		return false, err
+	}
+	for _, exception := range exceptions {
+		exception.Method = method
+		exception.Path = path
+		if exception.fingerprint() == fingerprint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReadExceptions reads the exceptions appended to the file written by rails
+// since the last read
+func (manager *ExceptionsManager) ReadExceptions() ([]*Exception, error) {
 	// There's no file to read from
-	if manager.filePath == "" {
+	if manager.tailer == nil {
 		return nil, nil
 	}
-	// Check if any exceptions were written
-	empty, err := util.FileIsEmpty(manager.filePath)
+	lines, err := manager.tailer.ReadLines()
 	if err != nil {
 		return nil, err
 	}
-	if empty {
-		return nil, nil
+	exceptions := []*Exception{}
+	for _, line := range lines {
+		exception := &Exception{}
+		err = json.Unmarshal([]byte(line), exception)
+		// Don't lose the rest of the exceptions over one bad line
+		if err != nil {
+			log.Warnf("failed to parse exception %q: %v", line, err)
+			continue
+		}
+		exceptions = append(exceptions, exception)
 	}
-	exception := &Exception{}
-	err = util.UnmarshalFile(manager.filePath, exception)
-	return exception, err
+	return exceptions, nil
 }
 
 // ReadDB connects to athena db and reads the TARGET_ID exceptions table.
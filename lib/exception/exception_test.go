@@ -4,6 +4,7 @@ package exception
 // docker run -d  -p 27017:27017 mongo
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -20,7 +21,14 @@ func TestWriteReadOne(t *testing.T) {
 	db := database.MustGetDatabase(database.MongoDbPort, "test")
 	exceptions := NewExceptionsManager(db, "")
 	_ = exceptions.Drop()
-	exn := Exception{"get", "/test/route", "InvalidRead", "Test Mesage", "12345", "fake curl cmd"}
+	exn := Exception{
+		Method:   "get",
+		Path:     "/test/route",
+		Class:    "InvalidRead",
+		Message:  "Test Mesage",
+		TargetID: "12345",
+		Curl:     "fake curl cmd",
+	}
 	err := exceptions.WriteOne(exn)
 	require.NoError(t, err)
 	result, err := exceptions.ReadOne("12345")
@@ -35,7 +43,14 @@ func TestWriteReadAll(t *testing.T) {
 	db := database.MustGetDatabase(database.MongoDbPort, "test")
 	exceptions := NewExceptionsManager(db, "")
 	_ = exceptions.Drop()
-	exn := Exception{"get", "/test/route", "InvalidRead", "Test Mesage", "12345", "fake curl cmd"}
+	exn := Exception{
+		Method:   "get",
+		Path:     "/test/route",
+		Class:    "InvalidRead",
+		Message:  "Test Mesage",
+		TargetID: "12345",
+		Curl:     "fake curl cmd",
+	}
 	err := exceptions.WriteOne(exn)
 	require.NoError(t, err)
 	result, err := exceptions.GetAll("12345")
@@ -44,7 +59,14 @@ func TestWriteReadAll(t *testing.T) {
 	require.Equal(t, "/test/route", result[0].Path)
 	require.Equal(t, "InvalidRead", result[0].Class)
 
-	exn = Exception{"get2", "/test/route2", "InvalidRead2", "Test Mesage2", "12345", "fake curl cmd"}
+	exn = Exception{
+		Method:   "get2",
+		Path:     "/test/route2",
+		Class:    "InvalidRead2",
+		Message:  "Test Mesage2",
+		TargetID: "12345",
+		Curl:     "fake curl cmd",
+	}
 	err = exceptions.WriteOne(exn)
 	require.NoError(t, err)
 	results, err := exceptions.GetAll("12345")
@@ -54,6 +76,94 @@ func TestWriteReadAll(t *testing.T) {
 	}
 }
 
+// appendException appends an exception to a json lines exceptions file the
+// way rails does
+func appendException(t *testing.T, path string, exn interface{}) {
+	data, err := json.Marshal(exn)
+	require.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	require.NoError(t, err)
+}
+
+func TestReadExceptions(t *testing.T) {
+	tmp, err := ioutil.TempFile("/tmp", "")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	manager := &ExceptionsManager{tailer: util.NewTailer(tmp.Name())}
+
+	// Nothing logged yet
+	exceptions, err := manager.ReadExceptions()
+	require.NoError(t, err)
+	require.Empty(t, exceptions)
+
+	// Two exceptions raised by one request, the second with a cause
+	appendException(t, tmp.Name(), map[string]interface{}{
+		"class":   "NoMethodError",
+		"message": "undefined method `name' for nil:NilClass",
+	})
+	appendException(t, tmp.Name(), map[string]interface{}{
+		"class":   "ActionView::Template::Error",
+		"message": "PG::SyntaxError",
+		"cause": map[string]interface{}{
+			"class":     "ActiveRecord::StatementInvalid",
+			"message":   "PG::SyntaxError",
+			"backtrace": []string{"/app/models/post.rb:1:in `find'"},
+		},
+	})
+	exceptions, err = manager.ReadExceptions()
+	require.NoError(t, err)
+	require.Len(t, exceptions, 2)
+	require.Equal(t, "NoMethodError", exceptions[0].Class)
+	require.Nil(t, exceptions[0].Cause)
+	require.Equal(t, "ActiveRecord::StatementInvalid", exceptions[1].Cause.Class)
+	require.Len(t, exceptions[1].Cause.Backtrace, 1)
+
+	// Only new exceptions are read, bad lines are skipped
+	_, err = tmp.WriteString("{not json\n")
+	require.NoError(t, err)
+	appendException(t, tmp.Name(), Exception{Class: "ArgumentError"})
+	exceptions, err = manager.ReadExceptions()
+	require.NoError(t, err)
+	require.Len(t, exceptions, 1)
+	require.Equal(t, "ArgumentError", exceptions[0].Class)
+
+	// No file to read from
+	manager = &ExceptionsManager{}
+	exceptions, err = manager.ReadExceptions()
+	require.NoError(t, err)
+	require.Empty(t, exceptions)
+}
+
+func TestReproduces(t *testing.T) {
+	tmp, err := ioutil.TempFile("/tmp", "")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	manager := &ExceptionsManager{tailer: util.NewTailer(tmp.Name())}
+
+	// Fingerprinted by route since there's no backtrace
+	stored := &Exception{Class: "ArgumentError", Method: "POST", Path: "/posts"}
+	fingerprint := stored.fingerprint()
+
+	appendException(t, tmp.Name(), Exception{Class: "ArgumentError"})
+	reproduced, err := manager.Reproduces("POST", "/posts", fingerprint)
+	require.NoError(t, err)
+	require.True(t, reproduced)
+
+	// Same class on another route
+	appendException(t, tmp.Name(), Exception{Class: "ArgumentError"})
+	reproduced, err = manager.Reproduces("GET", "/posts", fingerprint)
+	require.NoError(t, err)
+	require.False(t, reproduced)
+
+	// Nothing logged since the last read
+	reproduced, err = manager.Reproduces("POST", "/posts", fingerprint)
+	require.NoError(t, err)
+	require.False(t, reproduced)
+}
+
 func TestUpdate(t *testing.T) {
 	// Create a dummy exceptions file
 	method := "get"
@@ -81,8 +191,7 @@ func TestUpdate(t *testing.T) {
 	tmp, err := ioutil.TempFile("/tmp", "")
 	require.NoError(t, err)
 	defer os.Remove(tmp.Name())
-	err = util.MarshalToFile(exn1, tmp.Name())
-	require.NoError(t, err)
+	appendException(t, tmp.Name(), exn1)
 
 	// Connect to mongodb to log exceptions
 	db := database.MustGetDatabase(database.MongoDbPort, "testdb")
@@ -95,7 +204,7 @@ func TestUpdate(t *testing.T) {
 	err = manager.Update(path, method, targetid1, curl)
 	require.NoError(t, err)
 
-	// Update dummy exceptions file by writing the same
+	// Append to the dummy exceptions file the same
 	// stuff with a new target id
 	targetid2 := "targetid2"
 	exn2 := Exception{
@@ -105,8 +214,7 @@ func TestUpdate(t *testing.T) {
 		Message:  message,
 		TargetID: targetid2,
 	}
-	err = util.MarshalToFile(exn2, tmp.Name())
-	require.NoError(t, err)
+	appendException(t, tmp.Name(), exn2)
 
 	// Update again
 	err = manager.Update(path, method, targetid2, curl)
@@ -139,3 +247,35 @@ func TestUpdate(t *testing.T) {
 	require.Equal(t, exn2.TargetID, result.TargetID)
 	require.Equal(t, curl.String(), result.Curl)
 }
+
+func TestUpdateFollowUps(t *testing.T) {
+	tmp, err := ioutil.TempFile("/tmp", "")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+	db := database.MustGetDatabase(database.MongoDbPort, "testdb")
+	manager := NewExceptionsManager(db, tmp.Name())
+	_ = manager.Drop()
+
+	req, err := http.NewRequest("GET", "/info", nil)
+	require.NoError(t, err)
+	curl, err := http2curl.GetCurlCommand(req)
+	require.NoError(t, err)
+	appendException(t, tmp.Name(), Exception{Class: "NoMethodError", Message: "fuzzed"})
+	require.NoError(t, manager.Update("/info", "GET", "followups", curl))
+	require.Len(t, manager.Latest, 1)
+
+	// Raised by a detector replaying the request
+	appendException(t, tmp.Name(), Exception{Class: "ArgumentError", Message: "replayed"})
+	err = manager.UpdateFollowUps("/info", "GET", "followups", "curl 'http://target/info'")
+	require.NoError(t, err)
+	require.Equal(t, 2, manager.Unique())
+	// Only the fuzzed request's exception is minimized
+	require.Len(t, manager.Latest, 1)
+	require.Equal(t, "fuzzed", manager.Latest[0].Message)
+
+	all, err := manager.GetAll("followups")
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	require.Equal(t, "curl 'http://target/info'", all[1].Curl)
+	require.Equal(t, "GET /info", all[1].Routes[0])
+}
@@ -0,0 +1,119 @@
+package exception
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Number of in-app frames identifying a bug
+const fingerprintFrames = 3
+
+// Line numbers shift with unrelated edits
+var lineNumberRe = regexp.MustCompile(`:\d+(:|$)`)
+
+// Installed gems, i.e. /usr/local/bundle/gems/actionpack-5.2.3/lib/...
+var gemPathRe = regexp.MustCompile(`^.*/gems/([A-Za-z0-9_.-]+?)-\d+(\.\w+)*/`)
+
+// Ruby's standard library, i.e. /usr/local/lib/ruby/2.6.0/...
+var rubyPathRe = regexp.MustCompile(`^.*/lib/ruby/\d+(\.\d+)*/`)
+
+// Everything up to the app's own source directories.  Greedy, since the app
+// itself may be deployed to a directory named app.
+var appPathRe = regexp.MustCompile(`^.*/((app|lib|config|plugins)/)`)
+
+// Markers of frames outside the app
+var frameworkMarkers = []string{"/gems/", "/lib/ruby/", "/rails-fork/", "<internal:"}
+
+// normalizeFrame strips noise from a backtrace frame so the same code
+// produces the same frame across runs and deploys
+func normalizeFrame(frame string) string {
+	frame = lineNumberRe.ReplaceAllString(frame, "$1")
+	switch {
+	case gemPathRe.MatchString(frame):
+		frame = gemPathRe.ReplaceAllString(frame, "$1/")
+	case rubyPathRe.MatchString(frame):
+		frame = rubyPathRe.ReplaceAllString(frame, "ruby/")
+	default:
+		frame = appPathRe.ReplaceAllString(frame, "$1")
+	}
+	return strings.TrimSpace(frame)
+}
+
+// inApp checks if the frame is in the target's own code
+func inApp(frame string) bool {
+	for _, marker := range frameworkMarkers {
+		if strings.Contains(frame, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+// Frame is a backtrace frame in the app's own code
+type Frame struct {
+	// Relative to the app root, i.e. app/controllers/posts_controller.rb
+	File   string
+	Line   int
+	Method string
+}
+
+// Backtrace frames look like /path/to/file.rb:12:in `method'
+var frameRe = regexp.MustCompile("^(.+?):(\\d+)(?::in [`'](.*)')?$")
+
+// AppFrames returns the frames of the backtrace in the app's own code, innermost
+// first
+func (exception *Exception) AppFrames() []Frame {
+	frames := []Frame{}
+	for _, frame := range exception.Backtrace {
+		if !inApp(frame) {
+			continue
+		}
+		match := frameRe.FindStringSubmatch(strings.TrimSpace(frame))
+		if match == nil {
+			continue
+		}
+		line, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		frames = append(frames, Frame{
+			File:   appPathRe.ReplaceAllString(match[1], "$1"),
+			Line:   line,
+			Method: match[3],
+		})
+	}
+	return frames
+}
+
+// fingerprint hashes the class and the top in-app frames of the backtrace.
+// If no frame is in the app, the top frames are used whatever they are.
+// Exceptions without a backtrace fall back to class and route.
+func (exception *Exception) fingerprint() string {
+	frames := []string{}
+	for _, frame := range exception.Backtrace {
+		if len(frames) == fingerprintFrames {
+			break
+		}
+		if inApp(frame) {
+			frames = append(frames, normalizeFrame(frame))
+		}
+	}
+	if len(frames) == 0 {
+		for i := 0; i < len(exception.Backtrace) && i < fingerprintFrames; i++ {
+			frames = append(frames, normalizeFrame(exception.Backtrace[i]))
+		}
+	}
+	if len(frames) == 0 {
+		frames = []string{exception.Method, exception.Path}
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte(exception.Class))
+	for _, frame := range frames {
+		hash.Write([]byte("\n" + frame))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package exception
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var backtrace = []string{
+	"/usr/local/bundle/gems/activerecord-5.2.3/lib/active_record/core.rb:177:in `find'",
+	"/var/www/discourse/app/models/post.rb:42:in `owner'",
+	"/var/www/discourse/app/controllers/posts_controller.rb:123:in `show'",
+	"/usr/local/lib/ruby/2.6.0/benchmark.rb:308:in `realtime'",
+	"/var/www/discourse/lib/middleware/request_tracker.rb:9:in `call'",
+	"/var/www/discourse/config/initializers/100-silence_logger.rb:31:in `call'",
+}
+
+func TestNormalizeFrame(t *testing.T) {
+	require.Equal(t, "activerecord/lib/active_record/core.rb:in `find'", normalizeFrame(backtrace[0]))
+	require.Equal(t, "app/models/post.rb:in `owner'", normalizeFrame(backtrace[1]))
+	require.Equal(t, "ruby/benchmark.rb:in `realtime'", normalizeFrame(backtrace[3]))
+	require.False(t, inApp(backtrace[0]))
+	require.True(t, inApp(backtrace[1]))
+	require.False(t, inApp(backtrace[3]))
+}
+
+func TestFingerprint(t *testing.T) {
+	exn1 := Exception{Class: "NoMethodError", Method: "GET", Path: "/posts/{id}", Backtrace: backtrace}
+
+	// Same bug, reached from another route, deployed elsewhere, with the
+	// line numbers shifted
+	moved := []string{}
+	for _, frame := range backtrace {
+		moved = append(moved, strings.Replace(frame, "/var/www/discourse", "/srv/app", 1))
+	}
+	moved[1] = "/srv/app/app/models/post.rb:45:in `owner'"
+	exn2 := Exception{Class: "NoMethodError", Method: "PUT", Path: "/posts/{id}/recover", Backtrace: moved}
+	require.Equal(t, exn1.fingerprint(), exn2.fingerprint())
+
+	// Different bug of the same class
+	exn3 := Exception{Class: "NoMethodError", Method: "GET", Path: "/posts/{id}", Backtrace: backtrace[2:]}
+	require.NotEqual(t, exn1.fingerprint(), exn3.fingerprint())
+
+	// Framework only backtraces still distinguish bugs
+	exn4 := Exception{Class: "NoMethodError", Backtrace: backtrace[:1]}
+	exn5 := Exception{Class: "NoMethodError", Backtrace: backtrace[3:4]}
+	require.NotEqual(t, exn4.fingerprint(), exn5.fingerprint())
+
+	// No backtrace falls back to the route
+	exn6 := Exception{Class: "NoMethodError", Method: "GET", Path: "/posts/{id}"}
+	exn7 := Exception{Class: "NoMethodError", Method: "GET", Path: "/users/{id}"}
+	require.NotEqual(t, exn6.fingerprint(), exn7.fingerprint())
+}
+
+func TestAppFrames(t *testing.T) {
+	exception := &Exception{Backtrace: backtrace}
+	require.Equal(t, []Frame{
+		{File: "app/models/post.rb", Line: 42, Method: "owner"},
+		{File: "app/controllers/posts_controller.rb", Line: 123, Method: "show"},
+		{File: "lib/middleware/request_tracker.rb", Line: 9, Method: "call"},
+		{File: "config/initializers/100-silence_logger.rb", Line: 31, Method: "call"},
+	}, exception.AppFrames())
+}
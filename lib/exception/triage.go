@@ -0,0 +1,179 @@
+package exception
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+)
+
+// Severities an exception can be triaged as, from least to most interesting
+const (
+	// Not stored at all
+	Ignored = "ignored"
+	// Expected for garbage input, i.e. missing parameters
+	Low = "low"
+	// The app misbehaved
+	High = "high"
+	// The app misbehaved in a way that hints at a vulnerability
+	Security = "security"
+)
+
+// Severity of exceptions no rule matches.  Unexpected exceptions are what
+// we're looking for.
+const defaultSeverity = High
+
+// Rule classifies exceptions.  Every field that is set must match, and empty
+// fields match anything.
+type Rule struct {
+	// Exact exception class, i.e. ActiveRecord::StatementInvalid
+	Class string
+	// Regex matched against the exception message
+	Message string
+	// Regex matched against each backtrace frame, any frame can match
+	Frame string
+	// Regex matched against the route, as "METHOD path"
+	Route    string
+	Severity string
+
+	message *regexp.Regexp
+	frame   *regexp.Regexp
+	route   *regexp.Regexp
+}
+
+// Rules are applied in order, the first matching rule wins
+type Rules []*Rule
+
+// defaultRules cover common Rails exceptions.  They are applied after any
+// user supplied rules.
+var defaultRules = Rules{
+	// Routing noise
+	{Class: "ActionController::RoutingError", Severity: Ignored},
+	{Class: "AbstractController::ActionNotFound", Severity: Ignored},
+	// Bad input handled by the framework
+	{Class: "ActionController::ParameterMissing", Severity: Low},
+	{Class: "ActionController::BadRequest", Severity: Low},
+	{Class: "ActionController::UnknownFormat", Severity: Low},
+	{Class: "ActionController::InvalidAuthenticityToken", Severity: Low},
+	{Class: "ActionDispatch::Http::Parameters::ParseError", Severity: Low},
+	{Class: "ActiveRecord::RecordNotFound", Severity: Low},
+	{Class: "ActiveRecord::RecordInvalid", Severity: Low},
+	{Class: "ActiveRecord::RecordNotUnique", Severity: Low},
+	// Our input made it into sql
+	{Class: "ActiveRecord::StatementInvalid", Message: `PG::SyntaxError|syntax error at or near|unterminated quoted`, Severity: Security},
+	{Class: "ActiveRecord::StatementInvalid", Severity: High},
+	// Unsafe deserialization and file access
+	{Class: "Psych::DisallowedClass", Severity: Security},
+	{Class: "ArgumentError", Message: `marshal data too short|dump format error`, Severity: Security},
+	{Class: "Errno::ENOENT", Message: `\.\./`, Severity: Security},
+	{Class: "Errno::EACCES", Severity: Security},
+	{Class: "ActionView::Template::Error", Message: `undefined local variable|Missing template`, Severity: Security},
+}
+
+// compile compiles the regexes of every rule
+func (rules Rules) compile() error {
+	compile := func(expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		re, err := regexp.Compile(expr)
+		return re, errors.WithStack(err)
+	}
+	for _, rule := range rules {
+		switch rule.Severity {
+		case Ignored, Low, High, Security:
+		default:
+			return errors.Errorf("unknown severity %q in rule for %q", rule.Severity, rule.Class)
+		}
+		var err error
+		if rule.message, err = compile(rule.Message); err != nil {
+			return err
+		}
+		if rule.frame, err = compile(rule.Frame); err != nil {
+			return err
+		}
+		if rule.route, err = compile(rule.Route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRules reads rules from a json file and appends the defaults
+func LoadRules(path string) (Rules, error) {
+	rules := Rules{}
+	if path != "" {
+		err := util.UnmarshalFile(path, &rules)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rules = append(rules, defaultRules...)
+	return rules, rules.compile()
+}
+
+// matches checks if the rule applies to the exception
+func (rule *Rule) matches(exception *Exception) bool {
+	if rule.Class != "" && rule.Class != exception.Class {
+		return false
+	}
+	if rule.message != nil && !rule.message.MatchString(exception.Message) {
+		return false
+	}
+	if rule.route != nil && !rule.route.MatchString(exception.Method+" "+exception.Path) {
+		return false
+	}
+	if rule.frame != nil {
+		for _, frame := range exception.Backtrace {
+			if rule.frame.MatchString(frame) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// match returns the severity of the first rule matching the exception
+func (rules Rules) match(exception *Exception) (string, bool) {
+	for _, rule := range rules {
+		if rule.matches(exception) {
+			return rule.Severity, true
+		}
+	}
+	return "", false
+}
+
+// Classify returns the severity of the first rule matching the exception.
+// Rails often wraps the interesting exception, i.e. in a template error, so if
+// no rule matches the exception its causes are tried in turn, outermost first.
+// A match on the outermost exception wins, so a rule for a wrapper overrides
+// whatever it wraps.  Causes are matched against the route of the exception.
+func (rules Rules) Classify(exception *Exception) string {
+	for exn := exception; exn != nil; exn = exn.Cause {
+		withRoute := *exn
+		withRoute.Method, withRoute.Path = exception.Method, exception.Path
+		if severity, ok := rules.match(&withRoute); ok {
+			return severity
+		}
+	}
+	return defaultSeverity
+}
+
+// ParseSeverities parses a comma separated list of severities
+func ParseSeverities(list string) ([]string, error) {
+	severities := []string{}
+	for _, severity := range strings.Split(list, ",") {
+		severity = strings.TrimSpace(severity)
+		switch severity {
+		case "":
+			continue
+		case Ignored, Low, High, Security:
+			severities = append(severities, severity)
+		default:
+			return nil, errors.Errorf("unknown severity %q", severity)
+		}
+	}
+	return severities, nil
+}
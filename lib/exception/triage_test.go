@@ -0,0 +1,106 @@
+package exception
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	rules, err := LoadRules("")
+	require.NoError(t, err)
+
+	exception := &Exception{Class: "ActionController::RoutingError"}
+	require.Equal(t, Ignored, rules.Classify(exception))
+
+	exception = &Exception{Class: "ActionController::ParameterMissing"}
+	require.Equal(t, Low, rules.Classify(exception))
+
+	exception = &Exception{
+		Class:   "ActiveRecord::StatementInvalid",
+		Message: `PG::SyntaxError: ERROR:  syntax error at or near "'"`,
+	}
+	require.Equal(t, Security, rules.Classify(exception))
+
+	exception = &Exception{
+		Class:   "ActiveRecord::StatementInvalid",
+		Message: "PG::UndefinedColumn: ERROR:  column \"foo\" does not exist",
+	}
+	require.Equal(t, High, rules.Classify(exception))
+
+	// The cause is more interesting than the wrapper
+	exception = &Exception{
+		Class: "ActionView::Template::Error",
+		Cause: &Exception{
+			Class:   "ActiveRecord::StatementInvalid",
+			Message: "PG::SyntaxError: ERROR:  unterminated quoted string",
+		},
+	}
+	require.Equal(t, Security, rules.Classify(exception))
+
+	// Unless a rule matches the wrapper
+	exception.Cause.Class = "Psych::DisallowedClass"
+	exception.Class = "ActiveRecord::RecordInvalid"
+	require.Equal(t, Low, rules.Classify(exception))
+
+	// Nothing matches
+	exception = &Exception{Class: "NoMethodError", Backtrace: backtrace}
+	require.Equal(t, High, rules.Classify(exception))
+}
+
+func TestLoadRules(t *testing.T) {
+	file, err := ioutil.TempFile("", "rules")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	// User rules take precedence over the defaults
+	_, err = file.WriteString(`[
+		{"Class": "ActionController::ParameterMissing", "Route": "^POST /admin", "Severity": "high"},
+		{"Class": "NoMethodError", "Frame": "posts_controller", "Severity": "low"}
+	]`)
+	require.NoError(t, err)
+	file.Close()
+
+	rules, err := LoadRules(file.Name())
+	require.NoError(t, err)
+
+	exception := &Exception{Class: "ActionController::ParameterMissing", Method: "POST", Path: "/admin/users"}
+	require.Equal(t, High, rules.Classify(exception))
+	exception.Path = "/posts"
+	require.Equal(t, Low, rules.Classify(exception))
+
+	exception = &Exception{Class: "NoMethodError", Backtrace: backtrace}
+	require.Equal(t, Low, rules.Classify(exception))
+	exception.Backtrace = backtrace[:1]
+	require.Equal(t, High, rules.Classify(exception))
+
+	// Causes are matched against the route of the exception wrapping them
+	exception = &Exception{
+		Class:  "ActionView::Template::Error",
+		Method: "POST",
+		Path:   "/admin/users",
+		Cause:  &Exception{Class: "ActionController::ParameterMissing"},
+	}
+	require.Equal(t, High, rules.Classify(exception))
+
+	// Bad severity
+	err = ioutil.WriteFile(file.Name(), []byte(`[{"Class": "Foo", "Severity": "meh"}]`), 0644)
+	require.NoError(t, err)
+	_, err = LoadRules(file.Name())
+	require.Error(t, err)
+}
+
+func TestParseSeverities(t *testing.T) {
+	severities, err := ParseSeverities("high, security")
+	require.NoError(t, err)
+	require.Equal(t, []string{High, Security}, severities)
+
+	severities, err = ParseSeverities("")
+	require.NoError(t, err)
+	require.Empty(t, severities)
+
+	_, err = ParseSeverities("high,critical")
+	require.Error(t, err)
+}
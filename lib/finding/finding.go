@@ -0,0 +1,153 @@
+package finding
+
+import (
+	"github.com/mruck/athena/lib/log"
+	"github.com/mruck/athena/lib/util"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Finding is a potential vulnerability flagged by one of the fuzzer's
+// detectors
+type Finding struct {
+	// Class of vulnerability, i.e. "dos"
+	Kind   string `bson:"Kind"`
+	Method string `bson:"Verb"`
+	Path   string `bson:"Path"`
+	// Parameter the finding is attributed to, if any
+	Param    string `bson:"Param"`
+	TargetID string `bson:"TargetID"`
+	// Human readable description of what was observed
+	Message string `bson:"Message"`
+	// Reproducer for the request that triggered the finding
+	Curl string `bson:"Curl"`
+	// Smallest request found that still triggers the finding
+	MinimizedCurl string `bson:"MinimizedCurl,omitempty"`
+	// Set when a replay no longer reproduces the finding
+	Closed bool `bson:"Closed"`
+	// Detector specific evidence
+	Details bson.M `bson:"Details"`
+}
+
+// FindingsManager tracks findings in memory and logs them to a db
+type FindingsManager struct {
+	collection *mgo.Collection
+	// Keep track of findings in memory as well
+	uniqueFindings []Finding
+	// Did we see a new finding?
+	Delta bool
+	// Findings first seen in the most recent update
+	Latest []Finding
+}
+
+// NewFindingsManager takes a connection to a mongo db and connects to the
+// findings collection
+func NewFindingsManager(db *mgo.Database) *FindingsManager {
+	manager := &FindingsManager{
+		collection: db.C("findings"),
+	}
+
+	// We may have run on this target before.  If so, reload the findings
+	// that we've seen before
+	targetID := util.DefaultEnv("TARGET_ID", "")
+	if targetID != "" {
+		findings, err := manager.GetAll(targetID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager.uniqueFindings = findings
+	}
+	return manager
+}
+
+// GetAll returns all findings for the given target id
+func (manager *FindingsManager) GetAll(targetID string) ([]Finding, error) {
+	var results []Finding
+	query := bson.M{"TargetID": targetID}
+	err := manager.collection.Find(query).All(&results)
+	return results, errors.WithStack(err)
+}
+
+// WriteOne writes a single finding
+func (manager *FindingsManager) WriteOne(finding Finding) error {
+	return errors.WithStack(manager.collection.Insert(finding))
+}
+
+// Drop a collection
+func (manager *FindingsManager) Drop() error {
+	return errors.WithStack(manager.collection.DropCollection())
+}
+
+func findingsEqual(finding1 Finding, finding2 Finding) bool {
+	return finding1.Kind == finding2.Kind &&
+		finding1.Path == finding2.Path &&
+		finding1.Method == finding2.Method &&
+		finding1.Param == finding2.Param &&
+		finding1.TargetID == finding2.TargetID
+}
+
+// Update stores any findings that haven't been seen before
+func (manager *FindingsManager) Update(findings []*Finding) error {
+	// Assume we don't see a unique finding
+	manager.Delta = false
+	manager.Latest = nil
+
+	for _, finding := range findings {
+		if manager.seen(*finding) {
+			continue
+		}
+
+		// This finding is unique
+		log.Errorf("%s finding on %s %s: %s", finding.Kind, finding.Method,
+			finding.Path, finding.Message)
+		manager.Delta = true
+		manager.uniqueFindings = append(manager.uniqueFindings, *finding)
+		manager.Latest = append(manager.Latest, *finding)
+
+		// Log to db
+		err := manager.WriteOne(*finding)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selector matches the stored copy of a finding
+func selector(finding Finding) bson.M {
+	return bson.M{
+		"Kind":     finding.Kind,
+		"Verb":     finding.Method,
+		"Path":     finding.Path,
+		"Param":    finding.Param,
+		"TargetID": finding.TargetID,
+	}
+}
+
+// SetMinimized stores the minimized reproducer for a finding
+func (manager *FindingsManager) SetMinimized(finding Finding, curl string) error {
+	for i := range manager.uniqueFindings {
+		if findingsEqual(manager.uniqueFindings[i], finding) {
+			manager.uniqueFindings[i].MinimizedCurl = curl
+		}
+	}
+	update := bson.M{"$set": bson.M{"MinimizedCurl": curl}}
+	return errors.WithStack(manager.collection.Update(selector(finding), update))
+}
+
+// SetClosed marks a finding as fixed, or reopens it
+func (manager *FindingsManager) SetClosed(finding Finding, closed bool) error {
+	update := bson.M{"$set": bson.M{"Closed": closed}}
+	return errors.WithStack(manager.collection.Update(selector(finding), update))
+}
+
+// Have we seen this finding before?
+func (manager *FindingsManager) seen(finding Finding) bool {
+	for _, oldFinding := range manager.uniqueFindings {
+		if findingsEqual(oldFinding, finding) {
+			return true
+		}
+	}
+	return false
+}
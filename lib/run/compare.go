@@ -0,0 +1,149 @@
+package run
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Comparison of a run against an earlier, baseline run
+type Comparison struct {
+	Base *Run
+	Head *Run
+	// Change in coverage, in percentage points
+	CoverageDelta float64
+	// Coverage dropped by more than the tolerance
+	CoverageRegressed bool
+	// The runs fuzzed different specs, so route changes may be expected
+	SpecChanged bool
+	// Routes that fail in the head run but didn't in the base run
+	NewlyFailing []RouteChange
+	// Routes that failed in the base run but don't anymore
+	Recovered []RouteChange
+	// Exceptions and findings only hit in the head run
+	NewFindings []Finding
+	// Exceptions and findings only hit in the base run, on routes the head
+	// run sent requests to
+	FixedFindings []Finding
+	// Exceptions and findings only hit in the base run, on routes the head
+	// run never reached
+	UntestedFindings []Finding
+}
+
+// RouteChange is a route with its failures in both runs
+type RouteChange struct {
+	Method string
+	Path   string
+	// Requests that got a 5xx or no response
+	BaseFailures int
+	BaseRequests int
+	HeadFailures int
+	HeadRequests int
+}
+
+// failures counts the requests to a route that got a 5xx or no response
+func failures(stats *RouteStats) int {
+	if stats == nil {
+		return 0
+	}
+	count := 0
+	for status, num := range stats.StatusCodes {
+		code, err := strconv.Atoi(status)
+		if err != nil || code >= 500 {
+			count += num
+		}
+	}
+	return count
+}
+
+// Compare diffs head against base.  Coverage drops within tolerance
+// percentage points are considered noise.
+func Compare(base *Run, head *Run, tolerance float64) *Comparison {
+	comparison := &Comparison{
+		Base:          base,
+		Head:          head,
+		CoverageDelta: head.Coverage - base.Coverage,
+		SpecChanged:   base.SpecHash != head.SpecHash,
+	}
+	comparison.CoverageRegressed = comparison.CoverageDelta < -tolerance
+
+	// Routes hit by either run
+	routes := append(head.SortedRoutes(), base.SortedRoutes()...)
+	seen := map[string]bool{}
+	for _, stats := range routes {
+		key := RouteKey(stats.Method, stats.Path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		baseStats := base.Route(stats.Method, stats.Path)
+		headStats := head.Route(stats.Method, stats.Path)
+		change := RouteChange{
+			Method:       stats.Method,
+			Path:         stats.Path,
+			BaseFailures: failures(baseStats),
+			HeadFailures: failures(headStats),
+		}
+		if baseStats != nil {
+			change.BaseRequests = baseStats.Requests
+		}
+		if headStats != nil {
+			change.HeadRequests = headStats.Requests
+		}
+		switch {
+		case change.BaseFailures == 0 && change.HeadFailures > 0:
+			comparison.NewlyFailing = append(comparison.NewlyFailing, change)
+		// Only count a route as recovered if the head run actually sent
+		// requests to it
+		case change.BaseFailures > 0 && change.HeadFailures == 0 && change.HeadRequests > 0:
+			comparison.Recovered = append(comparison.Recovered, change)
+		}
+	}
+	sortRoutes(comparison.NewlyFailing)
+	sortRoutes(comparison.Recovered)
+
+	comparison.NewFindings = missing(head.Findings, base.Findings)
+	// Only count a finding as fixed if the head run actually sent requests
+	// to its route
+	for _, found := range missing(base.Findings, head.Findings) {
+		if stats := head.Route(found.Method, found.Path); stats != nil && stats.Requests > 0 {
+			comparison.FixedFindings = append(comparison.FixedFindings, found)
+		} else {
+			comparison.UntestedFindings = append(comparison.UntestedFindings, found)
+		}
+	}
+	return comparison
+}
+
+// Regressed checks if the head run is worse than the base run
+func (comparison *Comparison) Regressed() bool {
+	return comparison.CoverageRegressed || len(comparison.NewlyFailing) > 0 ||
+		len(comparison.NewFindings) > 0
+}
+
+func sortRoutes(changes []RouteChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Method < changes[j].Method
+	})
+}
+
+// missing returns the findings in a that aren't in b, ordered by key
+func missing(a []Finding, b []Finding) []Finding {
+	keys := map[string]bool{}
+	for _, found := range b {
+		keys[found.Key] = true
+	}
+	result := []Finding{}
+	for _, found := range a {
+		if !keys[found.Key] {
+			result = append(result, found)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
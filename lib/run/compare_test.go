@@ -0,0 +1,63 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	base := New("target")
+	base.SpecHash = "a"
+	base.Record("get", "/posts", 200)
+	base.Record("get", "/users", 500)
+	base.Record("get", "/topics", 200)
+	base.UpdateCoverage(30)
+	base.AddFinding(Finding{Key: "fixed", Method: "GET", Path: "/users"})
+	base.AddFinding(Finding{Key: "untested", Method: "GET", Path: "/topics"})
+	base.AddFinding(Finding{Key: "both"})
+
+	head := New("target")
+	head.SpecHash = "a"
+	head.Record("get", "/posts", 0)
+	head.Record("get", "/users", 200)
+	head.Record("get", "/tags", 502)
+	head.UpdateCoverage(29.8)
+	head.AddFinding(Finding{Key: "both"})
+	head.AddFinding(Finding{Key: "new"})
+
+	comparison := Compare(base, head, 0.5)
+	require.False(t, comparison.SpecChanged)
+	require.InDelta(t, -0.2, comparison.CoverageDelta, 0.001)
+	require.False(t, comparison.CoverageRegressed)
+
+	// Routes only hit by the head run count as newly failing
+	require.Len(t, comparison.NewlyFailing, 2)
+	require.Equal(t, "/posts", comparison.NewlyFailing[0].Path)
+	require.Equal(t, 1, comparison.NewlyFailing[0].HeadFailures)
+	require.Equal(t, "/tags", comparison.NewlyFailing[1].Path)
+	require.Equal(t, 0, comparison.NewlyFailing[1].BaseRequests)
+
+	require.Len(t, comparison.Recovered, 1)
+	require.Equal(t, "/users", comparison.Recovered[0].Path)
+
+	require.Len(t, comparison.NewFindings, 1)
+	require.Equal(t, "new", comparison.NewFindings[0].Key)
+	require.Len(t, comparison.FixedFindings, 1)
+	require.Equal(t, "fixed", comparison.FixedFindings[0].Key)
+	// The head run never sent requests to the route
+	require.Len(t, comparison.UntestedFindings, 1)
+	require.Equal(t, "untested", comparison.UntestedFindings[0].Key)
+	require.True(t, comparison.Regressed())
+
+	// A bigger drop in coverage is a regression on its own
+	head = New("target")
+	head.Record("get", "/posts", 200)
+	head.UpdateCoverage(20)
+	head.Findings = base.Findings
+	comparison = Compare(base, head, 0.5)
+	require.True(t, comparison.SpecChanged)
+	require.True(t, comparison.CoverageRegressed)
+	require.Empty(t, comparison.NewlyFailing)
+	require.True(t, comparison.Regressed())
+}
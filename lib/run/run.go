@@ -0,0 +1,301 @@
+package run
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Sample coverage at least this often, in requests
+const sampleInterval = 100
+
+// Only keep this many postgres errors per run
+const maxPostgresErrors = 1000
+
+// Run summarizes a single fuzzing campaign against a target
+type Run struct {
+	RunID    string    `bson:"RunID"`
+	TargetID string    `bson:"TargetID"`
+	Start    time.Time `bson:"Start"`
+	End      time.Time `bson:"End"`
+	Requests int       `bson:"Requests"`
+	// Requests sent to minimize reproducers, not counted in Requests
+	MinimizeRequests int `bson:"MinimizeRequests"`
+	// Git ref of the target app, from GIT_REF
+	GitRef string `bson:"GitRef"`
+	// Seed of the random values we sent
+	Seed int64 `bson:"Seed"`
+	// Hash of the swagger spec we fuzzed with
+	SpecHash string `bson:"SpecHash"`
+	// Status codes across all routes, keyed by the stringified code.  Requests
+	// that never got a response are counted as "error".
+	StatusCodes map[string]int `bson:"StatusCodes"`
+	Coverage    float64        `bson:"Coverage"`
+	// Coverage over time
+	Samples []Sample `bson:"Samples"`
+	// Paths contain dots, so they can't be keys in mongo
+	Routes         []*RouteStats   `bson:"Routes"`
+	TaintedQueries []TaintedQuery  `bson:"TaintedQueries"`
+	PostgresErrors []PostgresError `bson:"PostgresErrors"`
+	// Exceptions and findings hit during the run, whether or not an earlier
+	// run already found them
+	Findings []Finding `bson:"Findings"`
+}
+
+// Sample of cumulative coverage
+type Sample struct {
+	Requests int       `bson:"Requests"`
+	Time     time.Time `bson:"Time"`
+	Coverage float64   `bson:"Coverage"`
+}
+
+// RouteStats are the requests sent to a single route
+type RouteStats struct {
+	Method      string         `bson:"Method"`
+	Path        string         `bson:"Path"`
+	Requests    int            `bson:"Requests"`
+	StatusCodes map[string]int `bson:"StatusCodes"`
+	// Requests sent to minimize reproducers found on the route
+	MinimizeRequests int `bson:"MinimizeRequests"`
+}
+
+// TaintedQuery maps a parameter of a route to the table and column it ended
+// up in
+type TaintedQuery struct {
+	Method string `bson:"Method"`
+	Path   string `bson:"Path"`
+	Param  string `bson:"Param"`
+	Table  string `bson:"Table"`
+	Column string `bson:"Column"`
+	Query  string `bson:"Query"`
+}
+
+// PostgresError logged while handling a request
+type PostgresError struct {
+	Method   string `bson:"Method"`
+	Path     string `bson:"Path"`
+	Severity string `bson:"Severity"`
+	Code     string `bson:"Code"`
+	Message  string `bson:"Message"`
+	Query    string `bson:"Query"`
+}
+
+// Finding is an exception or detector finding hit during a run
+type Finding struct {
+	// Identifies the bug across runs
+	Key string `bson:"Key"`
+	// Finding kind, or exception/<Class> for exceptions
+	Kind    string `bson:"Kind"`
+	Method  string `bson:"Method"`
+	Path    string `bson:"Path"`
+	Message string `bson:"Message"`
+	// Number of times it was hit during the run
+	Count int `bson:"Count"`
+}
+
+// FromException summarizes an exception.  Exceptions are identified by their
+// fingerprint.
+func FromException(exc exception.Exception) Finding {
+	return Finding{
+		Key:     "exception/" + exc.Fingerprint,
+		Kind:    "exception/" + exc.Class,
+		Method:  exc.Method,
+		Path:    exc.Path,
+		Message: exc.Message,
+	}
+}
+
+// FromFinding summarizes a detector finding.  Findings are identified by
+// their kind, route and parameter.
+func FromFinding(found finding.Finding) Finding {
+	return Finding{
+		Key:     strings.Join([]string{found.Kind, strings.ToUpper(found.Method), found.Path, found.Param}, " "),
+		Kind:    found.Kind,
+		Method:  found.Method,
+		Path:    found.Path,
+		Message: found.Message,
+	}
+}
+
+// HashFile returns the sha1 of a file, i.e. the swagger spec
+func HashFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// New starts a run against the target
+func New(targetID string) *Run {
+	return &Run{
+		RunID:       uuid.New().String(),
+		TargetID:    targetID,
+		Start:       time.Now(),
+		StatusCodes: map[string]int{},
+	}
+}
+
+// RouteKey identifies a route, i.e. "GET /posts"
+func RouteKey(method string, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+func statusKey(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
+
+// Record counts a request sent to a route.  Status is 0 if we never got a
+// response.
+func (run *Run) Record(method string, path string, status int) {
+	run.Requests++
+	key := statusKey(status)
+	run.StatusCodes[key]++
+
+	stats := run.routeStats(method, path)
+	stats.Requests++
+	stats.StatusCodes[key]++
+}
+
+// RecordMinimize counts a request sent to minimize a reproducer found on a
+// route
+func (run *Run) RecordMinimize(method string, path string) {
+	run.MinimizeRequests++
+	run.routeStats(method, path).MinimizeRequests++
+}
+
+// routeStats returns the stats for a route, adding them if they're missing
+func (run *Run) routeStats(method string, path string) *RouteStats {
+	stats := run.Route(method, path)
+	if stats == nil {
+		stats = &RouteStats{Method: strings.ToUpper(method), Path: path, StatusCodes: map[string]int{}}
+		run.Routes = append(run.Routes, stats)
+	}
+	return stats
+}
+
+// UpdateCoverage stores the cumulative coverage after the most recent request,
+// sampling it when it changes and every sampleInterval requests
+func (run *Run) UpdateCoverage(coverage float64) {
+	changed := len(run.Samples) == 0 || coverage != run.Coverage
+	run.Coverage = coverage
+	if changed || run.Requests%sampleInterval == 0 {
+		run.Samples = append(run.Samples, Sample{Requests: run.Requests, Time: time.Now(), Coverage: coverage})
+	}
+}
+
+// AddTaintedQuery records where a parameter ended up in the database.  Each
+// parameter, table and column is only stored once.
+func (run *Run) AddTaintedQuery(tainted TaintedQuery) {
+	for _, seen := range run.TaintedQueries {
+		if seen.Method == tainted.Method && seen.Path == tainted.Path && seen.Param == tainted.Param &&
+			seen.Table == tainted.Table && seen.Column == tainted.Column {
+			return
+		}
+	}
+	run.TaintedQueries = append(run.TaintedQueries, tainted)
+}
+
+// AddPostgresError records an error postgres logged
+func (run *Run) AddPostgresError(pgErr PostgresError) {
+	if len(run.PostgresErrors) < maxPostgresErrors {
+		run.PostgresErrors = append(run.PostgresErrors, pgErr)
+	}
+}
+
+// AddFinding records a hit of an exception or finding
+func (run *Run) AddFinding(found Finding) {
+	for i := range run.Findings {
+		if run.Findings[i].Key == found.Key {
+			run.Findings[i].Count++
+			return
+		}
+	}
+	found.Count = 1
+	run.Findings = append(run.Findings, found)
+}
+
+// Route returns the stats for a route, or nil if nothing was sent to it
+func (run *Run) Route(method string, path string) *RouteStats {
+	for _, stats := range run.Routes {
+		if stats.Path == path && stats.Method == strings.ToUpper(method) {
+			return stats
+		}
+	}
+	return nil
+}
+
+// SortedRoutes returns the route stats ordered by path then method
+func (run *Run) SortedRoutes() []*RouteStats {
+	routes := append([]*RouteStats{}, run.Routes...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// RunsManager stores runs in a db
+type RunsManager struct {
+	collection *mgo.Collection
+	// Latest status of each run
+	status *mgo.Collection
+}
+
+// NewRunsManager takes a connection to a mongo db and connects to the runs
+// and status collections
+func NewRunsManager(db *mgo.Database) *RunsManager {
+	return &RunsManager{collection: db.C("runs"), status: db.C("status")}
+}
+
+// Save writes the run, replacing any earlier copy
+func (manager *RunsManager) Save(run *Run) error {
+	_, err := manager.collection.Upsert(bson.M{"RunID": run.RunID}, run)
+	return errors.WithStack(err)
+}
+
+// Get reads a single run by id
+func (manager *RunsManager) Get(runID string) (*Run, error) {
+	run := &Run{}
+	err := manager.collection.Find(bson.M{"RunID": runID}).One(run)
+	return run, errors.WithStack(err)
+}
+
+// Latest reads the most recently started run for the target
+func (manager *RunsManager) Latest(targetID string) (*Run, error) {
+	run := &Run{}
+	err := manager.collection.Find(bson.M{"TargetID": targetID}).Sort("-Start").One(run)
+	return run, errors.WithStack(err)
+}
+
+// LatestAt reads the most recently started run for the target at a git ref
+func (manager *RunsManager) LatestAt(targetID string, gitRef string) (*Run, error) {
+	run := &Run{}
+	query := bson.M{"TargetID": targetID, "GitRef": gitRef}
+	err := manager.collection.Find(query).Sort("-Start").One(run)
+	return run, errors.WithStack(err)
+}
+
+// GetAll returns every run for the target, oldest first
+func (manager *RunsManager) GetAll(targetID string) ([]Run, error) {
+	var results []Run
+	err := manager.collection.Find(bson.M{"TargetID": targetID}).Sort("Start").All(&results)
+	return results, errors.WithStack(err)
+}
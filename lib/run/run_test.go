@@ -0,0 +1,79 @@
+package run
+
+import (
+	"testing"
+
+	"github.com/mruck/athena/lib/exception"
+	"github.com/mruck/athena/lib/finding"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	run := New("target")
+	run.Record("get", "/posts.json", 200)
+	run.Record("GET", "/posts.json", 0)
+	run.Record("post", "/posts", 422)
+
+	require.Equal(t, 3, run.Requests)
+	require.Equal(t, map[string]int{"200": 1, "error": 1, "422": 1}, run.StatusCodes)
+	stats := run.Route("get", "/posts.json")
+	require.NotNil(t, stats)
+	require.Equal(t, 2, stats.Requests)
+	require.Equal(t, map[string]int{"200": 1, "error": 1}, stats.StatusCodes)
+	require.Nil(t, run.Route("delete", "/posts.json"))
+
+	routes := run.SortedRoutes()
+	require.Equal(t, "/posts", routes[0].Path)
+	require.Equal(t, "/posts.json", routes[1].Path)
+
+	// Minimizing doesn't count as fuzzing
+	run.RecordMinimize("get", "/posts.json")
+	require.Equal(t, 3, run.Requests)
+	require.Equal(t, 1, run.MinimizeRequests)
+	require.Equal(t, 1, stats.MinimizeRequests)
+	require.Equal(t, 2, stats.Requests)
+}
+
+func TestUpdateCoverage(t *testing.T) {
+	run := New("target")
+	for i := 1; i <= 2*sampleInterval; i++ {
+		run.Record("get", "/", 200)
+		coverage := 1.0
+		if i > 10 {
+			coverage = 2.0
+		}
+		run.UpdateCoverage(coverage)
+	}
+	// The first sample, the change and every sampleInterval requests
+	requests := []int{}
+	for _, sample := range run.Samples {
+		requests = append(requests, sample.Requests)
+	}
+	require.Equal(t, []int{1, 11, sampleInterval, 2 * sampleInterval}, requests)
+	require.Equal(t, 2.0, run.Coverage)
+}
+
+func TestAddTaintedQuery(t *testing.T) {
+	run := New("target")
+	tainted := TaintedQuery{Method: "POST", Path: "/posts", Param: "title", Table: "posts", Column: "title", Query: "INSERT ..."}
+	run.AddTaintedQuery(tainted)
+	tainted.Query = "UPDATE ..."
+	run.AddTaintedQuery(tainted)
+	require.Len(t, run.TaintedQueries, 1)
+}
+
+func TestAddFinding(t *testing.T) {
+	run := New("target")
+	exc := exception.Exception{Class: "NoMethodError", Fingerprint: "abc", Method: "GET", Path: "/posts"}
+	run.AddFinding(FromException(exc))
+	// Same bug from a different route
+	exc.Path = "/users"
+	run.AddFinding(FromException(exc))
+	run.AddFinding(FromFinding(finding.Finding{Kind: "dos", Method: "get", Path: "/posts", Param: "q"}))
+
+	require.Len(t, run.Findings, 2)
+	require.Equal(t, "exception/abc", run.Findings[0].Key)
+	require.Equal(t, "exception/NoMethodError", run.Findings[0].Kind)
+	require.Equal(t, 2, run.Findings[0].Count)
+	require.Equal(t, "dos GET /posts q", run.Findings[1].Key)
+}
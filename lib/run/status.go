@@ -0,0 +1,110 @@
+package run
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Phases of a run as published in its status
+const (
+	Fuzzing  = "fuzzing"
+	Paused   = "paused"
+	Finished = "finished"
+	// Stopped before running out of routes
+	Stopped = "stopped"
+)
+
+// The fuzzer publishes its status this often, including while paused
+const StatusInterval = 2 * time.Second
+
+// A run that hasn't published its status for this long is presumed dead
+const staleAfter = 5 * StatusInterval
+
+// Status is a small, frequently published snapshot of a run's progress
+type Status struct {
+	RunID    string `bson:"RunID"`
+	TargetID string `bson:"TargetID"`
+	Phase    string `bson:"Phase"`
+	// Route being fuzzed, i.e. "GET /posts"
+	CurrentRoute string    `bson:"CurrentRoute"`
+	Requests     int       `bson:"Requests"`
+	Coverage     float64   `bson:"Coverage"`
+	Exceptions   int       `bson:"Exceptions"`
+	Findings     int       `bson:"Findings"`
+	Start        time.Time `bson:"Start"`
+	Updated      time.Time `bson:"Updated"`
+}
+
+// Status snapshots the run.  Exceptions and findings are the unique ones hit
+// so far.
+func (run *Run) Status(phase string, currentRoute string) *Status {
+	status := &Status{
+		RunID:        run.RunID,
+		TargetID:     run.TargetID,
+		Phase:        phase,
+		CurrentRoute: currentRoute,
+		Requests:     run.Requests,
+		Coverage:     run.Coverage,
+		Start:        run.Start,
+		Updated:      time.Now(),
+	}
+	for _, found := range run.Findings {
+		if strings.HasPrefix(found.Kind, "exception/") {
+			status.Exceptions++
+		} else {
+			status.Findings++
+		}
+	}
+	return status
+}
+
+// Done checks if the run is over, one way or another
+func (status *Status) Done() bool {
+	return status.Phase == Finished || status.Phase == Stopped
+}
+
+// Stale checks if the fuzzer stopped publishing the status of a run that
+// isn't over, i.e. because its pod was killed
+func (status *Status) Stale() bool {
+	return !status.Done() && time.Since(status.Updated) > staleAfter
+}
+
+// SaveStatus publishes the status of a run, replacing the previous one
+func (manager *RunsManager) SaveStatus(status *Status) error {
+	_, err := manager.status.Upsert(bson.M{"RunID": status.RunID}, status)
+	return errors.WithStack(err)
+}
+
+// GetStatus reads the most recently published status of a run
+func (manager *RunsManager) GetStatus(runID string) (*Status, error) {
+	status := &Status{}
+	err := manager.status.Find(bson.M{"RunID": runID}).One(status)
+	return status, errors.WithStack(err)
+}
+
+// LatestStatus reads the status of the most recently started run against a
+// target
+func (manager *RunsManager) LatestStatus(targetID string) (*Status, error) {
+	status := &Status{}
+	err := manager.status.Find(bson.M{"TargetID": targetID}).Sort("-Start").One(status)
+	return status, errors.WithStack(err)
+}
+
+// Targets returns the id of every target that has been fuzzed
+func (manager *RunsManager) Targets() ([]string, error) {
+	var targetIDs []string
+	err := manager.collection.Find(nil).Distinct("TargetID", &targetIDs)
+	return targetIDs, errors.WithStack(err)
+}
+
+// List returns every run for the target, oldest first, without the per
+// route stats, samples and queries
+func (manager *RunsManager) List(targetID string) ([]Run, error) {
+	var results []Run
+	omit := bson.M{"Routes": 0, "Samples": 0, "TaintedQueries": 0, "PostgresErrors": 0}
+	err := manager.collection.Find(bson.M{"TargetID": targetID}).Select(omit).Sort("Start").All(&results)
+	return results, errors.WithStack(err)
+}
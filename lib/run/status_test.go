@@ -0,0 +1,39 @@
+package run
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	run := New("target")
+	run.Record("get", "/posts", 200)
+	run.UpdateCoverage(12.5)
+	run.AddFinding(Finding{Key: "exception/abc", Kind: "exception/NoMethodError"})
+	run.AddFinding(Finding{Key: "exception/abc", Kind: "exception/NoMethodError"})
+	run.AddFinding(Finding{Key: "exception/def", Kind: "exception/ArgumentError"})
+	run.AddFinding(Finding{Key: "dos GET /posts q", Kind: "dos"})
+
+	status := run.Status(Fuzzing, "GET /posts")
+	require.Equal(t, run.RunID, status.RunID)
+	require.Equal(t, "target", status.TargetID)
+	require.Equal(t, Fuzzing, status.Phase)
+	require.Equal(t, "GET /posts", status.CurrentRoute)
+	require.Equal(t, 1, status.Requests)
+	require.Equal(t, 12.5, status.Coverage)
+	require.Equal(t, 2, status.Exceptions)
+	require.Equal(t, 1, status.Findings)
+	require.False(t, status.Updated.Before(run.Start))
+}
+
+func TestStale(t *testing.T) {
+	status := New("target").Status(Fuzzing, "GET /posts")
+	require.False(t, status.Stale())
+	status.Updated = time.Now().Add(-staleAfter - time.Second)
+	require.True(t, status.Stale())
+	// Finished runs stop publishing
+	status.Phase = Finished
+	require.False(t, status.Stale())
+}
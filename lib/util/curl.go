@@ -0,0 +1,125 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// splitShell splits a command line into words the way a shell would, handling
+// single quotes, double quotes and backslash escapes
+func splitShell(cmd string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.Errorf("unterminated single quote in %q", cmd)
+			}
+			word.WriteString(cmd[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte(`"\$`+"`", cmd[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(cmd[i])
+			}
+			if i == len(cmd) {
+				return nil, errors.Errorf("unterminated double quote in %q", cmd)
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(cmd):
+			i++
+			word.WriteByte(cmd[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ParseCurl converts a curl command, as logged by LogAsCurl, back into a
+// request
+func ParseCurl(cmd string) (*http.Request, error) {
+	words, err := splitShell(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 || words[0] != "curl" {
+		return nil, errors.Errorf("not a curl command: %q", cmd)
+	}
+
+	method, url := "", ""
+	var body *string
+	headers := http.Header{}
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		// Flags we understand all take an argument
+		takesArg := word == "-X" || word == "--request" || word == "-d" || word == "--data" ||
+			word == "--data-raw" || word == "-H" || word == "--header"
+		if takesArg {
+			if i+1 == len(words) {
+				return nil, errors.Errorf("%s is missing an argument in %q", word, cmd)
+			}
+			i++
+		}
+		switch word {
+		case "-X", "--request":
+			method = words[i]
+		case "-d", "--data", "--data-raw":
+			data := words[i]
+			body = &data
+		case "-H", "--header":
+			parts := strings.SplitN(words[i], ":", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("bad header %q", words[i])
+			}
+			headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		default:
+			if strings.HasPrefix(word, "-") {
+				return nil, errors.Errorf("unsupported curl flag %s", word)
+			}
+			url = word
+		}
+	}
+	if url == "" {
+		return nil, errors.Errorf("no url in %q", cmd)
+	}
+	if method == "" {
+		method = "GET"
+		if body != nil {
+			method = "POST"
+		}
+	}
+
+	var req *http.Request
+	if body != nil {
+		req, err = http.NewRequest(method, url, strings.NewReader(*body))
+	} else {
+		req, err = http.NewRequest(method, url, nil)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header = headers
+	return req, nil
+}
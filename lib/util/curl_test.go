@@ -0,0 +1,50 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/moul/http2curl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitShell(t *testing.T) {
+	words, err := splitShell(`curl -d 'it'\''s' "a \"b\"" c\ d`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"curl", "-d", "it's", `a "b"`, "c d"}, words)
+
+	_, err = splitShell(`curl 'oops`)
+	require.Error(t, err)
+}
+
+func TestParseCurl(t *testing.T) {
+	body := `{"name": "it's <b>"}`
+	orig, err := http.NewRequest("PUT", "http://localhost:3000/posts/1?a=b&c=%27", strings.NewReader(body))
+	require.NoError(t, err)
+	orig.Header.Set("Content-Type", "application/json")
+	orig.Header.Set("X-Csrf-Token", "abc")
+	cmd, err := http2curl.GetCurlCommand(orig)
+	require.NoError(t, err)
+
+	req, err := ParseCurl(cmd.String())
+	require.NoError(t, err)
+	require.Equal(t, "PUT", req.Method)
+	require.Equal(t, orig.URL.String(), req.URL.String())
+	require.Equal(t, "abc", req.Header.Get("X-Csrf-Token"))
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	data, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(data))
+
+	// No method and no body
+	req, err = ParseCurl("curl 'http://localhost:3000/'")
+	require.NoError(t, err)
+	require.Equal(t, "GET", req.Method)
+
+	_, err = ParseCurl("wget http://localhost:3000/")
+	require.Error(t, err)
+	_, err = ParseCurl("curl -k http://localhost:3000/")
+	require.Error(t, err)
+}
@@ -1,22 +1,76 @@
 package util
 
 import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
 	fuzz "github.com/google/gofuzz"
-	"github.com/google/uuid"
+	"github.com/mruck/athena/lib/log"
 )
 
-// RandString returns a stringified uuid.
+// lockedSource is a rand.Source that is safe for concurrent use
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.src.Seed(seed)
+}
+
+// Every mutated value we send is drawn from here, so a run can be repeated by
+// reusing its seed.  Detector tokens aren't, since reusing them would
+// attribute canaries left by an earlier run to this one.
+var source = &lockedSource{src: rand.NewSource(time.Now().UnixNano())}
+var random = rand.New(source)
+
+// SeedRand seeds the random values we send
+func SeedRand(seed int64) {
+	source.Seed(seed)
+}
+
+// GetSeed returns the seed from the SEED env var, or a new one based on the
+// time if it isn't set
+func GetSeed() int64 {
+	val := os.Getenv("SEED")
+	if val == "" {
+		return time.Now().UnixNano()
+	}
+	seed, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		log.Fatalf("invalid SEED %q: %v", val, err)
+	}
+	return seed
+}
+
+// RandIntn returns a random int in [0, n)
+func RandIntn(n int) int {
+	return random.Intn(n)
+}
+
+// RandString returns 4 random hex characters.
 // This data should use a much more normal encoding
 // than go fuzz
 func RandString() string {
-	uid := uuid.New()
-	return uid.String()[:4]
+	return fmt.Sprintf("%04x", random.Intn(1<<16))
 }
 
 // Rand returns a random object of type typ.
 // Returns a random string if the data type doesn't match
 func Rand(dataType string) interface{} {
-	f := fuzz.New()
+	f := fuzz.New().RandSource(source)
 	switch dataType {
 	case "integer":
 		fallthrough
@@ -27,3 +27,14 @@ func TestRand(t *testing.T) {
 	_, ok = val.(string)
 	require.True(t, ok)
 }
+
+func TestSeedRand(t *testing.T) {
+	draw := func() []interface{} {
+		return []interface{}{Rand("integer"), Rand("boolean"), Rand("decimal"), Rand("string"), RandIntn(1000)}
+	}
+	SeedRand(42)
+	first := draw()
+	SeedRand(42)
+	require.Equal(t, first, draw())
+	require.Len(t, RandString(), 4)
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Tailer reads lines appended to a file since the last read
+type Tailer struct {
+	Path string
+	// Bytes consumed so far
+	offset int64
+}
+
+// NewTailer returns a tailer starting at the end of the file at path, so
+// lines written before we started aren't read.  If the file doesn't exist
+// yet, everything written to it is read.
+func NewTailer(path string) *Tailer {
+	tailer := &Tailer{Path: path}
+	info, err := os.Stat(path)
+	if err == nil {
+		tailer.offset = info.Size()
+	}
+	return tailer
+}
+
+// ReadLines returns every complete line appended since the last call.  A
+// partially written trailing line is left for the next call.  If the file was
+// truncated or replaced with something smaller, we start over from the
+// beginning.  A missing file has no lines.
+func (tailer *Tailer) ReadLines() ([]string, error) {
+	file, err := os.Open(tailer.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if info.Size() < tailer.offset {
+		tailer.offset = 0
+	}
+	if info.Size() == tailer.offset {
+		return nil, nil
+	}
+
+	_, err = file.Seek(tailer.offset, io.SeekStart)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	data := make([]byte, info.Size()-tailer.offset)
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, errors.WithStack(err)
+	}
+	data = data[:n]
+
+	// Only consume complete lines
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	tailer.offset += int64(end + 1)
+
+	lines := []string{}
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		lines = append(lines, string(line))
+	}
+	return lines, nil
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.json")
+	tailer := NewTailer(path)
+
+	// Missing file
+	lines, err := tailer.ReadLines()
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	appendFile := func(data string) {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = file.WriteString(data)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	// Partial lines wait for their newline
+	appendFile("a\nb\nc")
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, lines)
+
+	appendFile("d\n")
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cd"}, lines)
+
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	// Truncated files are read from the start
+	require.NoError(t, ioutil.WriteFile(path, []byte("e\n"), 0644))
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"e"}, lines)
+
+	// Lines written before we started tailing aren't read
+	tailer = NewTailer(path)
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Empty(t, lines)
+	appendFile("f\n")
+	lines, err = tailer.ReadLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"f"}, lines)
+}
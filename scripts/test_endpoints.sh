@@ -18,7 +18,18 @@ sleep 30
 echo "Hitting /FuzzTarget"
 IP_ADDR=104.154.144.253
 CONTAINERS=$(cat target_configs/discourse.json)
-TARGET_META=$(curl -d "$CONTAINERS" http://$IP_ADDR:30080/FuzzTarget)
+JOB_ID=$(curl -d "$CONTAINERS" http://$IP_ADDR:30080/FuzzTarget | jq -r .JobID)
+
+# The pod is launched in the background, wait for the job to finish
+STATE=queued
+while [ "$STATE" = "queued" ] || [ "$STATE" = "running" ]; do
+    echo "Polling job $JOB_ID..."; sleep 5
+    TARGET_META=$(curl http://$IP_ADDR:30080/Jobs/$JOB_ID)
+    STATE=$(jq -r .State <<< $TARGET_META)
+done
+if [ "$STATE" != "succeeded" ]; then
+    echo "Job $JOB_ID $STATE: $TARGET_META"; exit 1
+fi
 
 TARGET_ID=$(jq -r .TargetID <<< $TARGET_META)
 POD_NAME=$(jq -r .PodName <<< $TARGET_META)